@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"map-generator/mapgen"
+)
+
+// BuildOptions control how the selected maps are built.
+type BuildOptions struct {
+	// Force rebuilds maps whose output is already up to date.
+	Force bool
+	// Jobs is the number of maps built concurrently.
+	Jobs int
+	// MemoryBudget caps the estimated memory of concurrent builds in bytes.
+	// Zero means no limit.
+	MemoryBudget uint64
+	// Stream builds every map in streaming mode, not just those larger than
+	// streamPixels.
+	Stream bool
+	// MaxUnclassified fails maps where more than this percentage of the
+	// pixels match no legend color. Nil means no limit.
+	MaxUnclassified *float64
+}
+
+// streamPixels is the image size above which maps are built in streaming
+// mode: the image is decoded a strip of rows at a time and map.bin is
+// written as it is packed, so neither is held in memory as a whole.
+const streamPixels = maxRecommendedPixels
+
+func (o BuildOptions) stream(pixels int) bool {
+	return o.Stream || pixels > streamPixels
+}
+
+// mapSources are the raw input files of a map.
+type mapSources struct {
+	// ImageFile is the name of the source image or heightmap in the map
+	// folder, and Image its contents.
+	ImageFile string
+	Image     []byte
+	Info      []byte
+	// Legend is the shared legend file, nil if the map doesn't use one.
+	Legend []byte
+	// WaterMask is the water mask of a heightmap, nil for color images.
+	WaterMask []byte
+	// DEM is set when Image is a digital elevation model.
+	DEM bool
+}
+
+func readSources(m MapEntry) (mapSources, error) {
+	inputPath := filepath.Join(m.Dir, m.sourceFile())
+	imageBuffer, err := os.ReadFile(inputPath)
+	if err != nil {
+		return mapSources{}, fmt.Errorf("failed to read map file %s: %w", inputPath, err)
+	}
+
+	// Read the info.json file
+	manifestPath := filepath.Join(m.Dir, "info.json")
+	manifestBuffer, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return mapSources{}, fmt.Errorf("failed to read info file %s: %w", manifestPath, err)
+	}
+	src := mapSources{ImageFile: m.sourceFile(), Image: imageBuffer, Info: manifestBuffer, DEM: m.DEM != ""}
+	if m.LegendFile != "" {
+		if src.Legend, err = os.ReadFile(m.LegendFile); err != nil {
+			return mapSources{}, fmt.Errorf("failed to read legend %s: %w", m.LegendFile, err)
+		}
+	}
+	if m.WaterMask != "" {
+		maskPath := filepath.Join(m.Dir, m.WaterMask)
+		if src.WaterMask, err = os.ReadFile(maskPath); err != nil {
+			return mapSources{}, fmt.Errorf("failed to read water mask %s: %w", maskPath, err)
+		}
+	}
+	return src, nil
+}
+
+func (s mapSources) Hash() string {
+	// The name of the source file tells how it is read, so it is part of
+	// the hash unless it is the usual image.png
+	var extra [][]byte
+	if s.ImageFile != imageFiles[0] {
+		extra = append(extra, []byte(s.ImageFile))
+	}
+	if s.WaterMask != nil {
+		extra = append(extra, s.WaterMask)
+	}
+	return sourceHash(s.Image, s.Info, s.Legend, extra...)
+}
+
+// legend returns the legend the map is classified with, nil for the default
+// one.
+func (s mapSources) legend(info InfoFile) (*mapgen.Legend, error) {
+	if info.Legend != nil {
+		legend, err := info.Legend.legend()
+		if err != nil {
+			return nil, fmt.Errorf("invalid legend in info.json: %w", err)
+		}
+		return legend, nil
+	}
+	if s.Legend == nil {
+		return nil, nil
+	}
+	var shared LegendInfo
+	if err := decodeStrict(s.Legend, &shared); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", sharedLegendFile, err)
+	}
+	legend, err := shared.legend()
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", sharedLegendFile, err)
+	}
+	return legend, nil
+}
+
+// outputFile is a single file written to a map's output directory.
+type outputFile struct {
+	Name string
+	Data []byte
+}
+
+// mapOutput is everything generated for a map, in the order it is written.
+type mapOutput struct {
+	Result   mapgen.MapResult
+	Files    []outputFile
+	Warnings []string
+}
+
+// renderMap generates a map in memory without touching the output directory.
+// With a non-nil mapWriter the map is built in streaming mode: map.bin is
+// written to mapWriter instead of being returned in Files. Nations are only
+// checked against the terrain if mapWriter is also an io.ReaderAt.
+func renderMap(m MapEntry, src mapSources, mapWriter io.Writer) (*mapOutput, error) {
+	name := m.Name
+
+	info, err := parseInfoFile(src.Info)
+	if err != nil {
+		return nil, fmt.Errorf("invalid info.json for %s: %w", name, err)
+	}
+	legend, err := src.legend(info)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	args := mapgen.GeneratorArgs{
+		RemoveSmall: m.RemoveSmall,
+		Legend:      legend,
+		Name:        name,
+		Stream:      mapWriter != nil,
+		MapWriter:   mapWriter,
+	}
+	if m.Heightmap != "" || m.DEM != "" {
+		if m.DEM != "" {
+			args.Heightmap, err = src.dem(info)
+		} else {
+			args.Heightmap, err = src.heightmap(info)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if args.HeightCurve, err = info.Source.heightCurve(); err != nil {
+			return nil, fmt.Errorf("invalid info.json for %s: %w", name, err)
+		}
+		if args.HeightCurve == nil && m.DEM != "" {
+			args.HeightCurve = mapgen.DefaultDEMCurve
+		}
+	} else {
+		args.ImageBuffer = src.Image
+	}
+
+	// Generate maps
+	result, err := mapgen.GenerateMap(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate map for %s: %w", name, err)
+	}
+
+	manifest := MapManifest{
+		Map:        newLODReport(result.Map),
+		Map16x:     newLODReport(result.Map16x),
+		Map4x:      newLODReport(result.Map4x),
+		Name:       info.Name,
+		Nations:    info.Nations,
+		SourceHash: src.Hash(),
+	}
+
+	// Serialize the updated manifest to JSON
+	updatedManifest, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize manifest for %s: %w", name, err)
+	}
+
+	out := &mapOutput{
+		Result:   result,
+		Warnings: validateMap(m, info, src, result, landLookup(result, mapWriter)),
+		Files: []outputFile{
+			{"map4x.bin", result.Map4x.Data},
+			{"map16x.bin", result.Map16x.Data},
+			{"thumbnail.webp", result.Thumbnail},
+			{"manifest.json", updatedManifest},
+		},
+	}
+	if mapWriter == nil {
+		out.Files = append([]outputFile{{"map.bin", result.Map.Data}}, out.Files...)
+	}
+	return out, nil
+}
+
+// landLookup returns whether the full resolution tile at x, y is land, reading
+// it back from mapWriter in streaming mode. It returns nil if the terrain
+// can't be read.
+func landLookup(result mapgen.MapResult, mapWriter io.Writer) func(x, y int) bool {
+	if mapWriter == nil {
+		return func(x, y int) bool {
+			return result.Map.Data[y*result.Map.Width+x]&mapgen.LandBit != 0
+		}
+	}
+	r, ok := mapWriter.(io.ReaderAt)
+	if !ok {
+		return nil
+	}
+	return func(x, y int) bool {
+		var tile [1]byte
+		_, err := r.ReadAt(tile[:], int64(y)*int64(result.Map.Width)+int64(x))
+		return err == nil && tile[0]&mapgen.LandBit != 0
+	}
+}
+
+// processMap builds a single map, filling in report as it goes. The map is
+// left untouched and reported as up to date when the existing output was
+// built from the same sources and opts.Force is unset.
+//
+// The output is written to a staging directory and replaces the map's
+// output directory only once every file is written, so a failed build leaves
+// the previous output as it was. The caller must hold the output lock.
+func processMap(paths Paths, m MapEntry, opts BuildOptions, report *MapReport) error {
+	name := m.Name
+	mapDir := filepath.Join(paths.outputMapDir(m.IsTest), name)
+	logger := slog.With("map", name)
+
+	src, err := readSources(m)
+	if err != nil {
+		return err
+	}
+	if !opts.Force && isUpToDate(mapDir, src.Hash()) {
+		logger.Info("Skipping map: output is up to date")
+		report.Status = StatusUpToDate
+		return nil
+	}
+
+	staged, err := newStagedDir(paths.outputMapDir(m.IsTest), name)
+	if err != nil {
+		return err
+	}
+	defer staged.discard()
+	var mapFile *os.File
+	var mapWriter io.Writer
+	if opts.stream(src.pixels()) {
+		mapFile, err = staged.create("map.bin")
+		if err != nil {
+			return fmt.Errorf("failed to write map.bin for %s: %w", name, err)
+		}
+		defer mapFile.Close()
+		mapWriter = mapFile
+	}
+	out, err := renderMap(m, src, mapWriter)
+	if err != nil {
+		return err
+	}
+	writeStart := time.Now()
+	report.Streamed = mapFile != nil
+	report.Warnings = out.Warnings
+	for _, w := range out.Warnings {
+		logger.Warn(w)
+	}
+	if err := checkUnclassified(out.Result.Unclassified, opts.MaxUnclassified); err != nil {
+		return err
+	}
+	for _, t := range out.Result.Timings {
+		report.Stages = append(report.Stages, newStageReport(t.Stage, t.Duration))
+	}
+	report.LODs = make(map[string]LODReport)
+	for _, lod := range out.Result.LODs() {
+		report.LODs[lod.Key] = newLODReport(lod.Info)
+	}
+
+	report.OutputBytes = make(map[string]int)
+	if mapFile != nil {
+		if err := mapFile.Sync(); err != nil {
+			return fmt.Errorf("failed to write map.bin for %s: %w", name, err)
+		}
+		if err := mapFile.Close(); err != nil {
+			return fmt.Errorf("failed to write map.bin for %s: %w", name, err)
+		}
+		report.OutputBytes["map.bin"] = out.Result.Map.Width * out.Result.Map.Height
+	}
+	for _, file := range out.Files {
+		if err := staged.writeFile(file.Name, file.Data); err != nil {
+			return fmt.Errorf("failed to write %s for %s: %w", file.Name, name, err)
+		}
+		report.OutputBytes[file.Name] = len(file.Data)
+	}
+	if err := staged.commit(mapDir); err != nil {
+		return fmt.Errorf("failed to write output for %s: %w", name, err)
+	}
+	report.Stages = append(report.Stages, newStageReport("write", time.Since(writeStart)))
+	logger.Debug("Stage finished", "stage", "write", "duration", time.Since(writeStart))
+	report.Status = StatusBuilt
+	return nil
+}
+
+// loadTerrainMaps builds the given maps and reports the outcome of each one.
+// A failing map does not stop the others from being built. The caller must
+// hold the output lock of the maps.
+func loadTerrainMaps(paths Paths, maps []MapEntry, opts BuildOptions) *BuildReport {
+	report := &BuildReport{
+		StartedAt: time.Now(),
+		Maps:      make([]MapReport, len(maps)),
+	}
+
+	jobs := make([]mapJob, len(maps))
+	index := make(map[MapEntry]int, len(maps))
+	for i, m := range maps {
+		jobs[i] = estimateJob(m, opts)
+		index[m] = i
+		report.Maps[i] = MapReport{Name: m.Name, Test: m.IsTest}
+	}
+
+	// Process maps on a bounded pool, largest first. Each job only writes
+	// its own slot of report.Maps.
+	runJobs(jobs, opts.Jobs, opts.MemoryBudget, func(m MapEntry) {
+		mapReport := &report.Maps[index[m]]
+		start := time.Now()
+		err := processMap(paths, m, opts, mapReport)
+		mapReport.DurationMS = time.Since(start).Milliseconds()
+		if err != nil {
+			slog.Error("Failed to build map", "map", m.Name, "err", err)
+			mapReport.Status = StatusFailed
+			mapReport.Error = err.Error()
+		} else if mapReport.Status == StatusBuilt {
+			slog.Info("Built map", "map", m.Name, "duration", time.Since(start), "streamed", mapReport.Streamed)
+		}
+	})
+
+	report.DurationMS = time.Since(report.StartedAt).Milliseconds()
+	report.tally()
+	return report
+}
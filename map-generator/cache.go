@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// generatorVersion is part of every source hash. Bump it whenever a change to
+// the generator alters its output, so that cached maps are rebuilt.
+const generatorVersion = "3"
+
+// sourceHashKey is the manifest.json key recording the hash of the inputs a
+// map was built from.
+const sourceHashKey = "source_hash"
+
+// outputFiles are the files written for every map.
+var outputFiles = []string{"map.bin", "map4x.bin", "map16x.bin", "thumbnail.webp", "manifest.json"}
+
+// sourceHash returns the build cache key for a map: a SHA-256 over the
+// generator version and the hashes of the source image, info.json, the
+// shared legend, if the map uses one, and any extra inputs.
+func sourceHash(imageBuffer, infoBuffer, legendBuffer []byte, extra ...[]byte) string {
+	imageSum := sha256.Sum256(imageBuffer)
+	infoSum := sha256.Sum256(infoBuffer)
+
+	h := sha256.New()
+	h.Write([]byte("map-generator/" + generatorVersion + "\n"))
+	h.Write(imageSum[:])
+	h.Write(infoSum[:])
+	if legendBuffer != nil {
+		legendSum := sha256.Sum256(legendBuffer)
+		h.Write(legendSum[:])
+	}
+	for _, b := range extra {
+		sum := sha256.Sum256(b)
+		h.Write(sum[:])
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// isUpToDate reports whether mapDir holds a complete build whose manifest
+// records the given source hash.
+func isUpToDate(mapDir, hash string) bool {
+	for _, file := range outputFiles {
+		if _, err := os.Stat(filepath.Join(mapDir, file)); err != nil {
+			return false
+		}
+	}
+
+	manifestBuffer, err := os.ReadFile(filepath.Join(mapDir, "manifest.json"))
+	if err != nil {
+		return false
+	}
+	var manifest map[string]interface{}
+	if err := json.Unmarshal(manifestBuffer, &manifest); err != nil {
+		return false
+	}
+	recorded, _ := manifest[sourceHashKey].(string)
+	return recorded == hash
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// logOptions configure the structured log written to stderr. Messages about
+// a single map carry a map field, and the generator's stages a stage field.
+type logOptions struct {
+	Format  string
+	Verbose bool
+	Quiet   bool
+}
+
+func (o *logOptions) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Format, "log-format", "text", "log format: text or json")
+	fs.BoolVar(&o.Verbose, "v", false, "also log every stage of every map")
+	fs.BoolVar(&o.Quiet, "q", false, "only log warnings and errors")
+}
+
+// setup installs the logger as the slog and log default.
+func (o logOptions) setup() error {
+	level := slog.LevelInfo
+	switch {
+	case o.Verbose && o.Quiet:
+		return fmt.Errorf("-v and -q can't be used together")
+	case o.Verbose:
+		level = slog.LevelDebug
+	case o.Quiet:
+		level = slog.LevelWarn
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch o.Format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, handlerOpts)
+	default:
+		return fmt.Errorf("unknown log format %q (want text or json)", o.Format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// profileOptions name the files CPU and heap profiles are written to, for
+// `go tool pprof`.
+type profileOptions struct {
+	CPU  string
+	Heap string
+}
+
+func (o *profileOptions) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.CPU, "cpuprofile", "", "write a CPU profile of the run to this file")
+	fs.StringVar(&o.Heap, "memprofile", "", "write a heap profile to this file when the run finishes")
+}
+
+// start begins CPU profiling if requested. The returned stop function ends it
+// and writes the heap profile.
+func (o profileOptions) start() (stop func() error, err error) {
+	var cpu *os.File
+	if o.CPU != "" {
+		if cpu, err = os.Create(o.CPU); err != nil {
+			return nil, fmt.Errorf("failed to create CPU profile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			return nil, fmt.Errorf("failed to start CPU profile: %w", err)
+		}
+	}
+	return func() error {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				return fmt.Errorf("failed to write CPU profile: %w", err)
+			}
+		}
+		if o.Heap == "" {
+			return nil
+		}
+		f, err := os.Create(o.Heap)
+		if err != nil {
+			return fmt.Errorf("failed to create heap profile: %w", err)
+		}
+		// Up to date statistics of everything allocated so far
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write heap profile: %w", err)
+		}
+		return f.Close()
+	}, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+
+	"map-generator/mapgen"
+)
+
+// Overlay colors, drawn over a dimmed copy of the new map.
+var (
+	overlayLandAdded      = color.RGBA{R: 0, G: 200, B: 0, A: 255}
+	overlayLandRemoved    = color.RGBA{R: 220, G: 0, B: 0, A: 255}
+	overlayOceanChanged   = color.RGBA{R: 0, G: 120, B: 255, A: 255}
+	overlayShoreChanged   = color.RGBA{R: 255, G: 200, B: 0, A: 255}
+	overlayLandUnchanged  = color.RGBA{R: 90, G: 90, B: 90, A: 255}
+	overlayWaterUnchanged = color.RGBA{R: 25, G: 25, B: 35, A: 255}
+)
+
+// MapDiff counts the tiles that changed between two builds of the same LOD.
+type MapDiff struct {
+	Tiles          int
+	Changed        int
+	LandAdded      int
+	LandRemoved    int
+	ShorelineAdded int
+	ShorelineLost  int
+	OceanAdded     int
+	OceanLost      int
+	Magnitude      int
+}
+
+func diffPackedMaps(a, b mapgen.PackedMap) MapDiff {
+	d := MapDiff{Tiles: len(a.Data)}
+	for i := range a.Data {
+		if a.Data[i] == b.Data[i] {
+			continue
+		}
+		d.Changed++
+		switch {
+		case !a.IsLand(i) && b.IsLand(i):
+			d.LandAdded++
+		case a.IsLand(i) && !b.IsLand(i):
+			d.LandRemoved++
+		}
+		switch {
+		case !a.IsShoreline(i) && b.IsShoreline(i):
+			d.ShorelineAdded++
+		case a.IsShoreline(i) && !b.IsShoreline(i):
+			d.ShorelineLost++
+		}
+		switch {
+		case !a.IsOcean(i) && b.IsOcean(i):
+			d.OceanAdded++
+		case a.IsOcean(i) && !b.IsOcean(i):
+			d.OceanLost++
+		}
+		if a.Magnitude(i) != b.Magnitude(i) {
+			d.Magnitude++
+		}
+	}
+	return d
+}
+
+// renderOverlay highlights the changes from a to b. Land changes take
+// precedence over ocean reclassification, which takes precedence over
+// shoreline changes; magnitude-only changes are not highlighted.
+func renderOverlay(a, b mapgen.PackedMap) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, b.Width, b.Height))
+	for i := range b.Data {
+		c := overlayWaterUnchanged
+		if b.IsLand(i) {
+			c = overlayLandUnchanged
+		}
+		switch {
+		case !a.IsLand(i) && b.IsLand(i):
+			c = overlayLandAdded
+		case a.IsLand(i) && !b.IsLand(i):
+			c = overlayLandRemoved
+		case a.IsOcean(i) != b.IsOcean(i):
+			c = overlayOceanChanged
+		case a.IsShoreline(i) != b.IsShoreline(i):
+			c = overlayShoreChanged
+		}
+		img.SetRGBA(i%b.Width, i/b.Width, c)
+	}
+	return img
+}
+
+func printDiff(w io.Writer, label string, a, b mapgen.PackedMap, d MapDiff) {
+	fmt.Fprintf(w, "%s: %dx%d, %d of %d tiles changed\n", label, b.Width, b.Height, d.Changed, d.Tiles)
+	fmt.Fprintf(w, "  num_land_tiles %d -> %d (%+d)\n", a.NumLandTiles, b.NumLandTiles, b.NumLandTiles-a.NumLandTiles)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "  field\tgained\tlost\t\n")
+	fmt.Fprintf(tw, "  land (bit 7)\t%d\t%d\t\n", d.LandAdded, d.LandRemoved)
+	fmt.Fprintf(tw, "  shoreline (bit 6)\t%d\t%d\t\n", d.ShorelineAdded, d.ShorelineLost)
+	fmt.Fprintf(tw, "  ocean (bit 5)\t%d\t%d\t\n", d.OceanAdded, d.OceanLost)
+	tw.Flush()
+	fmt.Fprintf(w, "  magnitude changed on %d tiles\n", d.Magnitude)
+}
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	lod := fs.String("lod", "", "only compare this level of detail: map, map4x or map16x (default: all)")
+	pngDir := fs.String("png", "", "write an overlay PNG per level of detail to this directory")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: map-generator diff [flags] <old map dir> <new map dir>\n\n")
+		fmt.Fprintf(fs.Output(), "Compares two builds of a map and reports changed tiles per bit field.\n")
+		fmt.Fprintf(fs.Output(), "Overlays show added land in green, removed land in red, ocean\n")
+		fmt.Fprintf(fs.Output(), "reclassification in blue and shoreline changes in yellow.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("diff needs exactly two map directories")
+	}
+	oldDir, newDir := fs.Arg(0), fs.Arg(1)
+	lods := lodKeys
+	if *lod != "" {
+		if !slices.Contains(lodKeys, *lod) {
+			return fmt.Errorf("unknown level of detail %q (want one of %v)", *lod, lodKeys)
+		}
+		lods = []string{*lod}
+	}
+
+	for _, l := range lods {
+		a, err := loadPackedMap(oldDir, l)
+		if err != nil {
+			return err
+		}
+		b, err := loadPackedMap(newDir, l)
+		if err != nil {
+			return err
+		}
+		label := l + ".bin"
+		if a.Width != b.Width || a.Height != b.Height {
+			fmt.Printf("%s: dimensions changed from %dx%d to %dx%d, tiles not compared\n",
+				label, a.Width, a.Height, b.Width, b.Height)
+			fmt.Printf("  num_land_tiles %d -> %d (%+d)\n\n", a.NumLandTiles, b.NumLandTiles, b.NumLandTiles-a.NumLandTiles)
+			continue
+		}
+
+		printDiff(os.Stdout, label, a, b, diffPackedMaps(a, b))
+		if *pngDir != "" {
+			if err := os.MkdirAll(*pngDir, 0755); err != nil {
+				return fmt.Errorf("failed to create %s: %w", *pngDir, err)
+			}
+			path := filepath.Join(*pngDir, fmt.Sprintf("%s_%s_diff.png", filepath.Base(filepath.Clean(newDir)), l))
+			if err := writePNG(path, renderOverlay(a, b)); err != nil {
+				return err
+			}
+			fmt.Printf("  overlay: %s\n", path)
+		}
+		fmt.Println()
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestDiffPackedMaps(t *testing.T) {
+	a := testPackedMap(
+		".L,..",
+		"L.L,.",
+	)
+	b := testPackedMap(
+		"L.~,.",
+		"HHL..",
+	)
+
+	want := MapDiff{
+		Tiles:          10,
+		Changed:        7,
+		LandAdded:      2,
+		LandRemoved:    1,
+		ShorelineAdded: 3,
+		ShorelineLost:  2,
+		OceanAdded:     1,
+		OceanLost:      3,
+		Magnitude:      7,
+	}
+	d := diffPackedMaps(a, b)
+	if d != want {
+		t.Errorf("diffPackedMaps = %+v, want %+v", d, want)
+	}
+	if d := diffPackedMaps(a, a); d != (MapDiff{Tiles: 10}) {
+		t.Errorf("diffPackedMaps of a map with itself = %+v, want no changes", d)
+	}
+
+	var out bytes.Buffer
+	printDiff(&out, "map.bin", a, b, d)
+	if !strings.Contains(out.String(), "num_land_tiles 3 -> 4 (+1)") {
+		t.Errorf("printDiff output lacks the num_land_tiles change:\n%s", out.String())
+	}
+
+	// Land changes win over the ocean and shoreline bits they also flip;
+	// magnitude-only changes are not highlighted
+	img := renderOverlay(a, b)
+	for _, tc := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, overlayLandAdded},
+		{1, 1, overlayLandAdded},
+		{1, 0, overlayLandRemoved},
+		{2, 0, overlayOceanChanged},
+		{3, 0, overlayShoreChanged},
+		{3, 1, overlayShoreChanged},
+		{0, 1, overlayLandUnchanged},
+		{2, 1, overlayLandUnchanged},
+		{4, 0, overlayWaterUnchanged},
+		{4, 1, overlayWaterUnchanged},
+	} {
+		if got := img.RGBAAt(tc.x, tc.y); got != tc.want {
+			t.Errorf("overlay at (%d, %d) = %v, want %v", tc.x, tc.y, got, tc.want)
+		}
+	}
+}
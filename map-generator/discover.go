@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// GeneratorOptions are the per-map settings that may be given in info.json:
+//
+//	"generator": { "test_map": true, "remove_small": false }
+//
+// Unset fields fall back to defaults based on where the map was found.
+type GeneratorOptions struct {
+	// TestMap sends the output to the test output directory. Defaults to
+	// true for maps under assets/test_maps.
+	TestMap *bool `json:"test_map"`
+	// RemoveSmall removes small islands and lakes. Defaults to true for
+	// production maps and false for test maps.
+	RemoveSmall *bool `json:"remove_small"`
+}
+
+type MapEntry struct {
+	Name        string
+	Dir         string // source folder holding the source files and info.json
+	IsTest      bool
+	RemoveSmall bool
+	// Image is the color source image in Dir. Maps drawn from a heightmap
+	// have Heightmap and WaterMask instead, and those drawn from an
+	// elevation model DEM.
+	Image, Heightmap, WaterMask, DEM string
+	// LegendFile is the shared legend the map is classified with, empty if
+	// its info.json has a legend or there is no shared legend.
+	LegendFile string
+}
+
+// mapFolder is a folder in the production or test asset directory that
+// holds an info.json.
+type mapFolder struct {
+	Name      string
+	Dir       string
+	InTestDir bool
+	Info      InfoFile
+}
+
+// isTest reports whether the folder's output goes to the test output
+// directory.
+func (f mapFolder) isTest() bool {
+	if opts := f.Info.generatorOptions(); opts.TestMap != nil {
+		return *opts.TestMap
+	}
+	return f.InTestDir
+}
+
+// scanMapFolders returns every folder with an info.json in the production
+// and test asset directories, production folders first, each in name order.
+// A missing asset directory or a folder without an info.json is skipped and
+// reported as a warning; an info.json that can't be parsed is an error.
+func scanMapFolders(paths Paths) ([]mapFolder, []string, error) {
+	var folders []mapFolder
+	var warnings []string
+	for _, inTestDir := range []bool{false, true} {
+		baseDir := paths.inputMapDir(inTestDir)
+		dirEntries, err := os.ReadDir(baseDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				warnings = append(warnings, fmt.Sprintf("asset directory %s does not exist", baseDir))
+				continue
+			}
+			return nil, nil, fmt.Errorf("failed to read asset directory %s: %w", baseDir, err)
+		}
+
+		for _, de := range dirEntries {
+			if !de.IsDir() {
+				continue
+			}
+			name := de.Name()
+			dir := filepath.Join(baseDir, name)
+
+			infoBuffer, err := os.ReadFile(filepath.Join(dir, "info.json"))
+			if os.IsNotExist(err) {
+				warnings = append(warnings, fmt.Sprintf("%s: skipped, no info.json in %s", name, dir))
+				continue
+			} else if err != nil {
+				return nil, nil, fmt.Errorf("failed to read info.json for %s: %w", name, err)
+			}
+			info, err := parseInfoFile(infoBuffer)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid info.json for %s: %w", name, err)
+			}
+			folders = append(folders, mapFolder{Name: name, Dir: dir, InTestDir: inTestDir, Info: info})
+		}
+	}
+	return folders, warnings, nil
+}
+
+// discoverMaps scans the production and test asset folders and returns every
+// folder with an info.json as a map, sorted with production maps first.
+// Folders that cannot be built are skipped and reported as warnings.
+func discoverMaps(paths Paths) ([]MapEntry, []string, error) {
+	folders, warnings, err := scanMapFolders(paths)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []MapEntry
+	seen := make(map[string]string)
+	sharedLegend := filepath.Join(paths.Assets, sharedLegendFile)
+	if _, err := os.Stat(sharedLegend); err != nil {
+		sharedLegend = ""
+	}
+
+	for _, f := range folders {
+		info := f.Info
+		if err := info.Source.check(); err != nil {
+			return nil, nil, fmt.Errorf("invalid info.json for %s: %w", f.Name, err)
+		}
+		entry := MapEntry{Name: f.Name, Dir: f.Dir, IsTest: f.isTest()}
+		skip, err := findSources(&entry, info.Source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid info.json for %s: %w", f.Name, err)
+		}
+		if skip != "" {
+			warnings = append(warnings, fmt.Sprintf("%s: skipped, %s", f.Name, skip))
+			continue
+		}
+
+		if other, ok := seen[f.Name]; ok {
+			return nil, nil, fmt.Errorf("map %s is defined in both %s and %s", f.Name, other, f.Dir)
+		}
+		seen[f.Name] = f.Dir
+
+		// Don't remove small islands for test maps unless asked to
+		entry.RemoveSmall = !entry.IsTest
+		if opts := info.generatorOptions(); opts.RemoveSmall != nil {
+			entry.RemoveSmall = *opts.RemoveSmall
+		}
+		if info.Legend == nil {
+			entry.LegendFile = sharedLegend
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsTest != entries[j].IsTest {
+			return !entries[i].IsTest
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, warnings, nil
+}
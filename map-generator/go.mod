@@ -2,4 +2,9 @@ module map-generator
 
 go 1.24.4
 
-require github.com/chai2010/webp v1.4.0
+require (
+	github.com/chai2010/webp v1.4.0
+	golang.org/x/image v0.36.0
+)
+
+require golang.org/x/sys v0.41.0
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/chai2010/webp"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden from the current generator")
+
+// goldenDir holds the expected output of every test map: the map binaries
+// and manifest as written by the generator, and the thumbnail decoded to PNG
+// so that a change in the WebP encoder alone doesn't fail the test.
+const goldenDir = "testdata/golden"
+
+func testMaps(t *testing.T) []MapEntry {
+	t.Helper()
+	all, _, err := discoverMaps(Paths{Assets: "assets"})
+	if err != nil {
+		t.Fatalf("discoverMaps: %v", err)
+	}
+	maps, err := selectMaps(all, "test", nil)
+	if err != nil {
+		t.Fatalf("selectMaps: %v", err)
+	}
+	return maps
+}
+
+func TestGolden(t *testing.T) {
+	for _, m := range testMaps(t) {
+		t.Run(m.Name, func(t *testing.T) {
+			src, err := readSources(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := renderMap(m, src, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dir := filepath.Join(goldenDir, m.Name)
+			for _, f := range out.Files {
+				name, data := f.Name, f.Data
+				if name == "thumbnail.webp" {
+					name, data = "thumbnail.png", decodeThumbnail(t, f.Data)
+				}
+				path := filepath.Join(dir, name)
+
+				if *update {
+					if err := os.MkdirAll(dir, 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(path, data, 0644); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("%v (run `go test -run TestGolden -update` to create it)", err)
+				}
+				if name == "thumbnail.png" {
+					compareImages(t, path, want, data)
+					continue
+				}
+				if !bytes.Equal(want, data) {
+					detail := "contents differ"
+					if width, ok := lodWidth(out, name); ok {
+						detail = compareTiles(want, data, width)
+					} else if d, err := compareManifests(want, data); err == nil && d != "" {
+						detail = d
+					}
+					t.Errorf("%s: %s", path, detail)
+				}
+			}
+		})
+	}
+}
+
+// TestGoldenStream checks that streaming mode writes the same files and
+// warnings as building in memory.
+func TestGoldenStream(t *testing.T) {
+	for _, m := range testMaps(t) {
+		t.Run(m.Name, func(t *testing.T) {
+			src, err := readSources(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := renderMap(m, src, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mapFile, err := os.Create(filepath.Join(t.TempDir(), "map.bin"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mapFile.Close()
+			got, err := renderMap(m, src, mapFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mapBin, err := os.ReadFile(mapFile.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			files := append([]outputFile{{"map.bin", mapBin}}, got.Files...)
+			if len(files) != len(want.Files) {
+				t.Fatalf("streaming wrote %d files, want %d", len(files), len(want.Files))
+			}
+			for i, f := range want.Files {
+				if files[i].Name != f.Name || !bytes.Equal(files[i].Data, f.Data) {
+					t.Errorf("%s differs when streamed", f.Name)
+				}
+			}
+			if !reflect.DeepEqual(got.Warnings, want.Warnings) {
+				t.Errorf("streamed warnings %q, want %q", got.Warnings, want.Warnings)
+			}
+		})
+	}
+}
+
+// lodWidth returns the width of the level of detail stored in file name.
+func lodWidth(out *mapOutput, name string) (int, bool) {
+	for _, lod := range out.Result.LODs() {
+		if lod.Key+".bin" == name {
+			return lod.Info.Width, true
+		}
+	}
+	return 0, false
+}
+
+// decodeThumbnail decodes a WebP thumbnail and re-encodes it as PNG.
+func decodeThumbnail(t *testing.T, data []byte) []byte {
+	t.Helper()
+	img, err := webp.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to decode thumbnail: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func compareImages(t *testing.T, path string, want, got []byte) {
+	t.Helper()
+	a, err := png.Decode(bytes.NewReader(want))
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	b, err := png.Decode(bytes.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Bounds() != b.Bounds() {
+		t.Errorf("%s: thumbnail is %v, want %v", path, b.Bounds(), a.Bounds())
+		return
+	}
+	differ := 0
+	var first image.Point
+	for y := a.Bounds().Min.Y; y < a.Bounds().Max.Y; y++ {
+		for x := a.Bounds().Min.X; x < a.Bounds().Max.X; x++ {
+			r1, g1, b1, a1 := a.At(x, y).RGBA()
+			r2, g2, b2, a2 := b.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				if differ == 0 {
+					first = image.Pt(x, y)
+				}
+				differ++
+			}
+		}
+	}
+	if differ > 0 {
+		t.Errorf("%s: %d pixels differ, first at %v", path, differ, first)
+	}
+}
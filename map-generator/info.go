@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InfoFile is a map's info.json. The generator, registry, legend and source
+// blocks configure the generator; the rest is copied to manifest.json.
+type InfoFile struct {
+	// Schema lets editors find info.schema.json. It is not copied.
+	Schema    string            `json:"$schema,omitempty"`
+	Name      string            `json:"name" schema:"required"`
+	Nations   *[]Nation         `json:"nations,omitempty"`
+	Registry  *RegistryInfo     `json:"registry,omitempty"`
+	Generator *GeneratorOptions `json:"generator,omitempty"`
+	Legend    *LegendInfo       `json:"legend,omitempty"`
+	Source    *SourceInfo       `json:"source,omitempty"`
+}
+
+// Nation is a nation placed on the map at the start of a game. It matches
+// Nation in src/core/game/TerrainMapLoader.ts; fields are in the order they
+// have always been written to manifest.json.
+type Nation struct {
+	// Coordinates are the x and y of the nation's spawn tile.
+	Coordinates []int    `json:"coordinates" schema:"required"`
+	Flag        string   `json:"flag" schema:"required"`
+	Name        string   `json:"name" schema:"required"`
+	Strength    *float64 `json:"strength,omitempty" schema:"required"`
+}
+
+// MapManifest is the manifest.json written for every map. It matches
+// MapManifest in src/core/game/TerrainMapLoader.ts, plus the source hash of
+// the build cache; fields are in the order they have always been written.
+type MapManifest struct {
+	Map        LODReport `json:"map"`
+	Map16x     LODReport `json:"map16x"`
+	Map4x      LODReport `json:"map4x"`
+	Name       string    `json:"name"`
+	Nations    *[]Nation `json:"nations,omitempty"`
+	SourceHash string    `json:"source_hash"`
+}
+
+// parseInfoFile decodes info.json strictly: syntax errors, unknown fields,
+// including keys that only differ in case, and values of the wrong type are
+// errors that give the line and column.
+func parseInfoFile(data []byte) (InfoFile, error) {
+	var info InfoFile
+	if err := decodeStrict(data, &info); err != nil {
+		return InfoFile{}, err
+	}
+	return info, nil
+}
+
+// decodeStrict decodes data into v like parseInfoFile does.
+func decodeStrict(data []byte, v any) error {
+	if err := json.Unmarshal(data, new(any)); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			// The offset is just past the invalid character, or the end of
+			// the input if it ended early
+			offset := syntaxErr.Offset
+			if offset > 0 && !strings.HasPrefix(err.Error(), "unexpected end") {
+				offset--
+			}
+			line, col := position(data, offset)
+			return fmt.Errorf("%d:%d: %v", line, col, err)
+		}
+		return err
+	}
+	if err := checkFields(data, reflect.TypeOf(v)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// generatorOptions returns the generator block, or no options if it is
+// missing.
+func (info InfoFile) generatorOptions() GeneratorOptions {
+	if info.Generator == nil {
+		return GeneratorOptions{}
+	}
+	return *info.Generator
+}
+
+// position converts a byte offset in data to a 1-based line and column.
+func position(data []byte, offset int64) (line, col int) {
+	offset = min(offset, int64(len(data)))
+	before := data[:offset]
+	line = 1 + bytes.Count(before, []byte("\n"))
+	col = int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// checkFields walks the JSON in data, which must be valid, and rejects
+// object keys that t has no field for and values of the wrong type.
+// encoding/json would ignore unknown keys, or match them ignoring case, and
+// reports type errors at the end of the value.
+func checkFields(data []byte, t reflect.Type) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return fieldChecker{data: data, dec: dec}.value(t, "")
+}
+
+type fieldChecker struct {
+	data []byte
+	dec  *json.Decoder
+}
+
+// next returns the next token and the offset it starts at.
+func (w fieldChecker) next() (json.Token, int64, error) {
+	start := w.dec.InputOffset()
+	tok, err := w.dec.Token()
+	// InputOffset is just past the previous token; skip to this one
+	rest := w.data[start:]
+	start += int64(len(rest) - len(bytes.TrimLeft(rest, " \t\r\n,:")))
+	return tok, start, err
+}
+
+func (w fieldChecker) errorf(offset int64, format string, args ...any) error {
+	line, col := position(w.data, offset)
+	return fmt.Errorf("%d:%d: %s", line, col, fmt.Sprintf(format, args...))
+}
+
+// value checks the next value, which is decoded into t. A nil t accepts
+// anything.
+func (w fieldChecker) value(t reflect.Type, path string) error {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	tok, start, err := w.next()
+	if err != nil {
+		return err
+	}
+	if t != nil && t.Kind() != reflect.Interface && !tokenFits(tok, t) {
+		got := string(bytes.TrimSpace(w.data[start:w.dec.InputOffset()]))
+		switch tok {
+		case json.Delim('{'):
+			got = "an object"
+		case json.Delim('['):
+			got = "an array"
+		}
+		return w.errorf(start, "%s is %s, want %s", path, got, schemaType(t))
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		var fields map[string]reflect.StructField
+		if t != nil && t.Kind() == reflect.Struct {
+			fields = jsonFields(t)
+		}
+		for w.dec.More() {
+			keyTok, start, err := w.next()
+			if err != nil {
+				return err
+			}
+			key := keyTok.(string)
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			var ft reflect.Type
+			if fields != nil {
+				f, ok := fields[key]
+				if !ok {
+					return w.errorf(start, "unknown field %q%s", keyPath, suggestField(key, fields))
+				}
+				ft = f.Type
+			} else if t != nil && t.Kind() == reflect.Map {
+				ft = t.Elem()
+			}
+			if err := w.value(ft, keyPath); err != nil {
+				return err
+			}
+		}
+		_, err := w.dec.Token()
+		return err
+	case json.Delim('['):
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for i := 0; w.dec.More(); i++ {
+			if err := w.value(elem, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		_, err := w.dec.Token()
+		return err
+	}
+	return nil
+}
+
+// tokenFits reports whether a value starting with tok can be decoded into t.
+// null fits anything, as encoding/json leaves the field unset.
+func tokenFits(tok json.Token, t reflect.Type) bool {
+	switch v := tok.(type) {
+	case nil:
+		return true
+	case json.Delim:
+		if v == '{' {
+			return t.Kind() == reflect.Struct || t.Kind() == reflect.Map
+		}
+		return t.Kind() == reflect.Slice || t.Kind() == reflect.Array
+	case bool:
+		return t.Kind() == reflect.Bool
+	case string:
+		return t.Kind() == reflect.String
+	case json.Number:
+		switch jsonType(t) {
+		case "integer":
+			if t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64 {
+				_, err := strconv.ParseUint(v.String(), 10, t.Bits())
+				return err == nil
+			}
+			_, err := strconv.ParseInt(v.String(), 10, t.Bits())
+			return err == nil
+		case "number":
+			return true
+		}
+	}
+	return false
+}
+
+// jsonFields returns the fields of struct type t by JSON name.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// suggestField names the known field closest to a misspelt key, or lists the
+// known fields if none is close.
+func suggestField(key string, fields map[string]reflect.StructField) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	best, bestDist := "", 3
+	for _, name := range names {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(name)); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	if best != "" {
+		return fmt.Sprintf(", did you mean %q?", best)
+	}
+	return fmt.Sprintf(" (known fields: %s)", strings.Join(names, ", "))
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseInfoFile(t *testing.T) {
+	info, err := parseInfoFile([]byte(`{
+  "name": "Test",
+  "nations": [{"coordinates": [1, 2], "flag": "us", "name": "A", "strength": 1.5}],
+  "generator": {"test_map": true}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "Test" || len(*info.Nations) != 1 || *(*info.Nations)[0].Strength != 1.5 || !*info.Generator.TestMap {
+		t.Errorf("parsed %+v", info)
+	}
+
+	for _, tc := range []struct {
+		name, json, want string
+	}{
+		{"misspelt field", "{\n  \"name\": \"Test\",\n  \"nations\": [\n    {\"coordinates\": [1, 2], \"strenght\": 1}\n  ]\n}",
+			`4:29: unknown field "nations[0].strenght", did you mean "strength"?`},
+		{"unknown field", `{"name": "Test", "author": "me"}`,
+			`1:18: unknown field "author" (known fields: $schema, generator, legend, name, nations, registry, source)`},
+		{"different case", `{"Name": "Test"}`,
+			`1:2: unknown field "Name", did you mean "name"?`},
+		{"unknown nested field", `{"generator": {"test_map": true, "remove_smal": false}}`,
+			`1:34: unknown field "generator.remove_smal", did you mean "remove_small"?`},
+		{"wrong type", "{\n  \"nations\": [{\"coordinates\": [1.5, 2]}]\n}",
+			`2:32: nations[0].coordinates[0] is 1.5, want an integer`},
+		{"string for number", `{"nations": [{"strength": "1"}]}`,
+			`1:27: nations[0].strength is "1", want a number`},
+		{"object for array", `{"nations": {}}`, `1:13: nations is an object, want an array`},
+		{"syntax error", "{\n  \"name\": \"Test\",\n}",
+			`3:1: invalid character '}' looking for beginning of object key string`},
+		{"truncated", `{"name": "Test"`, `1:16: unexpected end of JSON input`},
+		{"trailing data", `{"name": "Test"} {}`, `1:18: invalid character '{' after top-level value`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseInfoFile([]byte(tc.json))
+			if err == nil || err.Error() != tc.want {
+				t.Errorf("got error %v\nwant %s", err, tc.want)
+			}
+		})
+	}
+}
+
+// TestAssetInfoFiles checks that every info.json in the assets parses, and
+// that the checked-in schema is up to date.
+func TestAssetInfoFiles(t *testing.T) {
+	paths := Paths{}
+	if err := paths.resolve(); err != nil {
+		t.Skip(err)
+	}
+	files, err := filepath.Glob(filepath.Join(paths.Assets, "*", "*", "info.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no info.json found in %s: %v", paths.Assets, err)
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseInfoFile(data); err != nil {
+			t.Errorf("%s: %v", f, err)
+		}
+	}
+
+	schema, err := os.ReadFile(filepath.Join(paths.Assets, infoSchemaFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameJSON(schema, renderInfoSchema()) {
+		t.Errorf("%s is out of date; run `go run . schema`", infoSchemaFile)
+	}
+	if !strings.Contains(string(schema), `"additionalProperties": false`) {
+		t.Errorf("%s allows unknown fields", infoSchemaFile)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"map-generator/mapgen"
+)
+
+// lodKeys are the manifest keys of the levels of detail, which double as the
+// base names of their .bin files.
+var lodKeys = []string{"map", "map4x", "map16x"}
+
+// loadPackedMap reads <lod>.bin from mapDir, taking its dimensions from the
+// manifest.json next to it.
+func loadPackedMap(mapDir, lod string) (mapgen.PackedMap, error) {
+	manifestPath := filepath.Join(mapDir, "manifest.json")
+	manifestBuffer, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return mapgen.PackedMap{}, fmt.Errorf("failed to read %s: %w", manifestPath, err)
+	}
+	var manifest map[string]json.RawMessage
+	if err := json.Unmarshal(manifestBuffer, &manifest); err != nil {
+		return mapgen.PackedMap{}, fmt.Errorf("failed to parse %s: %w", manifestPath, err)
+	}
+	entry, ok := manifest[lod]
+	if !ok {
+		return mapgen.PackedMap{}, fmt.Errorf("%s has no %q entry", manifestPath, lod)
+	}
+	var dims LODReport
+	if err := json.Unmarshal(entry, &dims); err != nil {
+		return mapgen.PackedMap{}, fmt.Errorf("failed to parse %q in %s: %w", lod, manifestPath, err)
+	}
+
+	binPath := filepath.Join(mapDir, lod+".bin")
+	data, err := os.ReadFile(binPath)
+	if err != nil {
+		return mapgen.PackedMap{}, fmt.Errorf("failed to read %s: %w", binPath, err)
+	}
+	if len(data) != dims.Width*dims.Height {
+		return mapgen.PackedMap{}, fmt.Errorf("%s has %d bytes, manifest says %dx%d = %d",
+			binPath, len(data), dims.Width, dims.Height, dims.Width*dims.Height)
+	}
+	return mapgen.PackedMap{Width: dims.Width, Height: dims.Height, Data: data, NumLandTiles: dims.NumLandTiles}, nil
+}
+
+// countComponents counts the 4-connected regions of tiles matching in, and
+// returns the size of the largest one.
+func countComponents(m mapgen.PackedMap, in func(i int) bool) (count, largest int) {
+	visited := make([]bool, len(m.Data))
+	queue := make([]int, 0, 1024)
+	for start := range m.Data {
+		if visited[start] || !in(start) {
+			continue
+		}
+		count++
+		size := 0
+		visited[start] = true
+		queue = append(queue[:0], start)
+		for head := 0; head < len(queue); head++ {
+			i := queue[head]
+			size++
+			for _, n := range m.Neighbors(i) {
+				if n >= 0 && !visited[n] && in(n) {
+					visited[n] = true
+					queue = append(queue, n)
+				}
+			}
+		}
+		if size > largest {
+			largest = size
+		}
+	}
+	return count, largest
+}
+
+// MapStats summarises the contents of a packed map.
+type MapStats struct {
+	Tiles, Land, Water, Ocean, Lake int
+	LandShoreline, WaterShoreline   int
+	LandMagnitudes                  [32]int
+	WaterMagnitudes                 [32]int
+
+	Islands, LargestIsland    int
+	WaterBodies, LargestWater int
+	Lakes, LargestLake        int
+	OceanBodies, LargestOcean int
+}
+
+func computeStats(m mapgen.PackedMap) MapStats {
+	s := MapStats{Tiles: len(m.Data)}
+	for i := range m.Data {
+		mag := m.Magnitude(i)
+		if m.IsLand(i) {
+			s.Land++
+			s.LandMagnitudes[mag]++
+			if m.IsShoreline(i) {
+				s.LandShoreline++
+			}
+			continue
+		}
+		s.Water++
+		s.WaterMagnitudes[mag]++
+		if m.IsOcean(i) {
+			s.Ocean++
+		} else {
+			s.Lake++
+		}
+		if m.IsShoreline(i) {
+			s.WaterShoreline++
+		}
+	}
+
+	s.Islands, s.LargestIsland = countComponents(m, m.IsLand)
+	s.WaterBodies, s.LargestWater = countComponents(m, func(i int) bool { return !m.IsLand(i) })
+	s.OceanBodies, s.LargestOcean = countComponents(m, func(i int) bool { return !m.IsLand(i) && m.IsOcean(i) })
+	s.Lakes, s.LargestLake = countComponents(m, func(i int) bool { return !m.IsLand(i) && !m.IsOcean(i) })
+	return s
+}
+
+func printStats(w io.Writer, label string, m mapgen.PackedMap, s MapStats) {
+	pct := func(n int) string {
+		if s.Tiles == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f%%", 100*float64(n)/float64(s.Tiles))
+	}
+
+	fmt.Fprintf(w, "%s: %dx%d, %d tiles\n", label, m.Width, m.Height, s.Tiles)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "  land\t%d\t%s\t\n", s.Land, pct(s.Land))
+	fmt.Fprintf(tw, "  water\t%d\t%s\t\n", s.Water, pct(s.Water))
+	fmt.Fprintf(tw, "  ocean\t%d\t%s\t\n", s.Ocean, pct(s.Ocean))
+	fmt.Fprintf(tw, "  lake\t%d\t%s\t\n", s.Lake, pct(s.Lake))
+	fmt.Fprintf(tw, "  land shoreline\t%d\t%s\t\n", s.LandShoreline, pct(s.LandShoreline))
+	fmt.Fprintf(tw, "  water shoreline\t%d\t%s\t\n", s.WaterShoreline, pct(s.WaterShoreline))
+	tw.Flush()
+
+	fmt.Fprintf(w, "  components (count, largest):\n")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "    islands\t%d\t%d\t\n", s.Islands, s.LargestIsland)
+	fmt.Fprintf(tw, "    water bodies\t%d\t%d\t\n", s.WaterBodies, s.LargestWater)
+	fmt.Fprintf(tw, "    ocean\t%d\t%d\t\n", s.OceanBodies, s.LargestOcean)
+	fmt.Fprintf(tw, "    lakes\t%d\t%d\t\n", s.Lakes, s.LargestLake)
+	tw.Flush()
+
+	fmt.Fprintf(w, "  magnitude histogram:\n")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "    magnitude\tland\twater\t\n")
+	for mag := 0; mag < 32; mag++ {
+		if s.LandMagnitudes[mag] == 0 && s.WaterMagnitudes[mag] == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "    %d\t%d\t%d\t\n", mag, s.LandMagnitudes[mag], s.WaterMagnitudes[mag])
+	}
+	tw.Flush()
+}
+
+// renderLayers writes one grayscale PNG per bit field of m into dir.
+func renderLayers(m mapgen.PackedMap, dir, prefix string) ([]string, error) {
+	layers := []struct {
+		name  string
+		value func(i int) uint8
+	}{
+		{"land", func(i int) uint8 { return boolPixel(m.IsLand(i)) }},
+		{"shoreline", func(i int) uint8 { return boolPixel(m.IsShoreline(i)) }},
+		{"ocean", func(i int) uint8 { return boolPixel(m.IsOcean(i)) }},
+		{"magnitude", func(i int) uint8 { return uint8(m.Magnitude(i) * 255 / 31) }},
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	var written []string
+	for _, layer := range layers {
+		img := image.NewGray(image.Rect(0, 0, m.Width, m.Height))
+		for i := range m.Data {
+			img.Pix[i] = layer.value(i)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s_%s.png", prefix, layer.name))
+		if err := writePNG(path, img); err != nil {
+			return nil, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+func boolPixel(b bool) uint8 {
+	if b {
+		return 255
+	}
+	return 0
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// resolveInspectTarget turns a command line argument into a map directory and
+// the LODs to inspect. The argument may be a .bin file, a map output
+// directory or the name of a map in the output directories.
+func resolveInspectTarget(paths Paths, arg, lod string) (string, []string, error) {
+	lods := lodKeys
+	if lod != "" {
+		lods = []string{lod}
+	}
+	if fi, err := os.Stat(arg); err == nil {
+		if !fi.IsDir() {
+			base := strings.TrimSuffix(filepath.Base(arg), ".bin")
+			return filepath.Dir(arg), []string{base}, nil
+		}
+		return arg, lods, nil
+	}
+	if err := paths.resolve(); err != nil {
+		return "", nil, err
+	}
+	for _, isTest := range []bool{false, true} {
+		dir := filepath.Join(paths.outputMapDir(isTest), arg)
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return dir, lods, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%s is not a file, directory or generated map", arg)
+}
+
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	var paths Paths
+	paths.registerFlags(fs)
+	lod := fs.String("lod", "", "only inspect this level of detail: map, map4x or map16x (default: all)")
+	pngDir := fs.String("png", "", "write one PNG per bit field of each level of detail to this directory")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: map-generator inspect [flags] <map.bin|map dir|map name> ...\n\n")
+		fmt.Fprintf(fs.Output(), "Decodes packed map binaries and prints tile counts, magnitude histograms and component counts.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no map given")
+	}
+	if *lod != "" && !slices.Contains(lodKeys, *lod) {
+		return fmt.Errorf("unknown level of detail %q (want one of %v)", *lod, lodKeys)
+	}
+
+	for _, arg := range fs.Args() {
+		mapDir, lods, err := resolveInspectTarget(paths, arg, *lod)
+		if err != nil {
+			return err
+		}
+		name := filepath.Base(mapDir)
+		for _, l := range lods {
+			m, err := loadPackedMap(mapDir, l)
+			if err != nil {
+				return err
+			}
+			printStats(os.Stdout, fmt.Sprintf("%s/%s.bin", name, l), m, computeStats(m))
+			if *pngDir != "" {
+				written, err := renderLayers(m, *pngDir, name+"_"+l)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("  layers: %s\n", strings.Join(written, ", "))
+			}
+			fmt.Println()
+		}
+	}
+	return nil
+}
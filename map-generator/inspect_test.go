@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+
+	"map-generator/mapgen"
+)
+
+// testPackedMap builds a map from rows of tiles: '.' is ocean, ',' ocean
+// shoreline, '~' lake shoreline, 'L' land shoreline of magnitude 5 and 'H'
+// land shoreline of magnitude 20. Open ocean has magnitude 2, ocean
+// shoreline 1.
+func testPackedMap(rows ...string) mapgen.PackedMap {
+	m := mapgen.PackedMap{Width: len(rows[0]), Height: len(rows)}
+	for _, row := range rows {
+		for _, c := range row {
+			var b byte
+			switch c {
+			case '.':
+				b = mapgen.OceanBit | 2
+			case ',':
+				b = mapgen.OceanBit | mapgen.ShorelineBit | 1
+			case '~':
+				b = mapgen.ShorelineBit
+			case 'L':
+				b = mapgen.LandBit | mapgen.ShorelineBit | 5
+			case 'H':
+				b = mapgen.LandBit | mapgen.ShorelineBit | 20
+			}
+			if b&mapgen.LandBit != 0 {
+				m.NumLandTiles++
+			}
+			m.Data = append(m.Data, b)
+		}
+	}
+	return m
+}
+
+func TestComputeStats(t *testing.T) {
+	// An island ringing a lake, and a smaller island to its east
+	m := testPackedMap(
+		".,,,..",
+		",LLH,,",
+		",L~L,H",
+		",LLL,L",
+		".,,,.,",
+	)
+	s := computeStats(m)
+
+	for _, tc := range []struct {
+		name      string
+		got, want int
+	}{
+		{"tiles", s.Tiles, 30},
+		{"land", s.Land, 10},
+		{"water", s.Water, 20},
+		{"ocean", s.Ocean, 19},
+		{"lake", s.Lake, 1},
+		{"land shoreline", s.LandShoreline, 10},
+		{"water shoreline", s.WaterShoreline, 15},
+		{"land magnitude 5", s.LandMagnitudes[5], 8},
+		{"land magnitude 20", s.LandMagnitudes[20], 2},
+		{"water magnitude 0", s.WaterMagnitudes[0], 1},
+		{"water magnitude 1", s.WaterMagnitudes[1], 14},
+		{"water magnitude 2", s.WaterMagnitudes[2], 5},
+		{"islands", s.Islands, 2},
+		{"largest island", s.LargestIsland, 8},
+		{"water bodies", s.WaterBodies, 2},
+		{"largest water body", s.LargestWater, 19},
+		{"ocean bodies", s.OceanBodies, 1},
+		{"largest ocean body", s.LargestOcean, 19},
+		{"lakes", s.Lakes, 1},
+		{"largest lake", s.LargestLake, 1},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %d, want %d", tc.name, tc.got, tc.want)
+		}
+	}
+	var total int
+	for _, n := range s.LandMagnitudes {
+		total += n
+	}
+	for _, n := range s.WaterMagnitudes {
+		total += n
+	}
+	if total != s.Tiles {
+		t.Errorf("magnitude histograms hold %d tiles, want %d", total, s.Tiles)
+	}
+}
+
+func TestCountComponents(t *testing.T) {
+	// Diagonal neighbours are not connected, and regions don't wrap around
+	// the edges
+	m := testPackedMap(
+		"L.L.",
+		".L.L",
+		"LL..",
+	)
+	if count, largest := countComponents(m, m.IsLand); count != 4 || largest != 3 {
+		t.Errorf("countComponents = %d, %d, want 4 regions, the largest of 3", count, largest)
+	}
+	if count, largest := countComponents(m, func(int) bool { return false }); count != 0 || largest != 0 {
+		t.Errorf("countComponents with no tiles = %d, %d, want 0, 0", count, largest)
+	}
+}
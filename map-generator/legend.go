@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image/color"
+	"strings"
+
+	"map-generator/mapgen"
+)
+
+// sharedLegendFile is the legend, in the assets directory, of every map
+// whose info.json has no legend block. Without it maps use
+// mapgen.DefaultLegend.
+const sharedLegendFile = "legend.json"
+
+// legendTerrains and legendChannels are the names LegendEntryInfo accepts.
+var (
+	legendTerrains = []string{"land", "water", "lake"}
+	legendChannels = []string{"red", "green", "blue", "alpha"}
+)
+
+// LegendInfo is the legend block of info.json, or the whole of the shared
+// legend file:
+//
+//	"legend": {
+//	  "entries": [
+//	    { "terrain": "water", "color": "#2a5f8c", "tolerance": 6 },
+//	    { "terrain": "land", "blue": [140, 200], "magnitude_from": "blue" }
+//	  ],
+//	  "unmatched": { "terrain": "land", "magnitude": 0 }
+//	}
+type LegendInfo struct {
+	// Entries are tried in order; the first one a pixel matches wins.
+	Entries []LegendEntryInfo `json:"entries" schema:"required"`
+	// Unmatched classifies pixels that match no entry. Without it they are
+	// classified like the entry nearest to their color.
+	Unmatched *LegendEntryInfo `json:"unmatched,omitempty"`
+}
+
+// LegendEntryInfo matches a color, or a range in each channel, and says
+// what it stands for.
+type LegendEntryInfo struct {
+	// Terrain is land, water, or lake for water that is never ocean.
+	Terrain string `json:"terrain" schema:"required"`
+	// Color is #rrggbb or #rrggbbaa. Pixels match when every channel is
+	// within Tolerance of it; without an alpha any alpha matches.
+	Color     string `json:"color,omitempty"`
+	Tolerance int    `json:"tolerance,omitempty"`
+	// Red, Green, Blue and Alpha limit a channel to an inclusive range.
+	Red   *[2]int `json:"red,omitempty"`
+	Green *[2]int `json:"green,omitempty"`
+	Blue  *[2]int `json:"blue,omitempty"`
+	Alpha *[2]int `json:"alpha,omitempty"`
+	// Magnitude is the elevation of land, 0-31.
+	Magnitude float64 `json:"magnitude,omitempty"`
+	// MagnitudeFrom takes the elevation of land from a channel instead,
+	// scaling MagnitudeRange, which defaults to the range the entry matches
+	// in that channel, to 0-30.
+	MagnitudeFrom  string  `json:"magnitude_from,omitempty"`
+	MagnitudeRange *[2]int `json:"magnitude_range,omitempty"`
+}
+
+// legend converts the legend to the form mapgen uses.
+func (l *LegendInfo) legend() (*mapgen.Legend, error) {
+	legend := &mapgen.Legend{}
+	for i, e := range l.Entries {
+		entry, err := e.entry()
+		if err != nil {
+			return nil, fmt.Errorf("entries[%d]: %w", i, err)
+		}
+		legend.Entries = append(legend.Entries, entry)
+	}
+	if l.Unmatched != nil {
+		if l.Unmatched.Color != "" || l.Unmatched.Red != nil || l.Unmatched.Green != nil ||
+			l.Unmatched.Blue != nil || l.Unmatched.Alpha != nil {
+			return nil, fmt.Errorf("unmatched: must not have a color or channel ranges")
+		}
+		entry, err := l.Unmatched.entry()
+		if err != nil {
+			return nil, fmt.Errorf("unmatched: %w", err)
+		}
+		legend.Unmatched = &entry
+	}
+	if err := legend.Validate(); err != nil {
+		return nil, err
+	}
+	return legend, nil
+}
+
+func (e LegendEntryInfo) entry() (mapgen.LegendEntry, error) {
+	entry := mapgen.LegendEntry{
+		Max:       color.NRGBA{255, 255, 255, 255},
+		Magnitude: e.Magnitude,
+	}
+	switch e.Terrain {
+	case "land":
+		entry.Terrain = mapgen.LegendLand
+	case "water":
+		entry.Terrain = mapgen.LegendWater
+	case "lake":
+		entry.Terrain = mapgen.LegendLake
+	default:
+		return entry, fmt.Errorf("unknown terrain %q (want %s)", e.Terrain, strings.Join(legendTerrains, ", "))
+	}
+
+	// Channels as pointers into Min and Max, in the order of legendChannels
+	mins := [4]*uint8{&entry.Min.R, &entry.Min.G, &entry.Min.B, &entry.Min.A}
+	maxs := [4]*uint8{&entry.Max.R, &entry.Max.G, &entry.Max.B, &entry.Max.A}
+
+	if e.Tolerance < 0 || e.Tolerance > 255 {
+		return entry, fmt.Errorf("tolerance %d is not in 0-255", e.Tolerance)
+	}
+	if e.Color != "" {
+		rgba, err := parseHexColor(e.Color)
+		if err != nil {
+			return entry, err
+		}
+		for i, v := range rgba {
+			*mins[i] = uint8(max(0, int(v)-e.Tolerance))
+			*maxs[i] = uint8(min(255, int(v)+e.Tolerance))
+		}
+	} else if e.Tolerance != 0 {
+		return entry, fmt.Errorf("tolerance needs a color")
+	}
+
+	for i, r := range []*[2]int{e.Red, e.Green, e.Blue, e.Alpha} {
+		if r == nil {
+			continue
+		}
+		if r[0] < 0 || r[1] > 255 || r[0] > r[1] {
+			return entry, fmt.Errorf("%s range %v is not within 0-255", legendChannels[i], *r)
+		}
+		*mins[i] = max(*mins[i], uint8(r[0]))
+		*maxs[i] = min(*maxs[i], uint8(r[1]))
+	}
+
+	if e.MagnitudeFrom == "" {
+		if e.MagnitudeRange != nil {
+			return entry, fmt.Errorf("magnitude_range needs magnitude_from")
+		}
+		return entry, nil
+	}
+	if e.Terrain != "land" {
+		return entry, fmt.Errorf("magnitude_from is only used for land")
+	}
+	for i, name := range legendChannels {
+		if name == e.MagnitudeFrom {
+			entry.MagnitudeChannel = mapgen.ChannelRed + mapgen.Channel(i)
+			entry.MagnitudeRange = [2]uint8{*mins[i], *maxs[i]}
+		}
+	}
+	if entry.MagnitudeChannel == mapgen.ChannelNone {
+		return entry, fmt.Errorf("unknown magnitude_from %q (want %s)", e.MagnitudeFrom, strings.Join(legendChannels, ", "))
+	}
+	if r := e.MagnitudeRange; r != nil {
+		if r[0] < 0 || r[1] > 255 || r[0] >= r[1] {
+			return entry, fmt.Errorf("magnitude_range %v is not an increasing range within 0-255", *r)
+		}
+		entry.MagnitudeRange = [2]uint8{uint8(r[0]), uint8(r[1])}
+	}
+	return entry, nil
+}
+
+// parseHexColor parses #rrggbb or #rrggbbaa into its 3 or 4 channels.
+func parseHexColor(s string) ([]uint8, error) {
+	digits, ok := strings.CutPrefix(s, "#")
+	b, err := hex.DecodeString(digits)
+	if !ok || err != nil || len(b) != 3 && len(b) != 4 {
+		return nil, fmt.Errorf("color %q is not #rrggbb or #rrggbbaa", s)
+	}
+	return b, nil
+}
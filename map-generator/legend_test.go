@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"map-generator/mapgen"
+)
+
+func TestLegendInfo(t *testing.T) {
+	var l LegendInfo
+	if err := json.Unmarshal([]byte(`{
+  "entries": [
+    {"terrain": "water", "color": "#2a5f8c", "tolerance": 6},
+    {"terrain": "lake", "color": "#00ff00ff"},
+    {"terrain": "land", "color": "#ff0000", "tolerance": 255, "red": [200, 255], "blue": [0, 0], "magnitude_from": "green", "magnitude_range": [0, 100]},
+    {"terrain": "land", "blue": [140, 200], "magnitude_from": "blue"}
+  ],
+  "unmatched": {"terrain": "land", "magnitude": 2.5}
+}`), &l); err != nil {
+		t.Fatal(err)
+	}
+	got, err := l.legend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &mapgen.Legend{
+		Entries: []mapgen.LegendEntry{
+			{Terrain: mapgen.LegendWater, Min: color.NRGBA{36, 89, 134, 0}, Max: color.NRGBA{48, 101, 146, 255}},
+			{Terrain: mapgen.LegendLake, Min: color.NRGBA{0, 255, 0, 255}, Max: color.NRGBA{0, 255, 0, 255}},
+			{Terrain: mapgen.LegendLand, Min: color.NRGBA{200, 0, 0, 0}, Max: color.NRGBA{255, 255, 0, 255},
+				MagnitudeChannel: mapgen.ChannelGreen, MagnitudeRange: [2]uint8{0, 100}},
+			{Terrain: mapgen.LegendLand, Min: color.NRGBA{0, 0, 140, 0}, Max: color.NRGBA{255, 255, 200, 255},
+				MagnitudeChannel: mapgen.ChannelBlue, MagnitudeRange: [2]uint8{140, 200}},
+		},
+		Unmatched: &mapgen.LegendEntry{Terrain: mapgen.LegendLand, Max: color.NRGBA{255, 255, 255, 255}, Magnitude: 2.5},
+	}
+	if !equalJSON(t, got, want) {
+		t.Errorf("legend =\n%+v\nwant\n%+v", got, want)
+	}
+
+	for _, tc := range []struct{ json, want string }{
+		{`{"entries": []}`, "legend has no entries"},
+		{`{"entries": [{"terrain": "sea"}]}`, `entries[0]: unknown terrain "sea"`},
+		{`{"entries": [{"terrain": "water", "color": "2a5f8c"}]}`, `entries[0]: color "2a5f8c" is not`},
+		{`{"entries": [{"terrain": "water", "tolerance": 3}]}`, "entries[0]: tolerance needs a color"},
+		{`{"entries": [{"terrain": "water", "red": [10, 300]}]}`, "entries[0]: red range [10 300] is not"},
+		{`{"entries": [{"terrain": "water", "color": "#000000", "red": [10, 20]}]}`, "matches no color"},
+		{`{"entries": [{"terrain": "land", "magnitude_from": "hue"}]}`, `entries[0]: unknown magnitude_from "hue"`},
+		{`{"entries": [{"terrain": "lake", "magnitude_from": "red"}]}`, "entries[0]: magnitude_from is only used for land"},
+		{`{"entries": [{"terrain": "land", "blue": [9, 9], "magnitude_from": "blue"}]}`, "empty magnitude range"},
+		{`{"entries": [{"terrain": "land"}], "unmatched": {"terrain": "land", "color": "#000000"}}`, "unmatched: must not have"},
+	} {
+		var l LegendInfo
+		if err := decodeStrict([]byte(tc.json), &l); err != nil {
+			t.Fatalf("%s: %v", tc.json, err)
+		}
+		if _, err := l.legend(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want %q", tc.json, err, tc.want)
+		}
+	}
+}
+
+func equalJSON(t *testing.T, a, b any) bool {
+	t.Helper()
+	ja, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Equal(ja, jb)
+}
+
+// TestSharedLegend checks that maps without a legend of their own are
+// classified with the shared legend file, which is part of their source
+// hash.
+func TestSharedLegend(t *testing.T) {
+	// Red land on the left, black water on the right; both are land in the
+	// default legend
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			c := color.NRGBA{255, 0, 0, 255}
+			if x >= 4 {
+				c = color.NRGBA{0, 0, 0, 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	var imageBuffer bytes.Buffer
+	if err := png.Encode(&imageBuffer, img); err != nil {
+		t.Fatal(err)
+	}
+	legend := `{"entries": [{"terrain": "land", "color": "#ff0000", "magnitude": 10}, {"terrain": "water", "color": "#000000"}]}`
+
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"assets/" + sharedLegendFile:        legend,
+		"assets/test_maps/shared/image.png": imageBuffer.String(),
+		"assets/test_maps/shared/info.json": `{"name": "Shared"}`,
+		"assets/test_maps/own/image.png":    imageBuffer.String(),
+		"assets/test_maps/own/info.json":    `{"name": "Own", "legend": {"entries": [{"terrain": "land"}]}}`,
+	})
+	maps, _, err := discoverMaps(Paths{Assets: filepath.Join(root, "assets")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	land := make(map[string]int)
+	for _, m := range maps {
+		want := ""
+		if m.Name != "own" {
+			want = filepath.Join(root, "assets", sharedLegendFile)
+		}
+		if m.LegendFile != want {
+			t.Errorf("%s: LegendFile = %q, want %q", m.Name, m.LegendFile, want)
+		}
+		src, err := readSources(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src.Hash() == sourceHash(src.Image, src.Info, nil) && m.LegendFile != "" {
+			t.Errorf("%s: source hash doesn't cover the shared legend", m.Name)
+		}
+		out, err := renderMap(m, src, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		land[m.Name] = out.Result.Map.NumLandTiles
+	}
+	if land["shared"] != 16 || land["own"] != 32 {
+		t.Errorf("land tiles = %v, want 16 with the shared legend and 32 with the map's own", land)
+	}
+}
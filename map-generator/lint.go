@@ -0,0 +1,195 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"map-generator/mapgen"
+)
+
+// hotspotSize is the side of the square blocks unclassified pixels are
+// counted in to locate them.
+const hotspotSize = 64
+
+// hotspot is a block of the image with unclassified pixels.
+type hotspot struct {
+	X, Y  int // top left corner
+	Count int
+}
+
+// unclassifiedHotspots returns the n blocks with the most unclassified
+// pixels, most first.
+func unclassifiedHotspots(u mapgen.Unclassified, n int) []hotspot {
+	counts := make(map[[2]int]int)
+	u.Each(func(x, y int) {
+		counts[[2]int{x / hotspotSize, y / hotspotSize}]++
+	})
+	spots := make([]hotspot, 0, len(counts))
+	for block, count := range counts {
+		spots = append(spots, hotspot{X: block[0] * hotspotSize, Y: block[1] * hotspotSize, Count: count})
+	}
+	sort.Slice(spots, func(i, j int) bool {
+		a, b := spots[i], spots[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		return a.X < b.X
+	})
+	return spots[:min(n, len(spots))]
+}
+
+func formatHotspots(spots []hotspot) string {
+	parts := make([]string, len(spots))
+	for i, s := range spots {
+		parts[i] = fmt.Sprintf("(%d, %d): %d", s.X, s.Y, s.Count)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func unclassifiedPercent(u mapgen.Unclassified) float64 {
+	if u.Width*u.Height == 0 {
+		return 0
+	}
+	return 100 * float64(u.Count) / float64(u.Width*u.Height)
+}
+
+// checkUnclassified fails if more than maxPercent of the pixels are
+// unclassified. A nil maxPercent means no limit.
+func checkUnclassified(u mapgen.Unclassified, maxPercent *float64) error {
+	if maxPercent == nil || unclassifiedPercent(u) <= *maxPercent {
+		return nil
+	}
+	return fmt.Errorf("%d pixels (%.3f%%) match no legend color, more than the maximum of %v%%; "+
+		"run `go run . lint -png <dir>` to see where", u.Count, unclassifiedPercent(u), *maxPercent)
+}
+
+// percentFlag parses a percentage such as 0.5 or 0.5% into *p.
+func percentFlag(p **float64) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || v < 0 || v > 100 {
+			return fmt.Errorf("invalid percentage %q", s)
+		}
+		*p = &v
+		return nil
+	}
+}
+
+// renderUnclassified returns the source image faded to a light gray, with
+// its unclassified pixels in magenta.
+func renderUnclassified(src image.Image, u mapgen.Unclassified) *image.NRGBA {
+	b := src.Bounds()
+	img := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			gray := color.GrayModel.Convert(src.At(b.Min.X+x, b.Min.Y+y)).(color.Gray)
+			v := 160 + gray.Y/3
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	u.Each(func(x, y int) {
+		img.SetNRGBA(x, y, color.NRGBA{255, 0, 255, 255})
+	})
+	return img
+}
+
+// lintMap classifies a map's source image and returns its unclassified
+// pixels along with the decoded image.
+func lintMap(m MapEntry) (mapgen.Unclassified, image.Image, error) {
+	src, err := readSources(m)
+	if err != nil {
+		return mapgen.Unclassified{}, nil, err
+	}
+	info, err := parseInfoFile(src.Info)
+	if err != nil {
+		return mapgen.Unclassified{}, nil, fmt.Errorf("invalid info.json: %w", err)
+	}
+	legend, err := src.legend(info)
+	if err != nil {
+		return mapgen.Unclassified{}, nil, err
+	}
+	if legend == nil {
+		legend = &mapgen.DefaultLegend
+	}
+	img, err := mapgen.Decode(src.Image)
+	if err != nil {
+		return mapgen.Unclassified{}, nil, err
+	}
+	return legend.Classify(img).Unclassified(), img, nil
+}
+
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	var paths Paths
+	paths.registerFlags(fs)
+	set := fs.String("set", "all", "which maps to lint: all, prod or test")
+	pngDir := fs.String("png", "", "write <map>_unclassified.png, highlighting the unclassified pixels, to this directory")
+	var maxPercent *float64
+	fs.Func("max", "fail if more than this percentage of a map's pixels is unclassified, e.g. 0.5 (default: no limit)", percentFlag(&maxPercent))
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: map-generator lint [flags] [map|glob ...]\n\n")
+		fmt.Fprintf(fs.Output(), "Counts and locates the pixels of each source image that match no color of its legend.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := paths.resolve(); err != nil {
+		return err
+	}
+	selected, err := resolveMaps(paths, *set, fs.Args())
+	if err != nil {
+		return err
+	}
+	if *pngDir != "" {
+		if err := os.MkdirAll(*pngDir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", *pngDir, err)
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "MAP\tUNCLASSIFIED\tPERCENT\tWORST %dx%d BLOCKS\n", hotspotSize, hotspotSize)
+	var failed []string
+	for _, m := range selected {
+		if m.Heightmap != "" || m.DEM != "" {
+			// Heightmaps and DEMs have no colors to match
+			kind := "heightmap"
+			if m.DEM != "" {
+				kind = "dem"
+			}
+			fmt.Fprintf(tw, "%s\t-\t-\t%s\n", m.Name, kind)
+			continue
+		}
+		u, img, err := lintMap(m)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.Name, err)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.3f%%\t%s\n", m.Name, u.Count, unclassifiedPercent(u),
+			formatHotspots(unclassifiedHotspots(u, 3)))
+		if err := checkUnclassified(u, maxPercent); err != nil {
+			failed = append(failed, m.Name)
+		}
+		if *pngDir != "" && u.Count > 0 {
+			path := filepath.Join(*pngDir, m.Name+"_unclassified.png")
+			if err := writePNG(path, renderUnclassified(img, u)); err != nil {
+				return err
+			}
+		}
+	}
+	tw.Flush()
+	if len(failed) > 0 {
+		return fmt.Errorf("%d maps have more than %v%% unclassified pixels: %s",
+			len(failed), *maxPercent, strings.Join(failed, ", "))
+	}
+	return nil
+}
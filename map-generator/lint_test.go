@@ -0,0 +1,65 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+
+	"map-generator/mapgen"
+)
+
+func TestLintUnclassified(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			c := color.NRGBA{B: 150, A: 255}
+			switch {
+			case x >= 130 && x < 140 && y < 10:
+				c.B = 120 // 100 pixels
+			case x == 10 && y >= 70:
+				c.B = 210 // 30 pixels
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	u := mapgen.Classify(img).Unclassified()
+	if u.Count != 130 {
+		t.Fatalf("Count = %d, want 130", u.Count)
+	}
+
+	want := []hotspot{{X: 128, Y: 0, Count: 100}, {X: 0, Y: 64, Count: 30}}
+	if got := unclassifiedHotspots(u, 5); !reflect.DeepEqual(got, want) {
+		t.Errorf("hotspots = %v, want %v", got, want)
+	}
+	if got := unclassifiedHotspots(u, 1); len(got) != 1 || got[0] != want[0] {
+		t.Errorf("worst hotspot = %v, want %v", got, want[0])
+	}
+
+	var limit *float64
+	if err := checkUnclassified(u, limit); err != nil {
+		t.Errorf("no limit: %v", err)
+	}
+	if err := percentFlag(&limit)("0.65%"); err != nil || *limit != 0.65 {
+		t.Fatalf("percentFlag = %v, %v", limit, err)
+	}
+	if err := checkUnclassified(u, limit); err != nil {
+		t.Errorf("0.65%% of pixels at a limit of 0.65%%: %v", err)
+	}
+	*limit = 0.5
+	if err := checkUnclassified(u, limit); err == nil || !strings.Contains(err.Error(), "130 pixels (0.650%)") {
+		t.Errorf("0.65%% of pixels at a limit of 0.5%%: %v", err)
+	}
+	if err := percentFlag(&limit)("120"); err == nil {
+		t.Error("percentFlag accepted 120")
+	}
+
+	highlight := renderUnclassified(img, u)
+	if c := highlight.NRGBAAt(135, 5); c != (color.NRGBA{255, 0, 255, 255}) {
+		t.Errorf("unclassified pixel rendered as %v", c)
+	}
+	if c := highlight.NRGBAAt(0, 0); c.R != c.G || c.G != c.B || c.R < 160 {
+		t.Errorf("classified pixel rendered as %v, want a light gray", c)
+	}
+}
@@ -0,0 +1,46 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockFile is a file that exists while the lock is held. Unlike the unix
+// lock it outlives a crashed process, and has to be removed by hand then.
+type lockFile struct {
+	path string
+}
+
+// lockTimeout is how long acquireLock waits for another run.
+const lockTimeout = 10 * time.Minute
+
+// acquireLock creates the file at path, calling wait first and then polling
+// if another process holds it.
+func acquireLock(path string, wait func()) (*lockFile, error) {
+	deadline := time.Now().Add(lockTimeout)
+	for waited := false; ; waited = true {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			f.Close()
+			return &lockFile{path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s still exists after %v; remove it if no other run is active", path, lockTimeout)
+		}
+		if !waited {
+			wait()
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func (l *lockFile) release() {
+	os.Remove(l.path)
+}
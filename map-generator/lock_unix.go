@@ -0,0 +1,38 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile is an flock(2) lock, which the kernel releases if the process
+// dies.
+type lockFile struct {
+	f *os.File
+}
+
+// acquireLock locks the file at path, calling wait first if another process
+// holds it.
+func acquireLock(path string, wait func()) (*lockFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	fd := int(f.Fd())
+	if err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB); err == syscall.EWOULDBLOCK {
+		wait()
+		err = syscall.Flock(fd, syscall.LOCK_EX)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &lockFile{f}, nil
+}
+
+func (l *lockFile) release() {
+	syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	l.f.Close()
+}
@@ -1,196 +1,305 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
-	"sync"
+	"runtime"
+	"sort"
+	"strings"
 )
 
-var maps = []struct {
-	Name   string
-	IsTest bool
-}{
-	{Name: "africa"},
-	{Name: "asia"},
-	{Name: "australia"},
-	{Name: "baikal"},
-	{Name: "betweentwoseas"},
-	{Name: "blacksea"},
-	{Name: "britannia"},
-	{Name: "deglaciatedantarctica"},
-	{Name: "eastasia"},
-	{Name: "europe"},
-	{Name: "europeclassic"},
-	{Name: "falklandislands"},
-	{Name: "faroeislands"},
-	{Name: "gatewaytotheatlantic"},
-	{Name: "giantworldmap"},
-	{Name: "halkidiki"},
-	{Name: "iceland"},
-	{Name: "italia"},
-	{Name: "japan"},
-	{Name: "mars"},
-	{Name: "mena"},
-	{Name: "montreal"},
-	{Name: "northamerica"},
-	{Name: "oceania"},
-	{Name: "pangaea"},
-	{Name: "pluto"},
-	{Name: "southamerica"},
-	{Name: "straitofgibraltar"},
-	{Name: "world"},
-	{Name: "yenisei"},
-	{Name: "big_plains", IsTest: true},
-	{Name: "half_land_half_ocean", IsTest: true},
-	{Name: "ocean_and_land", IsTest: true},
-	{Name: "plains", IsTest: true},
+// Paths holds the input and output roots used by every command. Empty fields
+// are filled in by resolve relative to the repository root.
+type Paths struct {
+	Root    string
+	Assets  string
+	Out     string
+	TestOut string
 }
 
-func outputMapDir(isTest bool) (string, error) {
-	cwd, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("failed to get working directory: %w", err)
+func (p *Paths) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&p.Root, "root", "", "repository root (default: found by walking up from the working directory)")
+	fs.StringVar(&p.Assets, "assets", "", "assets directory containing maps/ and test_maps/ (default: <root>/map-generator/assets)")
+	fs.StringVar(&p.Out, "out", "", "output directory for production maps (default: <root>/resources/maps)")
+	fs.StringVar(&p.TestOut, "test-out", "", "output directory for test maps (default: <root>/tests/testdata/maps)")
+}
+
+func (p *Paths) resolve() error {
+	if p.Assets != "" && p.Out != "" && p.TestOut != "" {
+		return nil
+	}
+	if p.Root == "" {
+		root, err := findRepoRoot()
+		if err != nil {
+			return err
+		}
+		p.Root = root
 	}
+	if p.Assets == "" {
+		p.Assets = filepath.Join(p.Root, "map-generator", "assets")
+	}
+	if p.Out == "" {
+		p.Out = filepath.Join(p.Root, "resources", "maps")
+	}
+	if p.TestOut == "" {
+		p.TestOut = filepath.Join(p.Root, "tests", "testdata", "maps")
+	}
+	return nil
+}
+
+func (p Paths) inputMapDir(isTest bool) string {
 	if isTest {
-		return filepath.Join(cwd, "..", "tests", "testdata", "maps"), nil
+		return filepath.Join(p.Assets, "test_maps")
 	}
-	return filepath.Join(cwd, "..", "resources", "maps"), nil
+	return filepath.Join(p.Assets, "maps")
 }
 
-func inputMapDir(isTest bool) (string, error) {
+func (p Paths) outputMapDir(isTest bool) string {
+	if isTest {
+		return p.TestOut
+	}
+	return p.Out
+}
+
+// findRepoRoot walks up from the working directory until it finds the
+// directory that contains map-generator/assets.
+func findRepoRoot() (string, error) {
 	cwd, err := os.Getwd()
 	if err != nil {
 		return "", fmt.Errorf("failed to get working directory: %w", err)
 	}
-	if isTest {
-		return filepath.Join(cwd, "assets", "test_maps"), nil 
-	} else {
-		return filepath.Join(cwd, "assets", "maps"), nil 
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		info, err := os.Stat(filepath.Join(dir, "map-generator", "assets"))
+		if err == nil && info.IsDir() {
+			return dir, nil
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
 	}
+	return "", fmt.Errorf("could not find repository root from %s; use -root or -assets/-out/-test-out", cwd)
 }
 
-
-func processMap(name string, isTest bool) error {
-	outputMapBaseDir, err := outputMapDir(isTest)
-	if err != nil {
-		return fmt.Errorf("failed to get map directory: %w", err)
+// selectMaps returns the maps in set whose name matches any of the patterns.
+// Patterns use path.Match syntax; no patterns selects every map in the set.
+func selectMaps(all []MapEntry, set string, patterns []string) ([]MapEntry, error) {
+	var candidates []MapEntry
+	for _, m := range all {
+		switch set {
+		case "all":
+		case "prod":
+			if m.IsTest {
+				continue
+			}
+		case "test":
+			if !m.IsTest {
+				continue
+			}
+		default:
+			return nil, fmt.Errorf("unknown map set %q (want all, prod or test)", set)
+		}
+		candidates = append(candidates, m)
 	}
-
-	inputMapDir, err := inputMapDir(isTest)
-	if err != nil {
-		return fmt.Errorf("failed to get input map directory: %w", err)
+	if len(patterns) == 0 {
+		return candidates, nil
 	}
 
-	inputPath := filepath.Join(inputMapDir, name, "image.png")
-	imageBuffer, err := os.ReadFile(inputPath)
-	if err != nil {
-		return fmt.Errorf("failed to read map file %s: %w", inputPath, err)
+	var selected []MapEntry
+	seen := make(map[MapEntry]bool)
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid map pattern %q: %w", pattern, err)
+		}
+		matched := false
+		for _, m := range candidates {
+			if ok, _ := path.Match(pattern, m.Name); !ok {
+				continue
+			}
+			matched = true
+			if !seen[m] {
+				seen[m] = true
+				selected = append(selected, m)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no map in set %q matches %q", set, pattern)
+		}
 	}
+	return selected, nil
+}
 
-	// Read the info.json file
-	manifestPath := filepath.Join(inputMapDir, name, "info.json")
-	manifestBuffer, err := os.ReadFile(manifestPath)
+// resolveMaps discovers the maps under paths, logs any folders that were
+// skipped and returns the ones selected by set and patterns.
+func resolveMaps(paths Paths, set string, patterns []string) ([]MapEntry, error) {
+	all, warnings, err := discoverMaps(paths)
 	if err != nil {
-		return fmt.Errorf("failed to read info file %s: %w", manifestPath, err)
+		return nil, err
 	}
-
-	// Parse the info buffer as dynamic JSON
-	var manifest map[string]interface{}
-	if err := json.Unmarshal(manifestBuffer, &manifest); err != nil {
-		return fmt.Errorf("failed to parse info.json for %s: %w", name, err)
+	for _, w := range warnings {
+		slog.Warn(w)
 	}
+	return selectMaps(all, set, patterns)
+}
 
-	// Generate maps
-	result, err := GenerateMap(GeneratorArgs{
-		ImageBuffer: imageBuffer,
-		RemoveSmall: !isTest, // Don't remove small islands for test maps
-		Name:        name,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to generate map for %s: %w", name, err)
+func runGenerate(args []string) (err error) {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	var paths Paths
+	paths.registerFlags(fs)
+	var logOpts logOptions
+	logOpts.registerFlags(fs)
+	var profiles profileOptions
+	profiles.registerFlags(fs)
+	set := fs.String("set", "all", "which maps to consider: all, prod or test")
+	var opts BuildOptions
+	fs.BoolVar(&opts.Force, "force", false, "rebuild maps even if their output is up to date")
+	fs.IntVar(&opts.Jobs, "jobs", runtime.NumCPU(), "number of maps to build concurrently")
+	fs.BoolVar(&opts.Stream, "stream", false, "build every map in streaming mode, as maps over 4M pixels are (slower, uses less memory)")
+	var budget byteSize
+	fs.Var(&budget, "mem-budget", "approximate memory limit for concurrent builds, e.g. 2GiB (default: no limit)")
+	reportPath := fs.String("report", "", "also write the build report as JSON to this file, e.g. build-report.json")
+	fs.Func("max-unclassified", "fail maps where more than this percentage of the pixels match no legend color, e.g. 0.5 (default: no limit)",
+		percentFlag(&opts.MaxUnclassified))
+	prune := fs.Bool("prune", false, "after a successful build, remove outputs in -set that no map owns (see the prune command)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: map-generator generate [flags] [map|glob ...]\n\n")
+		fmt.Fprintf(fs.Output(), "Generates the selected maps, or every map in -set when none are given.\n\nFlags:\n")
+		fs.PrintDefaults()
 	}
+	fs.Parse(args)
 
-	manifest["map"] = map[string]interface{}{
-		"width": result.Map.Width,
-		"height": result.Map.Height,
-		"num_land_tiles": result.Map.NumLandTiles,
-	}	
-	manifest["map4x"] = map[string]interface{}{
-		"width": result.Map4x.Width,
-		"height": result.Map4x.Height,
-		"num_land_tiles": result.Map4x.NumLandTiles,
+	if err := logOpts.setup(); err != nil {
+		return err
 	}
-	manifest["map16x"] = map[string]interface{}{
-		"width": result.Map16x.Width,
-		"height": result.Map16x.Height,
-		"num_land_tiles": result.Map16x.NumLandTiles,
-	}
-
-	mapDir := filepath.Join(outputMapBaseDir, name)
-	if err := os.MkdirAll(mapDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory for %s: %w", name, err)
+	if err := paths.resolve(); err != nil {
+		return err
 	}
-	if err := os.WriteFile(filepath.Join(mapDir, "map.bin"), result.Map.Data, 0644); err != nil {
-		return fmt.Errorf("failed to write combined binary for %s: %w", name, err)
+	stopProfiles, err := profiles.start()
+	if err != nil {
+		return err
 	}
-	if err := os.WriteFile(filepath.Join(mapDir, "map4x.bin"), result.Map4x.Data, 0644); err != nil {
-		return fmt.Errorf("failed to write combined binary for %s: %w", name, err)
+	defer func() {
+		if stopErr := stopProfiles(); err == nil {
+			err = stopErr
+		}
+	}()
+	opts.MemoryBudget = uint64(budget)
+	selected, err := resolveMaps(paths, *set, fs.Args())
+	if err != nil {
+		return err
 	}
-	if err := os.WriteFile(filepath.Join(mapDir, "map16x.bin"), result.Map16x.Data, 0644); err != nil {
-		return fmt.Errorf("failed to write combined binary for %s: %w", name, err)
+	var outputDirs []string
+	for _, m := range selected {
+		outputDirs = append(outputDirs, paths.outputMapDir(m.IsTest))
 	}
-	if err := os.WriteFile(filepath.Join(mapDir, "thumbnail.webp"), result.Thumbnail, 0644); err != nil {
-		return fmt.Errorf("failed to write thumbnail for %s: %w", name, err)
+	var pruned []string
+	if *prune {
+		if pruned, err = pruneDirs(paths, *set); err != nil {
+			return err
+		}
+		outputDirs = append(outputDirs, pruned...)
 	}
-	
-	// Serialize the updated manifest to JSON
-	updatedManifest, err := json.MarshalIndent(manifest, "", "  ")
+	lock, err := lockDirs(outputDirs)
 	if err != nil {
-		return fmt.Errorf("failed to serialize manifest for %s: %w", name, err)
+		return err
 	}
-	
-	if err := os.WriteFile(filepath.Join(mapDir, "manifest.json"), updatedManifest, 0644); err != nil {
-		return fmt.Errorf("failed to write manifest for %s: %w", name, err)
+	defer lock.unlock()
+
+	report := loadTerrainMaps(paths, selected, opts)
+	report.PrintSummary(os.Stdout)
+	if *reportPath != "" {
+		if err := report.WriteFile(*reportPath); err != nil {
+			return err
+		}
+	}
+	if err := report.Err(); err != nil {
+		return err
+	}
+	if *prune {
+		// A failed build leaves every output as it was, orphans included
+		fmt.Println()
+		if _, err := pruneOutputs(paths, pruned, false); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func loadTerrainMaps() error {
-	var wg sync.WaitGroup
-	errChan := make(chan error, len(maps))
-
-	// Process maps concurrently
-	for _, mapItem := range maps {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if err := processMap(mapItem.Name, mapItem.IsTest); err != nil {
-				errChan <- err
-			}
-		}()
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var paths Paths
+	paths.registerFlags(fs)
+	set := fs.String("set", "all", "which maps to list: all, prod or test")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: map-generator list [flags] [map|glob ...]\n\nFlags:\n")
+		fs.PrintDefaults()
 	}
+	fs.Parse(args)
 
-	// Wait for all goroutines to complete
-	wg.Wait()
-	close(errChan)
-
-	// Check for errors
-	for err := range errChan {
-		if err != nil {
-			return err
+	if err := paths.resolve(); err != nil {
+		return err
+	}
+	selected, err := resolveMaps(paths, *set, fs.Args())
+	if err != nil {
+		return err
+	}
+	for _, m := range selected {
+		kind := "prod"
+		if m.IsTest {
+			kind = "test"
 		}
+		fmt.Printf("%-24s %-5s %s\n", m.Name, kind, m.Dir)
 	}
-
 	return nil
 }
 
+var commands = map[string]struct {
+	summary string
+	run     func(args []string) error
+}{
+	"diff":     {"compare two builds of a map", runDiff},
+	"generate": {"generate map binaries, thumbnails and manifests (default)", runGenerate},
+	"inspect":  {"decode map binaries into stats and layer images", runInspect},
+	"lint":     {"find source pixels that match no legend color", runLint},
+	"list":     {"list the maps a selection resolves to", runList},
+	"prune":    {"remove output directories and files that no map owns", runPrune},
+	"registry": {"generate the TypeScript map registry from info.json", runRegistry},
+	"schema":   {"write the JSON Schema of info.json for editors", runSchema},
+	"verify":   {"check that committed output matches the current assets", runVerify},
+	"watch":    {"rebuild maps as their assets change", runWatch},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: map-generator [command] [flags] [map|glob ...]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun \"map-generator <command> -h\" for the flags of a command.\n")
+}
+
 func main() {
-	if err := loadTerrainMaps(); err != nil {
-		log.Fatalf("Error generating terrain maps: %v", err)
+	args := os.Args[1:]
+	name := "generate"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if args[0] == "help" {
+			usage()
+			return
+		}
+		if _, ok := commands[args[0]]; ok {
+			name, args = args[0], args[1:]
+		}
+	}
+
+	if err := commands[name].run(args); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
 	}
-	
-	fmt.Println("Terrain maps generated successfully")
-}
\ No newline at end of file
+}
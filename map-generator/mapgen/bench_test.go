@@ -0,0 +1,83 @@
+package mapgen
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// benchmarkMaps are synthetic maps of islands in an ocean, which exercise
+// every stage. Run with -benchmem to see allocations.
+var benchmarkMaps = []struct {
+	name          string
+	width, height int
+}{
+	{"512x512", 512, 512},
+	{"2048x1024", 2048, 1024},
+}
+
+func benchmarkImage(b *testing.B, width, height int) []byte {
+	b.Helper()
+	return encodePNG(b, randomMap(rand.New(rand.NewSource(1)), width, height))
+}
+
+func BenchmarkGenerateMap(b *testing.B) {
+	for _, bm := range benchmarkMaps {
+		b.Run(bm.name, func(b *testing.B) {
+			data := benchmarkImage(b, bm.width, bm.height)
+			b.SetBytes(int64(bm.width * bm.height))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := GenerateMap(GeneratorArgs{ImageBuffer: data, RemoveSmall: true}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkStage times fn on a freshly classified grid for every benchmark map.
+func benchmarkStage(b *testing.B, fn func(g *Grid)) {
+	for _, bm := range benchmarkMaps {
+		b.Run(bm.name, func(b *testing.B) {
+			img, err := Decode(benchmarkImage(b, bm.width, bm.height))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(bm.width * bm.height))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				g := Classify(img)
+				b.StartTimer()
+				fn(g)
+			}
+		})
+	}
+}
+
+func BenchmarkRemoveSmallIslands(b *testing.B) {
+	benchmarkStage(b, func(g *Grid) { RemoveSmallIslands(g, true) })
+}
+
+func BenchmarkProcessWater(b *testing.B) {
+	benchmarkStage(b, func(g *Grid) { ProcessWater(g, true) })
+}
+
+func BenchmarkCreateMiniMap(b *testing.B) {
+	benchmarkStage(b, func(g *Grid) { CreateMiniMap(CreateMiniMap(g)) })
+}
+
+func BenchmarkPackTerrain(b *testing.B) {
+	benchmarkStage(b, func(g *Grid) { PackTerrain(g) })
+}
+
+func BenchmarkLabelComponents(b *testing.B) {
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("%d workers", workers), func(b *testing.B) {
+			benchmarkStage(b, func(g *Grid) {
+				g.labelComponents(splitRows(g.Height, workers, minStripRows))
+			})
+		})
+	}
+}
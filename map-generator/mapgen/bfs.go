@@ -0,0 +1,62 @@
+package mapgen
+
+// bitset is a fixed-size set of tile indices.
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) has(i int) bool { return b[i>>6]&(1<<(uint(i)&63)) != 0 }
+func (b bitset) add(i int)      { b[i>>6] |= 1 << (uint(i) & 63) }
+
+// queue is a FIFO of tile indices backed by a ring buffer that grows as
+// needed, so a breadth-first search reuses the same memory throughout.
+type queue struct {
+	buf        []int32
+	head, size int
+}
+
+func newQueue(capacity int) *queue {
+	if capacity < 16 {
+		capacity = 16
+	}
+	return &queue{buf: make([]int32, capacity)}
+}
+
+func (q *queue) len() int { return q.size }
+
+func (q *queue) push(i int) {
+	if q.size == len(q.buf) {
+		grown := make([]int32, 2*len(q.buf))
+		n := copy(grown, q.buf[q.head:])
+		copy(grown[n:], q.buf[:q.head])
+		q.buf, q.head = grown, 0
+	}
+	q.buf[(q.head+q.size)%len(q.buf)] = int32(i)
+	q.size++
+}
+
+func (q *queue) pop() int {
+	i := q.buf[q.head]
+	q.head = (q.head + 1) % len(q.buf)
+	q.size--
+	return int(i)
+}
+
+// neighbors calls fn for each of the up to four tiles next to i.
+func (g *Grid) neighbors(i int, fn func(n int)) {
+	x := i % g.Width
+	if x > 0 {
+		fn(i - 1)
+	}
+	if x < g.Width-1 {
+		fn(i + 1)
+	}
+	if i >= g.Width {
+		fn(i - g.Width)
+	}
+	if i < len(g.tiles)-g.Width {
+		fn(i + g.Width)
+	}
+}
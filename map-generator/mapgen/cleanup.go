@@ -0,0 +1,24 @@
+package mapgen
+
+// RemoveSmallIslands turns land bodies smaller than MinIslandSize into water
+// and returns how many it removed. It does nothing unless removeSmall is set.
+func RemoveSmallIslands(terrain *Grid, removeSmall bool) (removed int) {
+	if !removeSmall {
+		return 0
+	}
+
+	components, update := terrain.findComponents()
+
+	smallIslands := 0
+	small := make([]bool, len(components))
+	for id, body := range components {
+		if body.land && body.size < MinIslandSize {
+			smallIslands++
+			small[id] = true
+		}
+	}
+	if smallIslands > 0 {
+		update(small, func(t *tile, _ int32) { *t = tile{} })
+	}
+	return smallIslands
+}
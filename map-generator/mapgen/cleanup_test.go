@@ -0,0 +1,69 @@
+package mapgen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRemoveSmallIslands(t *testing.T) {
+	// A 6x5 island is exactly MinIslandSize tiles, a 5x5 one is one short
+	island := func(w, h int) []string {
+		rows := []string{strings.Repeat(".", w+2)}
+		for y := 0; y < h; y++ {
+			rows = append(rows, "."+strings.Repeat("#", w)+".")
+		}
+		return append(rows, strings.Repeat(".", w+2))
+	}
+
+	tests := []struct {
+		name        string
+		rows        []string
+		removeSmall bool
+		wantLand    int
+	}{
+		{"disabled", island(2, 2), false, 4},
+		{"single tile", island(1, 1), true, 0},
+		{"one below minimum", island(5, 5), true, 0},
+		{"minimum size", island(6, 5), true, 30},
+		{"diagonal tiles are separate islands", []string{
+			"#.",
+			".#",
+		}, true, 0},
+		{"all land", []string{
+			strings.Repeat("#", 8),
+			strings.Repeat("#", 8),
+			strings.Repeat("#", 8),
+			strings.Repeat("#", 8),
+		}, true, 32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gridFromRows(tt.rows...)
+			RemoveSmallIslands(g, tt.removeSmall)
+			if land := g.CountLand(); land != tt.wantLand {
+				t.Errorf("%d land tiles left, want %d:\n%s", land, tt.wantLand, strings.Join(rowsFromGrid(g), "\n"))
+			}
+		})
+	}
+}
+
+func TestRemoveSmallIslandsFixtures(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantLand int
+	}{
+		{"plains", 10000},
+		{"half_land_half_ocean", 128},
+		// The 6 tiles of small islands are removed, the 128 tile continent stays
+		{"ocean_and_land", 128},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := classifyFixture(t, tt.name)
+			RemoveSmallIslands(g, true)
+			if land := g.CountLand(); land != tt.wantLand {
+				t.Errorf("%d land tiles left, want %d", land, tt.wantLand)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package mapgen
+
+import "fmt"
+
+// CombinedBinaryHeader describes the sections of the legacy single-file map
+// format. The game no longer loads it.
+type CombinedBinaryHeader struct {
+	Version       uint32
+	InfoOffset    uint32
+	InfoSize      uint32
+	MapOffset     uint32
+	MapSize       uint32
+	MiniMapOffset uint32
+	MiniMapSize   uint32
+}
+
+func CreateCombinedBinary(infoBuffer []byte, mapData []byte, miniMapData []byte) []byte {
+	// Calculate section sizes
+	infoSize := len(infoBuffer)
+	mapSize := len(mapData)
+	miniMapSize := len(miniMapData)
+
+	// Header structure:
+	// Bytes 0-3: Version (1)
+	// Bytes 4-7: Info section offset (always 28)
+	// Bytes 8-11: Info section size
+	// Bytes 12-15: Map section offset
+	// Bytes 16-19: Map section size
+	// Bytes 20-23: MiniMap section offset
+	// Bytes 24-27: MiniMap section size
+
+	headerSize := 28
+	infoOffset := headerSize
+	mapOffset := infoOffset + infoSize
+	miniMapOffset := mapOffset + mapSize
+
+	totalSize := miniMapOffset + miniMapSize
+	combined := make([]byte, totalSize)
+
+	// Write version
+	writeUint32(combined, 0, 1)
+
+	// Write info section info
+	writeUint32(combined, 4, uint32(infoOffset))
+	writeUint32(combined, 8, uint32(infoSize))
+
+	// Write map section info
+	writeUint32(combined, 12, uint32(mapOffset))
+	writeUint32(combined, 16, uint32(mapSize))
+
+	// Write miniMap section info
+	writeUint32(combined, 20, uint32(miniMapOffset))
+	writeUint32(combined, 24, uint32(miniMapSize))
+
+	// Copy data sections
+	copy(combined[infoOffset:], infoBuffer)
+	copy(combined[mapOffset:], mapData)
+	copy(combined[miniMapOffset:], miniMapData)
+
+	return combined
+}
+
+func writeUint32(data []byte, offset int, value uint32) {
+	data[offset] = byte(value & 0xff)
+	data[offset+1] = byte((value >> 8) & 0xff)
+	data[offset+2] = byte((value >> 16) & 0xff)
+	data[offset+3] = byte((value >> 24) & 0xff)
+}
+
+func readUint32(data []byte, offset int) uint32 {
+	return uint32(data[offset]) | uint32(data[offset+1])<<8 | uint32(data[offset+2])<<16 | uint32(data[offset+3])<<24
+}
+
+func DecodeCombinedBinary(data []byte) (*CombinedBinaryHeader, []byte, []byte, []byte, error) {
+	if len(data) < 28 {
+		return nil, nil, nil, nil, fmt.Errorf("data too short for header")
+	}
+
+	header := &CombinedBinaryHeader{
+		Version:       readUint32(data, 0),
+		InfoOffset:    readUint32(data, 4),
+		InfoSize:      readUint32(data, 8),
+		MapOffset:     readUint32(data, 12),
+		MapSize:       readUint32(data, 16),
+		MiniMapOffset: readUint32(data, 20),
+		MiniMapSize:   readUint32(data, 24),
+	}
+
+	// Validate offsets and sizes
+	if header.InfoOffset+header.InfoSize > uint32(len(data)) ||
+		header.MapOffset+header.MapSize > uint32(len(data)) ||
+		header.MiniMapOffset+header.MiniMapSize > uint32(len(data)) {
+		return nil, nil, nil, nil, fmt.Errorf("invalid offsets or sizes in header")
+	}
+
+	// Extract sections
+	infoData := data[header.InfoOffset : header.InfoOffset+header.InfoSize]
+	mapData := data[header.MapOffset : header.MapOffset+header.MapSize]
+	miniMapData := data[header.MiniMapOffset : header.MiniMapOffset+header.MiniMapSize]
+
+	return header, infoData, mapData, miniMapData, nil
+}
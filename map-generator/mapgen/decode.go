@@ -0,0 +1,200 @@
+package mapgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png"
+	"math/bits"
+	"strings"
+
+	_ "github.com/chai2010/webp"
+	_ "golang.org/x/image/tiff"
+)
+
+// Decode decodes a source image: PNG, WebP or TIFF.
+func Decode(imageBuffer []byte) (image.Image, error) {
+	img, format, err := image.Decode(bytes.NewReader(imageBuffer))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, errors.New("failed to decode image: not a PNG, WebP or TIFF file")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", strings.ToUpper(format), err)
+	}
+	if rgba, ok := img.(*image.RGBA); ok && format == "webp" {
+		// libwebp decodes to colors without premultiplied alpha, which the
+		// webp package returns as an *image.RGBA all the same
+		img = &image.NRGBA{Pix: rgba.Pix, Stride: rgba.Stride, Rect: rgba.Rect}
+	}
+	return img, nil
+}
+
+// isPNG reports whether data starts with the PNG signature.
+func isPNG(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(pngSignature))
+}
+
+// Classify turns each pixel of img into a land or water tile using
+// DefaultLegend: transparent pixels and pixels with a blue value of 106 are
+// water; any other pixel is land with a magnitude taken from its blue value
+// in the 140-200 range. The grid is cropped so both dimensions are multiples
+// of 4, as required by the mini map downscaling.
+func Classify(img image.Image) *Grid {
+	return DefaultLegend.Classify(img)
+}
+
+// Classify is Classify with the colors of legend l.
+func (l *Legend) Classify(img image.Image) *Grid {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Ensure width and height are multiples of 4 for the mini map downscaling
+	width = width - (width % 4)
+	height = height - (height % 4)
+
+	terrain := NewGrid(width, height)
+	terrain.classifyRows(img, l, 0, height)
+	return terrain
+}
+
+// classifyRows classifies rows [0, n) of img into the grid rows starting at
+// y0.
+func (g *Grid) classifyRows(img image.Image, l *Legend, y0, n int) {
+	at := nrgbaReader(img)
+	var last color.NRGBA
+	lastTile, lastMatched := l.classify(last)
+	for y := 0; y < n; y++ {
+		i0 := (y0 + y) * g.Width
+		row := g.tiles[i0 : i0+g.Width]
+		for x := range row {
+			c := at(x, y)
+			// Neighbouring pixels mostly have the same color
+			if c != last {
+				last = c
+				lastTile, lastMatched = l.classify(c)
+			}
+			row[x] = lastTile
+			if !lastMatched {
+				if g.unclassified == nil {
+					g.unclassified = newBitset(len(g.tiles))
+				}
+				g.unclassified.add(i0 + x)
+				g.numUnclassified++
+			}
+		}
+	}
+}
+
+// nrgbaReader returns a function reading the pixel of img at x, y, counted
+// from the top left of its bounds, as a non-premultiplied 8-bit color, the
+// form legends are written in. The image types the PNG decoder returns are
+// read directly; any other goes through toNRGBA.
+func nrgbaReader(img image.Image) func(x, y int) color.NRGBA {
+	b := img.Bounds()
+	switch img := img.(type) {
+	case *image.NRGBA:
+		return func(x, y int) color.NRGBA {
+			i := img.PixOffset(b.Min.X+x, b.Min.Y+y)
+			s := img.Pix[i : i+4 : i+4]
+			return color.NRGBA{s[0], s[1], s[2], s[3]}
+		}
+	case *image.RGBA:
+		return func(x, y int) color.NRGBA {
+			i := img.PixOffset(b.Min.X+x, b.Min.Y+y)
+			s := img.Pix[i : i+4 : i+4]
+			if s[3] == 0xff {
+				return color.NRGBA{s[0], s[1], s[2], 0xff}
+			}
+			return toNRGBA(color.RGBA{s[0], s[1], s[2], s[3]})
+		}
+	case *image.NRGBA64:
+		// Big-endian, so the high byte of each channel comes first
+		return func(x, y int) color.NRGBA {
+			i := img.PixOffset(b.Min.X+x, b.Min.Y+y)
+			s := img.Pix[i : i+8 : i+8]
+			return color.NRGBA{s[0], s[2], s[4], s[6]}
+		}
+	case *image.Gray:
+		return func(x, y int) color.NRGBA {
+			v := img.Pix[img.PixOffset(b.Min.X+x, b.Min.Y+y)]
+			return color.NRGBA{v, v, v, 0xff}
+		}
+	case *image.Gray16:
+		return func(x, y int) color.NRGBA {
+			v := img.Pix[img.PixOffset(b.Min.X+x, b.Min.Y+y)]
+			return color.NRGBA{v, v, v, 0xff}
+		}
+	case *image.Paletted:
+		palette := make([]color.NRGBA, len(img.Palette))
+		for i, c := range img.Palette {
+			palette[i] = toNRGBA(c)
+		}
+		return func(x, y int) color.NRGBA {
+			i := img.Pix[img.PixOffset(b.Min.X+x, b.Min.Y+y)]
+			if int(i) >= len(palette) {
+				// Out of range indices are transparent, as in browsers
+				return color.NRGBA{}
+			}
+			return palette[i]
+		}
+	}
+	return func(x, y int) color.NRGBA {
+		return toNRGBA(img.At(b.Min.X+x, b.Min.Y+y))
+	}
+}
+
+// toNRGBA converts c to a non-premultiplied 8-bit color. The high bytes of
+// the premultiplied values c.RGBA returns would make semi-transparent pixels
+// darker, so they are divided by alpha first.
+func toNRGBA(c color.Color) color.NRGBA {
+	switch c := c.(type) {
+	case color.NRGBA:
+		return c
+	case color.NRGBA64:
+		return color.NRGBA{uint8(c.R >> 8), uint8(c.G >> 8), uint8(c.B >> 8), uint8(c.A >> 8)}
+	}
+	r, g, b, a := c.RGBA()
+	switch a {
+	case 0:
+		return color.NRGBA{}
+	case 0xffff:
+		return color.NRGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 0xff}
+	}
+	r = r * 0xffff / a
+	g = g * 0xffff / a
+	b = b * 0xffff / a
+	return color.NRGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+}
+
+// Unclassified records the source pixels that no entry of the legend
+// matched. They are usually anti-aliasing or compression artifacts, and get
+// the terrain of the legend's Unmatched entry or of the nearest entry.
+type Unclassified struct {
+	Width, Height int
+	// Count is the number of unclassified pixels.
+	Count int
+	bits  bitset
+}
+
+// Has reports whether the pixel at x, y is unclassified.
+func (u Unclassified) Has(x, y int) bool {
+	return u.bits != nil && u.bits.has(y*u.Width+x)
+}
+
+// Unclassified returns the pixels of the source image the legend didn't
+// match, within the cropped grid.
+func (g *Grid) Unclassified() Unclassified {
+	return Unclassified{Width: g.Width, Height: g.Height, Count: g.numUnclassified, bits: g.unclassified}
+}
+
+// Each calls fn with every unclassified pixel, row by row.
+func (u Unclassified) Each(fn func(x, y int)) {
+	for w, word := range u.bits {
+		for word != 0 {
+			i := w*64 + bits.TrailingZeros64(word)
+			fn(i%u.Width, i/u.Width)
+			word &= word - 1
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package mapgen
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+
+	"github.com/chai2010/webp"
+	"golang.org/x/image/tiff"
+)
+
+func TestDecode(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			img, err := Decode(readFixture(t, f.name))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != f.width || b.Dy() != f.height {
+				t.Errorf("decoded %dx%d, want %dx%d", b.Dx(), b.Dy(), f.width, f.height)
+			}
+		})
+	}
+
+	if _, err := Decode([]byte("not a png")); err == nil {
+		t.Error("Decode succeeded on invalid input")
+	}
+}
+
+// TestDecodeFormats checks that WebP and TIFF sources classify like the same
+// image as a PNG.
+func TestDecodeFormats(t *testing.T) {
+	src := encodings(rand.New(rand.NewSource(7)), 40, 24)["nrgba"]
+	want := Classify(src)
+
+	// webp.Encode premultiplies the colors of an *image.NRGBA, but writes
+	// those of an *image.RGBA as they are, as libwebp expects them
+	nrgba := src.(*image.NRGBA)
+	straight := &image.RGBA{Pix: nrgba.Pix, Stride: nrgba.Stride, Rect: nrgba.Rect}
+	var webpData, tiffData bytes.Buffer
+	if err := webp.Encode(&webpData, straight, &webp.Options{Lossless: true, Exact: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tiff.Encode(&tiffData, src, &tiff.Options{Compression: tiff.Deflate}); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"png": encodePNG(t, src), "webp": webpData.Bytes(), "tiff": tiffData.Bytes(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			img, err := Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sameGrid(t, want, Classify(img))
+
+			// Streaming falls back to decoding the image whole
+			result, err := GenerateMap(GeneratorArgs{ImageBuffer: data, Stream: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Map.Width != 40 || result.Map.Height != 24 {
+				t.Errorf("streamed map is %dx%d, want 40x24", result.Map.Width, result.Map.Height)
+			}
+		})
+	}
+}
+
+func TestClassifyFixtures(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			g := classifyFixture(t, f.name)
+			if g.Width != f.width || g.Height != f.height {
+				t.Errorf("grid is %dx%d, want %dx%d", g.Width, g.Height, f.width, f.height)
+			}
+			if land := g.CountLand(); land != f.land {
+				t.Errorf("CountLand() = %d, want %d", land, f.land)
+			}
+		})
+	}
+}
+
+func TestClassifyPixel(t *testing.T) {
+	tests := []struct {
+		name      string
+		c         color.NRGBA
+		want      TerrainType
+		magnitude float64
+	}{
+		{"transparent", color.NRGBA{B: 180, A: 0}, Water, 0},
+		{"nearly transparent", color.NRGBA{B: 180, A: 19}, Water, 0},
+		{"water blue", color.NRGBA{R: 70, G: 132, B: 106, A: 255}, Water, 0},
+		{"plains", color.NRGBA{R: 190, G: 220, B: 140, A: 255}, Land, 0},
+		{"below plains", color.NRGBA{B: 100, A: 255}, Land, 0},
+		{"highlands", color.NRGBA{B: 170, A: 255}, Land, 15},
+		{"odd blue", color.NRGBA{B: 171, A: 255}, Land, 15.5},
+		{"mountains", color.NRGBA{B: 200, A: 255}, Land, 30},
+		{"above mountains", color.NRGBA{B: 255, A: 255}, Land, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+			img.SetNRGBA(0, 0, tt.c)
+			got := Classify(img).At(0, 0)
+			if got.Type != tt.want || got.Magnitude != tt.magnitude {
+				t.Errorf("Classify(%v) = type %d magnitude %v, want type %d magnitude %v",
+					tt.c, got.Type, got.Magnitude, tt.want, tt.magnitude)
+			}
+		})
+	}
+}
+
+func TestClassifyCrops(t *testing.T) {
+	tests := []struct {
+		width, height         int
+		wantWidth, wantHeight int
+	}{
+		{4, 4, 4, 4},
+		{10, 7, 8, 4},
+		{3, 9, 0, 8},
+	}
+	for _, tt := range tests {
+		g := Classify(image.NewNRGBA(image.Rect(0, 0, tt.width, tt.height)))
+		if g.Width != tt.wantWidth || g.Height != tt.wantHeight {
+			t.Errorf("%dx%d image classified as %dx%d, want %dx%d",
+				tt.width, tt.height, g.Width, g.Height, tt.wantWidth, tt.wantHeight)
+		}
+	}
+}
+
+// TestClassifyColorModels checks that every image type is read as 8-bit
+// colors without premultiplied alpha, counted from the top left of its
+// bounds.
+func TestClassifyColorModels(t *testing.T) {
+	bounds := image.Rect(-3, 5, 5, 9)
+	// Semi-transparent highlands, water, a transparent pixel and mountains on
+	// land of magnitude 5
+	background := color.NRGBA{B: 150, A: 255}
+	colors := []color.NRGBA{{60, 80, 170, 51}, {0, 0, 106, 255}, {B: 200}, {0, 0, 200, 255}}
+	want := []Terrain{{Type: Land, Magnitude: 15}, {Type: Water}, {Type: Water}, {Type: Land, Magnitude: 30}}
+	// Gray has no alpha, and 16-bit gray is rounded down to its high byte
+	grays := []uint16{170<<8 | 0xff, 106<<8 | 0x80, 140 << 8, 200<<8 | 0x01}
+	wantGray := []Terrain{{Type: Land, Magnitude: 15}, {Type: Water}, {Type: Land}, {Type: Land, Magnitude: 30}}
+
+	paletted := image.NewPaletted(bounds, color.Palette{background, colors[0], colors[1], colors[2], colors[3]})
+	tests := []struct {
+		name string
+		img  draw.Image
+		want []Terrain
+	}{
+		{"nrgba", image.NewNRGBA(bounds), want},
+		{"rgba", image.NewRGBA(bounds), want},
+		{"nrgba64", image.NewNRGBA64(bounds), want},
+		{"rgba64", image.NewRGBA64(bounds), want},
+		{"paletted", paletted, want},
+		{"gray", image.NewGray(bounds), wantGray},
+		{"gray16", image.NewGray16(bounds), wantGray},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := func(x, y int, c color.NRGBA, gray uint16) {
+				switch img := tt.img.(type) {
+				case *image.Gray:
+					img.SetGray(x, y, color.Gray{uint8(gray >> 8)})
+				case *image.Gray16:
+					img.SetGray16(x, y, color.Gray16{gray})
+				default:
+					img.Set(x, y, c)
+				}
+			}
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					set(x, y, background, 150<<8)
+				}
+			}
+			for i := range colors {
+				set(bounds.Min.X+2*i, bounds.Min.Y+1, colors[i], grays[i])
+			}
+
+			g := Classify(tt.img)
+			if g.Width != 8 || g.Height != 4 {
+				t.Fatalf("grid is %dx%d, want 8x4", g.Width, g.Height)
+			}
+			for i, w := range tt.want {
+				got := g.At(2*i, 1)
+				if got.Type != w.Type || got.Magnitude != w.Magnitude {
+					t.Errorf("pixel %d = type %d magnitude %v, want type %d magnitude %v",
+						i, got.Type, got.Magnitude, w.Type, w.Magnitude)
+				}
+			}
+			if got := g.At(1, 1); got.Type != Land || got.Magnitude != 5 {
+				t.Errorf("background = type %d magnitude %v, want land 5", got.Type, got.Magnitude)
+			}
+		})
+	}
+}
+
+func TestToNRGBA(t *testing.T) {
+	for _, tc := range []struct {
+		c    color.Color
+		want color.NRGBA
+	}{
+		{color.NRGBA{1, 2, 3, 4}, color.NRGBA{1, 2, 3, 4}},
+		{color.RGBA{12, 16, 34, 51}, color.NRGBA{60, 80, 170, 51}},
+		{color.RGBA{}, color.NRGBA{}},
+		{color.NRGBA64{0x12ff, 0x3400, 0xaa80, 0x8001}, color.NRGBA{0x12, 0x34, 0xaa, 0x80}},
+		{color.RGBA64{0x3000, 0x3000, 0x3000, 0x8000}, color.NRGBA{0x5f, 0x5f, 0x5f, 0x80}},
+		{color.Gray16{0xaa99}, color.NRGBA{0xaa, 0xaa, 0xaa, 0xff}},
+		{color.Alpha{0x80}, color.NRGBA{0xff, 0xff, 0xff, 0x80}},
+	} {
+		if got := toNRGBA(tc.c); got != tc.want {
+			t.Errorf("toNRGBA(%#v) = %v, want %v", tc.c, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package mapgen
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultDEMCurve maps elevations in meters to land magnitudes the way the
+// game tells terrain apart: plains (below 10) up to 500 m, highlands (10-19)
+// up to 1500 m and mountains above, reaching 30 at 4000 m.
+var DefaultDEMCurve = HeightCurve{{0, 0}, {500, 10}, {1500, 20}, {4000, 30}}
+
+// maxDEMPixels caps the size of a DEM, whose elevations take 4 bytes per
+// cell.
+const maxDEMPixels = 1 << 31
+
+// checkDEMSize rejects DEMs without cells or too large to decode.
+func checkDEMSize(width, height int) error {
+	if width <= 0 || height <= 0 || int64(width)*int64(height) > maxDEMPixels {
+		return fmt.Errorf("invalid size %dx%d", width, height)
+	}
+	return nil
+}
+
+// DecodeDEM reads a digital elevation model: a single-band GeoTIFF, such as
+// an SRTM tile, or an ESRI ASCII grid. Elevations are kept in the units of
+// the file, usually meters, and cells without data are NaN. The
+// georeferencing is ignored; the raster is used as it is laid out.
+func DecodeDEM(data []byte) (*Heightmap, error) {
+	if isTIFF(data) {
+		t, err := readGeoTIFF(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode GeoTIFF: %w", err)
+		}
+		h, err := t.decode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode GeoTIFF: %w", err)
+		}
+		return h, nil
+	}
+	h, err := decodeASCIIGrid(bytes.NewReader(data), true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ASCII grid: %w", err)
+	}
+	return h, nil
+}
+
+// DecodeDEMConfig returns the size of a DEM without reading its elevations.
+// GeoTIFFs are read in place if r is an io.ReaderAt, such as an *os.File.
+func DecodeDEMConfig(r io.Reader) (width, height int, err error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	if !isTIFF(magic) {
+		h, err := decodeASCIIGrid(br, false)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to decode ASCII grid: %w", err)
+		}
+		return h.Width, h.Height, nil
+	}
+
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return 0, 0, err
+		}
+		ra = bytes.NewReader(data)
+	}
+	t, err := readGeoTIFF(ra, -1)
+	if err == nil {
+		width, height, err = t.imageSize()
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to decode GeoTIFF: %w", err)
+	}
+	return width, height, nil
+}
+
+// decodeASCIIGrid reads an ESRI ASCII grid: a header of ncols, nrows, the
+// position and size of the cells and an optional NODATA_value, followed by
+// the elevations row by row from the north. Without values it only reads
+// the header and returns a heightmap with no elevations.
+func decodeASCIIGrid(r io.Reader, values bool) (*Heightmap, error) {
+	s := bufio.NewScanner(r)
+	s.Split(bufio.ScanWords)
+	next := func() (string, bool) {
+		if !s.Scan() {
+			return "", false
+		}
+		return s.Text(), true
+	}
+
+	header := make(map[string]string)
+	var first string
+	for {
+		key, ok := next()
+		if !ok {
+			if err := s.Err(); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("no values after the header")
+		}
+		// The header ends at the first value
+		if c := key[0]; c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			first = key
+			break
+		}
+		value, ok := next()
+		if !ok {
+			return nil, fmt.Errorf("header %s has no value", key)
+		}
+		header[strings.ToLower(key)] = value
+	}
+
+	size := func(key string) (int, error) {
+		v, err := strconv.Atoi(header[key])
+		if err != nil || v <= 0 {
+			return 0, fmt.Errorf("invalid or missing %s %q", key, header[key])
+		}
+		return v, nil
+	}
+	width, err := size("ncols")
+	if err != nil {
+		return nil, err
+	}
+	height, err := size("nrows")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDEMSize(width, height); err != nil {
+		return nil, err
+	}
+	if !values {
+		return &Heightmap{Width: width, Height: height}, nil
+	}
+	noData := math.NaN()
+	if v, ok := header["nodata_value"]; ok {
+		if noData, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, fmt.Errorf("invalid NODATA_value %q", v)
+		}
+	}
+
+	h := NewHeightmap(width, height)
+	for i := range h.Elevation {
+		token := first
+		if i > 0 {
+			var ok bool
+			if token, ok = next(); !ok {
+				if err := s.Err(); err != nil {
+					return nil, err
+				}
+				return nil, fmt.Errorf("%d values, want %d for %dx%d cells", i, len(h.Elevation), width, height)
+			}
+		}
+		v, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q in row %d", token, i/width+1)
+		}
+		if v == noData {
+			v = math.NaN()
+		}
+		h.Elevation[i] = float32(v)
+	}
+	if _, extra := next(); extra {
+		return nil, fmt.Errorf("more than %d values for %dx%d cells", len(h.Elevation), width, height)
+	}
+	return h, nil
+}
+
+// SetSeaLevel marks the pixels at or below level, and those without an
+// elevation, as water.
+func (h *Heightmap) SetSeaLevel(level float64) {
+	h.Water = make([]bool, len(h.Elevation))
+	for i, e := range h.Elevation {
+		h.Water[i] = !(float64(e) > level)
+	}
+}
+
+// ResampleSize returns the size closest to tiles pixels with the aspect
+// ratio of width x height, rounded to multiples of 4 and at least 4x4.
+func ResampleSize(width, height, tiles int) (int, int) {
+	scale := math.Sqrt(float64(tiles) / (float64(width) * float64(height)))
+	round := func(n int) int {
+		return max(4, int(math.Round(float64(n)*scale/4))*4)
+	}
+	return round(width), round(height)
+}
+
+// Resample scales the heightmap to width x height, averaging the pixels
+// each new pixel covers by their overlap. A new pixel is water if most of
+// what it covers is water or has no elevation, and otherwise takes the
+// average elevation of the land it covers, so that the sea doesn't pull
+// coasts down.
+func (h *Heightmap) Resample(width, height int) *Heightmap {
+	columns := resampleSpans(h.Width, width)
+	rows := resampleSpans(h.Height, height)
+	out := NewHeightmap(width, height)
+	out.Water = make([]bool, width*height)
+	for y, row := range rows {
+		for x, column := range columns {
+			var land, water, sum float64
+			for j, wy := range row.weights {
+				i := (row.first+j)*h.Width + column.first
+				for k, wx := range column.weights {
+					w := wy * wx
+					e := h.Elevation[i+k]
+					if e != e || h.Water != nil && h.Water[i+k] {
+						water += w
+					} else {
+						land += w
+						sum += w * float64(e)
+					}
+				}
+			}
+			if water > land {
+				out.Water[y*width+x] = true
+			} else {
+				out.Elevation[y*width+x] = float32(sum / land)
+			}
+		}
+	}
+	return out
+}
+
+// resampleSpan is the run of source pixels a resampled pixel covers, and
+// how much of each it covers.
+type resampleSpan struct {
+	first   int
+	weights []float64
+}
+
+// resampleSpans returns the spans n pixels cover when they are stretched
+// over src pixels.
+func resampleSpans(src, n int) []resampleSpan {
+	spans := make([]resampleSpan, n)
+	scale := float64(src) / float64(n)
+	for i := range spans {
+		lo, hi := float64(i)*scale, float64(i+1)*scale
+		first := int(lo)
+		last := min(int(math.Ceil(hi)), src)
+		spans[i].first = first
+		for j := first; j < last; j++ {
+			spans[i].weights = append(spans[i].weights, math.Min(hi, float64(j+1))-math.Max(lo, float64(j)))
+		}
+	}
+	return spans
+}
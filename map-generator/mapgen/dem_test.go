@@ -0,0 +1,433 @@
+package mapgen
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testTIFF describes a single-band TIFF for encodeTestTIFF.
+type testTIFF struct {
+	order interface {
+		binary.ByteOrder
+		binary.AppendByteOrder
+	}
+	width, height        int
+	bitDepth, format     int
+	blockW, blockH       int // tiles if blockW is set, strips of blockH rows otherwise
+	compression          int
+	predictor            int
+	noData               string
+	samplesPerPixelCount int
+}
+
+// encodeTestTIFF writes samples, row by row, as a TIFF.
+func encodeTestTIFF(t testing.TB, f testTIFF, samples []float64) []byte {
+	t.Helper()
+	sampleBytes := f.bitDepth / 8
+	put := func(b []byte, v float64) {
+		switch {
+		case f.format == 3 && f.bitDepth == 32:
+			f.order.PutUint32(b, math.Float32bits(float32(v)))
+		case f.format == 3 && f.bitDepth == 64:
+			f.order.PutUint64(b, math.Float64bits(v))
+		case sampleBytes == 1:
+			b[0] = byte(int64(v))
+		case sampleBytes == 2:
+			f.order.PutUint16(b, uint16(int64(v)))
+		default:
+			f.order.PutUint32(b, uint32(int64(v)))
+		}
+	}
+
+	tiled := f.blockW > 0
+	blockW, blockH := f.blockW, f.blockH
+	if !tiled {
+		blockW = f.width
+	}
+	across := (f.width + blockW - 1) / blockW
+	down := (f.height + blockH - 1) / blockH
+	var blocks [][]byte
+	for by := 0; by < down; by++ {
+		for bx := 0; bx < across; bx++ {
+			rows := blockH
+			if !tiled {
+				rows = min(rows, f.height-by*blockH)
+			}
+			rowBytes := blockW * sampleBytes
+			block := make([]byte, rows*rowBytes)
+			for y := 0; y < rows; y++ {
+				row := block[y*rowBytes : (y+1)*rowBytes]
+				for x := 0; x < blockW; x++ {
+					px, py := bx*blockW+x, by*blockH+y
+					if px < f.width && py < f.height {
+						put(row[x*sampleBytes:], samples[py*f.width+px])
+					}
+				}
+				switch f.predictor {
+				case 2:
+					for i := len(row)/sampleBytes - 1; i > 0; i-- {
+						switch sampleBytes {
+						case 1:
+							row[i] -= row[i-1]
+						case 2:
+							f.order.PutUint16(row[2*i:], f.order.Uint16(row[2*i:])-f.order.Uint16(row[2*i-2:]))
+						}
+					}
+				case 3:
+					n := blockW
+					planes := make([]byte, len(row))
+					for i := 0; i < n; i++ {
+						sample := row[i*sampleBytes : (i+1)*sampleBytes]
+						if f.order == binary.LittleEndian {
+							sample = append([]byte(nil), sample...)
+							for a, b := 0, len(sample)-1; a < b; a, b = a+1, b-1 {
+								sample[a], sample[b] = sample[b], sample[a]
+							}
+						}
+						for b := range sample {
+							planes[b*n+i] = sample[b]
+						}
+					}
+					for i := len(planes) - 1; i > 0; i-- {
+						planes[i] -= planes[i-1]
+					}
+					copy(row, planes)
+				}
+			}
+			blocks = append(blocks, compressTestBlock(t, f.compression, block))
+		}
+	}
+
+	// Header, then the blocks, then the directory
+	var buf bytes.Buffer
+	if f.order == binary.LittleEndian {
+		buf.WriteString("II*\x00")
+	} else {
+		buf.WriteString("MM\x00*")
+	}
+	buf.Write(make([]byte, 4))
+	var offsets, counts []uint32
+	for _, b := range blocks {
+		offsets = append(offsets, uint32(buf.Len()))
+		counts = append(counts, uint32(len(b)))
+		buf.Write(b)
+	}
+
+	type entry struct {
+		tag, typ uint16
+		values   []uint32
+		ascii    string
+	}
+	spp := max(f.samplesPerPixelCount, 1)
+	entries := []entry{
+		{tag: tiffImageWidth, typ: 4, values: []uint32{uint32(f.width)}},
+		{tag: tiffImageLength, typ: 4, values: []uint32{uint32(f.height)}},
+		{tag: tiffBitsPerSample, typ: 3, values: []uint32{uint32(f.bitDepth)}},
+		{tag: tiffCompression, typ: 3, values: []uint32{uint32(max(f.compression, 1))}},
+		{tag: tiffSamplesPerPixel, typ: 3, values: []uint32{uint32(spp)}},
+		{tag: tiffPredictor, typ: 3, values: []uint32{uint32(max(f.predictor, 1))}},
+		{tag: tiffSampleFormat, typ: 3, values: []uint32{uint32(f.format)}},
+	}
+	if tiled {
+		entries = append(entries,
+			entry{tag: tiffTileWidth, typ: 3, values: []uint32{uint32(blockW)}},
+			entry{tag: tiffTileLength, typ: 3, values: []uint32{uint32(blockH)}},
+			entry{tag: tiffTileOffsets, typ: 4, values: offsets},
+			entry{tag: tiffTileByteCounts, typ: 4, values: counts})
+	} else {
+		entries = append(entries,
+			entry{tag: tiffRowsPerStrip, typ: 3, values: []uint32{uint32(blockH)}},
+			entry{tag: tiffStripOffsets, typ: 4, values: offsets},
+			entry{tag: tiffStripByteCounts, typ: 4, values: counts})
+	}
+	if f.noData != "" {
+		entries = append(entries, entry{tag: tiffGDALNoData, typ: 2, ascii: f.noData + "\x00"})
+	}
+
+	// Values that don't fit in an entry go before the directory
+	var values [][]byte
+	for _, e := range entries {
+		var v []byte
+		if e.typ == 2 {
+			v = []byte(e.ascii)
+		} else {
+			for _, n := range e.values {
+				if e.typ == 3 {
+					v = f.order.AppendUint16(v, uint16(n))
+				} else {
+					v = f.order.AppendUint32(v, n)
+				}
+			}
+		}
+		values = append(values, v)
+	}
+	ifd := buf.Len()
+	for _, v := range values {
+		if len(v) > 4 {
+			ifd += len(v)
+		}
+	}
+	var directory []byte
+	directory = f.order.AppendUint16(directory, uint16(len(entries)))
+	for i, e := range entries {
+		directory = f.order.AppendUint16(directory, e.tag)
+		directory = f.order.AppendUint16(directory, e.typ)
+		count := len(e.values)
+		if e.typ == 2 {
+			count = len(e.ascii)
+		}
+		directory = f.order.AppendUint32(directory, uint32(count))
+		if v := values[i]; len(v) > 4 {
+			directory = f.order.AppendUint32(directory, uint32(buf.Len()))
+			buf.Write(v)
+		} else {
+			directory = append(directory, append(v, make([]byte, 4-len(v))...)...)
+		}
+	}
+	directory = f.order.AppendUint32(directory, 0)
+	data := append(buf.Bytes(), directory...)
+	f.order.PutUint32(data[4:], uint32(ifd))
+	return data
+}
+
+// compressTestBlock compresses a strip or tile. LZW data only holds
+// literals, with a clear code often enough that codes stay 9 bits wide.
+func compressTestBlock(t testing.TB, compression int, block []byte) []byte {
+	switch compression {
+	case 0, 1, 7:
+		// JPEG is only there to be rejected
+		return block
+	case 8:
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(block)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	case 5:
+		var out []byte
+		var bits uint32
+		var n uint
+		emit := func(code uint32) {
+			bits = bits<<9 | code
+			n += 9
+			for n >= 8 {
+				out = append(out, byte(bits>>(n-8)))
+				n -= 8
+			}
+		}
+		for i, b := range block {
+			if i%200 == 0 {
+				emit(256)
+			}
+			emit(uint32(b))
+		}
+		emit(257)
+		if n > 0 {
+			out = append(out, byte(bits<<(8-n)))
+		}
+		return out
+	}
+	t.Fatalf("unknown compression %d", compression)
+	return nil
+}
+
+func sameElevations(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && !(a[i] != a[i] && b[i] != b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDecodeGeoTIFF(t *testing.T) {
+	const width, height = 20, 10
+	samples := make([]float64, width*height)
+	for i := range samples {
+		samples[i] = float64(i%width*10 - i/width*7)
+	}
+	samples[3] = -32768
+	nan := float32(math.NaN())
+
+	tests := []struct {
+		name string
+		f    testTIFF
+	}{
+		{"int16 strips", testTIFF{order: binary.LittleEndian, bitDepth: 16, format: 2, blockH: 3, noData: "-32768"}},
+		{"int16 big-endian LZW", testTIFF{order: binary.BigEndian, bitDepth: 16, format: 2, blockH: 4, compression: 5, predictor: 2, noData: "-32768"}},
+		{"int32 deflate tiles", testTIFF{order: binary.LittleEndian, bitDepth: 32, format: 2, blockW: 16, blockH: 16, compression: 8, noData: " -32768 "}},
+		{"float32 tiles", testTIFF{order: binary.BigEndian, bitDepth: 32, format: 3, blockW: 16, blockH: 8, compression: 8, predictor: 3, noData: "-32768"}},
+		{"float64 strips", testTIFF{order: binary.LittleEndian, bitDepth: 64, format: 3, blockH: 10, compression: 8, predictor: 3, noData: "-3.2768e4"}},
+	}
+	for _, tt := range tests {
+		tt.f.width, tt.f.height = width, height
+		data := encodeTestTIFF(t, tt.f, samples)
+		h, err := DecodeDEM(data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		want := make([]float32, len(samples))
+		for i, v := range samples {
+			want[i] = float32(v)
+		}
+		want[3] = nan
+		if h.Width != width || h.Height != height || !sameElevations(h.Elevation, want) {
+			t.Errorf("%s: got %dx%d %v, want %dx%d %v", tt.name, h.Width, h.Height, h.Elevation, width, height, want)
+		}
+
+		// Read in place and from a plain reader
+		for _, r := range []io.Reader{bytes.NewReader(data), io.MultiReader(bytes.NewReader(data))} {
+			if w, h, err := DecodeDEMConfig(r); err != nil || w != width || h != height {
+				t.Errorf("%s: DecodeDEMConfig = %d, %d, %v", tt.name, w, h, err)
+			}
+		}
+	}
+
+	uint8s := encodeTestTIFF(t, testTIFF{order: binary.LittleEndian, width: 3, height: 1, bitDepth: 8, format: 1, blockH: 1, predictor: 2}, []float64{5, 200, 7})
+	if h, err := DecodeDEM(uint8s); err != nil || !sameElevations(h.Elevation, []float32{5, 200, 7}) {
+		t.Errorf("uint8 predictor: %v, %v", h, err)
+	}
+
+	valid := testTIFF{order: binary.LittleEndian, width: 4, height: 4, bitDepth: 16, format: 2, blockH: 4}
+	for name, tc := range map[string]struct {
+		data []byte
+		want string
+	}{
+		"BigTIFF":     {[]byte("II+\x00\x08\x00\x00\x00"), "BigTIFF files are not supported"},
+		"truncated":   {encodeTestTIFF(t, valid, make([]float64, 16))[:30], "unexpected end of file"},
+		"JPEG":        {encodeTestTIFF(t, testTIFF{order: binary.LittleEndian, width: 4, height: 4, bitDepth: 16, format: 2, blockH: 4, compression: 7}, make([]float64, 16)), "compression 7 is not supported"},
+		"RGB":         {encodeTestTIFF(t, testTIFF{order: binary.LittleEndian, width: 4, height: 4, bitDepth: 16, format: 2, blockH: 4, samplesPerPixelCount: 3}, make([]float64, 16)), "3 samples per pixel"},
+		"float16":     {encodeTestTIFF(t, testTIFF{order: binary.LittleEndian, width: 4, height: 4, bitDepth: 16, format: 3, blockH: 4}, make([]float64, 16)), "16-bit samples of sample format 3"},
+		"bad nodata":  {encodeTestTIFF(t, testTIFF{order: binary.LittleEndian, width: 4, height: 4, bitDepth: 16, format: 2, blockH: 4, noData: "none"}, make([]float64, 16)), `invalid nodata value "none"`},
+		"not a grid":  {[]byte("hello"), "failed to decode ASCII grid"},
+		"short block": {encodeTestTIFF(t, testTIFF{order: binary.LittleEndian, width: 4, height: 4, bitDepth: 16, format: 2, blockH: 4, compression: 8}, make([]float64, 16))[:20], "unexpected end of file"},
+	} {
+		if _, err := DecodeDEM(tc.data); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want %q", name, err, tc.want)
+		}
+	}
+}
+
+func TestDecodeASCIIGrid(t *testing.T) {
+	grid := "ncols 3\nNROWS 2\nxllcenter 10.5\nyllcenter -3\ncellsize 0.0008333\nNODATA_value -9999\n" +
+		"1 2.5 -9999\n  -4 1e2\n6\n"
+	h, err := DecodeDEM([]byte(grid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float32{1, 2.5, float32(math.NaN()), -4, 100, 6}
+	if h.Width != 3 || h.Height != 2 || !sameElevations(h.Elevation, want) {
+		t.Errorf("got %dx%d %v, want 3x2 %v", h.Width, h.Height, h.Elevation, want)
+	}
+	if w, h, err := DecodeDEMConfig(strings.NewReader(grid)); err != nil || w != 3 || h != 2 {
+		t.Errorf("DecodeDEMConfig = %d, %d, %v", w, h, err)
+	}
+
+	for _, tc := range []struct{ grid, want string }{
+		{"ncols 2\nnrows 2\n1 2 3", "3 values, want 4"},
+		{"ncols 2\nnrows 1\n1 2 3", "more than 2 values"},
+		{"ncols 2\nnrows 1\n1 x", `invalid value "x" in row 1`},
+		{"ncols 2\n1 2", `invalid or missing nrows ""`},
+		{"ncols 2\nnrows 1\nnodata_value none\n1 2", `invalid NODATA_value "none"`},
+		{"ncols 2\nnrows 1\n", "no values after the header"},
+	} {
+		if _, err := DecodeDEM([]byte(tc.grid)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: got error %v, want %q", tc.grid, err, tc.want)
+		}
+	}
+}
+
+func TestSeaLevelAndResample(t *testing.T) {
+	// A coast running down the middle of a 6x4 model with one missing cell
+	nan := float32(math.NaN())
+	h := &Heightmap{Width: 6, Height: 4, Elevation: []float32{
+		-20, -5, 0, 40, 100, 300,
+		-20, -5, 0, 40, 100, 300,
+		-20, nan, 0, 60, 200, 500,
+		-20, -5, 0, 60, 200, 500,
+	}}
+	h.SetSeaLevel(0)
+	if got := h.Water[:6]; got[2] != true || got[3] != false {
+		t.Errorf("water at and above sea level = %v, %v, want true, false", got[2], got[3])
+	}
+	if !h.Water[13] {
+		t.Error("cell without elevation is not water")
+	}
+
+	// Every new pixel covers 3x2 cells, 2 of 6 or 3 of 6 of them water
+	r := h.Resample(2, 2)
+	wantWater := []bool{true, false, true, false}
+	wantElevation := []float32{0, (40 + 100 + 300) / 3.0, 0, (60 + 200 + 500) / 3.0}
+	for i := range wantWater {
+		if r.Water[i] != wantWater[i] || !r.Water[i] && math.Abs(float64(r.Elevation[i]-wantElevation[i])) > 1e-3 {
+			t.Errorf("pixel %d: water %v elevation %v, want %v %v", i, r.Water[i], r.Elevation[i], wantWater[i], wantElevation[i])
+		}
+	}
+
+	// Resampling between sizes that don't divide weighs cells by overlap
+	row := &Heightmap{Width: 3, Height: 1, Elevation: []float32{0, 30, 90}}
+	r = row.Resample(2, 1)
+	if r.Elevation[0] != 10 || r.Elevation[1] != 70 {
+		t.Errorf("3 to 2 pixels = %v, want [10 70]", r.Elevation)
+	}
+	r = row.Resample(6, 2)
+	if !sameElevations(r.Elevation, []float32{0, 0, 30, 30, 90, 90, 0, 0, 30, 30, 90, 90}) {
+		t.Errorf("3 to 6 pixels = %v", r.Elevation)
+	}
+
+	for _, tc := range []struct{ width, height, tiles, wantW, wantH int }{
+		{4000, 2000, 2_000_000, 2000, 1000},
+		{1000, 300, 100_000, 576, 172},
+		{10, 10, 1, 4, 4},
+		{100, 1, 400, 200, 4},
+	} {
+		if w, h := ResampleSize(tc.width, tc.height, tc.tiles); w != tc.wantW || h != tc.wantH {
+			t.Errorf("ResampleSize(%d, %d, %d) = %dx%d, want %dx%d", tc.width, tc.height, tc.tiles, w, h, tc.wantW, tc.wantH)
+		}
+	}
+
+	// Pixels without elevation are water even without a water mask
+	g := (&Heightmap{Width: 4, Height: 4, Elevation: append([]float32{nan}, make([]float32, 15)...)}).Classify(DefaultDEMCurve)
+	if g.At(0, 0).Type != Water || g.At(1, 0).Type != Land {
+		t.Errorf("NaN is %v and 0 is %v, want water and land", g.At(0, 0).Type, g.At(1, 0).Type)
+	}
+}
+
+// FuzzDecodeDEM checks that DecodeDEM rejects corrupt files without
+// panicking, and agrees with DecodeDEMConfig on the size of the others.
+func FuzzDecodeDEM(f *testing.F) {
+	samples := []float64{1, -2, 300, 4, 5, 6, 7, -32768}
+	for _, tt := range []testTIFF{
+		{order: binary.LittleEndian, bitDepth: 16, format: 2, blockH: 1, noData: "-32768"},
+		{order: binary.BigEndian, bitDepth: 32, format: 3, blockW: 16, blockH: 16, compression: 8, predictor: 3},
+		{order: binary.LittleEndian, bitDepth: 16, format: 1, blockH: 2, compression: 5, predictor: 2},
+	} {
+		tt.width, tt.height = 4, 2
+		f.Add(encodeTestTIFF(f, tt, samples))
+	}
+	f.Add([]byte("ncols 2\nnrows 2\nNODATA_value -1\n1 2\n-1 4\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		width, height, err := DecodeDEMConfig(bytes.NewReader(data))
+		if err != nil || width*height > maxFuzzPixels {
+			return
+		}
+		h, err := DecodeDEM(data)
+		if err != nil {
+			return
+		}
+		if h.Width != width || h.Height != height || len(h.Elevation) != width*height {
+			t.Fatalf("decoded %dx%d with %d elevations, DecodeDEMConfig says %dx%d", h.Width, h.Height, len(h.Elevation), width, height)
+		}
+	})
+}
@@ -0,0 +1,213 @@
+package mapgen
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"testing"
+)
+
+// maxFuzzPixels keeps fuzz inputs small enough to run thousands per second.
+const maxFuzzPixels = 64 * 64
+
+func encodePNG(t testing.TB, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// imageFromBytes builds a width-wide image with one pixel per 2 bytes of
+// data: the first is the blue channel and the second the alpha.
+func imageFromBytes(data []byte, width int) *image.NRGBA {
+	if width <= 0 {
+		width = 1
+	}
+	height := len(data) / 2 / width
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		img.SetNRGBA(i%width, i/width, color.NRGBA{R: 190, G: 200, B: data[2*i], A: data[2*i+1]})
+	}
+	return img
+}
+
+// randomMap returns a width x height image of land blobs in water.
+func randomMap(r *rand.Rand, width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{B: 106, A: 255})
+		}
+	}
+	for blob := 0; blob < 1+r.Intn(8); blob++ {
+		cx, cy, radius := r.Intn(width), r.Intn(height), 1+r.Intn(1+width/3)
+		for y := cy - radius; y <= cy+radius; y++ {
+			for x := cx - radius; x <= cx+radius; x++ {
+				if (x-cx)*(x-cx)+(y-cy)*(y-cy) <= radius*radius {
+					img.SetNRGBA(x, y, color.NRGBA{R: 190, G: 200, B: uint8(140 + r.Intn(61)), A: 255})
+				}
+			}
+		}
+	}
+	return img
+}
+
+// checkResult verifies the properties every generated map must have.
+func checkResult(t *testing.T, result MapResult) {
+	t.Helper()
+	for i, lod := range result.LODs() {
+		info := lod.Info
+		if len(info.Data) != info.Width*info.Height {
+			t.Fatalf("%s: %d bytes for %dx%d", lod.Key, len(info.Data), info.Width, info.Height)
+		}
+		if i > 0 {
+			prev := result.LODs()[i-1].Info
+			if info.Width != prev.Width/2 || info.Height != prev.Height/2 {
+				t.Errorf("%s is %dx%d, want half of %dx%d", lod.Key, info.Width, info.Height, prev.Width, prev.Height)
+			}
+		}
+
+		m := PackedMap{Width: info.Width, Height: info.Height, Data: info.Data}
+		land := 0
+		for j := range m.Data {
+			if m.IsLand(j) {
+				land++
+				if m.IsOcean(j) {
+					t.Errorf("%s: land tile %d has the ocean bit", lod.Key, j)
+				}
+			}
+		}
+		if land != info.NumLandTiles {
+			t.Errorf("%s: NumLandTiles = %d, but %d tiles have the land bit", lod.Key, info.NumLandTiles, land)
+		}
+	}
+
+	// The smaller levels of detail copy tiles from the full map, so only
+	// the full map's shoreline bits follow from its own neighbours
+	m := PackedMap{Width: result.Map.Width, Height: result.Map.Height, Data: result.Map.Data}
+	for i := range m.Data {
+		coast := false
+		for _, n := range m.Neighbors(i) {
+			if n >= 0 && m.IsLand(n) != m.IsLand(i) {
+				coast = true
+			}
+		}
+		if m.IsShoreline(i) != coast {
+			t.Errorf("tile (%d, %d): shoreline bit %v, but next to the other terrain type: %v",
+				i%m.Width, i/m.Width, m.IsShoreline(i), coast)
+		}
+		if !m.IsLand(i) && m.IsShoreline(i) && m.Magnitude(i) != 0 {
+			t.Errorf("tile (%d, %d): shoreline water has distance %d", i%m.Width, i/m.Width, m.Magnitude(i))
+		}
+	}
+}
+
+func TestGenerateMapProperties(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		width, height := 4+r.Intn(60), 4+r.Intn(60)
+		img := randomMap(r, width, height)
+		for _, removeSmall := range []bool{false, true} {
+			result, err := GenerateMap(GeneratorArgs{ImageBuffer: encodePNG(t, img), RemoveSmall: removeSmall})
+			if err != nil {
+				t.Fatalf("map %d (%dx%d): %v", i, width, height, err)
+			}
+			if result.Map.Width != width-width%4 || result.Map.Height != height-height%4 {
+				t.Errorf("map %d: %dx%d image gave a %dx%d map", i, width, height, result.Map.Width, result.Map.Height)
+			}
+			checkResult(t, result)
+		}
+	}
+}
+
+func TestGenerateMapEdgeCases(t *testing.T) {
+	solid := func(width, height int, c color.NRGBA) image.Image {
+		img := image.NewNRGBA(image.Rect(0, 0, width, height))
+		for i := 0; i < width*height; i++ {
+			img.SetNRGBA(i%width, i/width, c)
+		}
+		return img
+	}
+	land := color.NRGBA{R: 190, G: 220, B: 140, A: 255}
+	water := color.NRGBA{B: 106, A: 255}
+
+	tests := []struct {
+		name    string
+		img     image.Image
+		wantErr bool
+	}{
+		{"narrower than 4 pixels", solid(3, 16, land), true},
+		{"shorter than 4 pixels", solid(16, 2, land), true},
+		{"single pixel", solid(1, 1, water), true},
+		{"smallest map", solid(4, 4, land), false},
+		{"all land", solid(8, 8, land), false},
+		{"all water", solid(8, 8, water), false},
+		{"transparent", solid(8, 8, color.NRGBA{}), false},
+		{"cropped", solid(9, 7, land), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, removeSmall := range []bool{false, true} {
+				result, err := GenerateMap(GeneratorArgs{ImageBuffer: encodePNG(t, tt.img), RemoveSmall: removeSmall})
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("GenerateMap error = %v, want error %v", err, tt.wantErr)
+				}
+				if err == nil {
+					checkResult(t, result)
+				}
+			}
+		})
+	}
+}
+
+func FuzzGenerateMap(f *testing.F) {
+	for _, fixture := range []string{"half_land_half_ocean", "ocean_and_land"} {
+		f.Add(readFixture(f, fixture), false)
+	}
+	f.Add(encodePNG(f, image.NewNRGBA(image.Rect(0, 0, 3, 8))), true)
+	f.Add(encodePNG(f, randomMap(rand.New(rand.NewSource(2)), 32, 24)), true)
+	f.Add([]byte("not a png"), false)
+
+	f.Fuzz(func(t *testing.T, data []byte, removeSmall bool) {
+		cfg, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil || cfg.Width*cfg.Height > maxFuzzPixels {
+			return
+		}
+		result, err := GenerateMap(GeneratorArgs{ImageBuffer: data, RemoveSmall: removeSmall})
+		if err != nil {
+			return
+		}
+		checkResult(t, result)
+	})
+}
+
+// FuzzPipeline feeds raw pixels to the stages after decoding, which explores
+// terrain layouts much faster than mutating PNG bytes.
+func FuzzPipeline(f *testing.F) {
+	f.Add([]byte{}, uint8(4), false)
+	f.Add(bytes.Repeat([]byte{106, 255, 150, 255}, 64), uint8(8), true)
+	f.Add(bytes.Repeat([]byte{0, 0, 200, 255, 106, 255}, 100), uint8(12), false)
+
+	f.Fuzz(func(t *testing.T, data []byte, width uint8, removeSmall bool) {
+		if len(data) > 2*maxFuzzPixels {
+			return
+		}
+		img := imageFromBytes(data, int(width))
+		if img.Bounds().Empty() {
+			return
+		}
+		result, err := GenerateMap(GeneratorArgs{ImageBuffer: encodePNG(t, img), RemoveSmall: removeSmall})
+		if err != nil {
+			b := img.Bounds()
+			if b.Dx() >= 4 && b.Dy() >= 4 {
+				t.Fatalf("%dx%d image: %v", b.Dx(), b.Dy(), err)
+			}
+			return
+		}
+		checkResult(t, result)
+	})
+}
@@ -0,0 +1,423 @@
+package mapgen
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/tiff/lzw"
+)
+
+// TIFF tags read by geoTIFF. Everything else, including the georeferencing,
+// is ignored.
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffPredictor       = 317
+	tiffTileWidth       = 322
+	tiffTileLength      = 323
+	tiffTileOffsets     = 324
+	tiffTileByteCounts  = 325
+	tiffSampleFormat    = 339
+	tiffGDALNoData      = 42113
+)
+
+// maxTIFFField caps the size of a single tag value, so a corrupt count
+// can't make the reader allocate gigabytes.
+const maxTIFFField = 64 << 20
+
+// geoTIFF reads the single-band rasters elevation models are distributed
+// as: 8-, 16- or 32-bit integers or 32- or 64-bit floats, in strips or
+// tiles, uncompressed or with LZW or Deflate and their predictors.
+// golang.org/x/image/tiff reads neither signed nor floating point samples.
+type geoTIFF struct {
+	r     io.ReaderAt
+	size  int64 // size of the file, -1 if unknown
+	order binary.ByteOrder
+	// values of the tags above, in the file's byte order
+	fields map[uint16]tiffField
+}
+
+type tiffField struct {
+	typ   uint16
+	count uint64
+	data  []byte
+}
+
+// tiffTypeSizes are the sizes of the TIFF field types, by type.
+var tiffTypeSizes = [...]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 16: 8}
+
+// isTIFF reports whether data starts with a TIFF or BigTIFF header.
+func isTIFF(data []byte) bool {
+	for _, magic := range []string{"II*\x00", "MM\x00*", "II+\x00", "MM\x00+"} {
+		if bytes.HasPrefix(data, []byte(magic)) {
+			return true
+		}
+	}
+	return false
+}
+
+// readGeoTIFF reads the header and first image directory of a TIFF file of
+// the given size, or -1 if its size is unknown. Only files of a known size
+// can be decoded.
+func readGeoTIFF(r io.ReaderAt, size int64) (*geoTIFF, error) {
+	t := &geoTIFF{r: r, size: size, fields: make(map[uint16]tiffField)}
+	header, err := t.read(0, 8)
+	if err != nil {
+		return nil, err
+	}
+	switch string(header[:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	case "II+\x00", "MM\x00+":
+		return nil, errors.New("BigTIFF files are not supported")
+	default:
+		return nil, errors.New("not a TIFF file")
+	}
+
+	ifd := int64(t.order.Uint32(header[4:]))
+	countBytes, err := t.read(ifd, 2)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := t.read(ifd+2, 12*int(t.order.Uint16(countBytes)))
+	if err != nil {
+		return nil, err
+	}
+	for e := entries; len(e) >= 12; e = e[12:] {
+		tag, typ := t.order.Uint16(e), t.order.Uint16(e[2:])
+		switch tag {
+		case tiffImageWidth, tiffImageLength, tiffBitsPerSample, tiffCompression,
+			tiffStripOffsets, tiffSamplesPerPixel, tiffRowsPerStrip, tiffStripByteCounts,
+			tiffPredictor, tiffTileWidth, tiffTileLength, tiffTileOffsets, tiffTileByteCounts,
+			tiffSampleFormat, tiffGDALNoData:
+		default:
+			continue
+		}
+		if int(typ) >= len(tiffTypeSizes) || tiffTypeSizes[typ] == 0 {
+			return nil, fmt.Errorf("tag %d has unknown type %d", tag, typ)
+		}
+		count := uint64(t.order.Uint32(e[4:]))
+		n := count * uint64(tiffTypeSizes[typ])
+		if n > maxTIFFField {
+			return nil, fmt.Errorf("tag %d has %d values", tag, count)
+		}
+		data := e[8:12]
+		if n > 4 {
+			if data, err = t.read(int64(t.order.Uint32(e[8:])), int(n)); err != nil {
+				return nil, err
+			}
+		}
+		t.fields[tag] = tiffField{typ, count, data[:n]}
+	}
+	return t, nil
+}
+
+// read reads n bytes at off.
+func (t *geoTIFF) read(off int64, n int) ([]byte, error) {
+	if off < 0 || t.size >= 0 && off+int64(n) > t.size {
+		return nil, errors.New("unexpected end of file")
+	}
+	buf := make([]byte, n)
+	if _, err := t.r.ReadAt(buf, off); err != nil {
+		if err == io.EOF {
+			err = errors.New("unexpected end of file")
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// uints returns the values of an integer tag, nil if it is missing.
+func (t *geoTIFF) uints(tag uint16) ([]uint64, error) {
+	f, ok := t.fields[tag]
+	if !ok {
+		return nil, nil
+	}
+	values := make([]uint64, f.count)
+	for i := range values {
+		switch f.typ {
+		case 1:
+			values[i] = uint64(f.data[i])
+		case 3:
+			values[i] = uint64(t.order.Uint16(f.data[2*i:]))
+		case 4:
+			values[i] = uint64(t.order.Uint32(f.data[4*i:]))
+		case 16:
+			values[i] = t.order.Uint64(f.data[8*i:])
+		default:
+			return nil, fmt.Errorf("tag %d has type %d, want an integer", tag, f.typ)
+		}
+	}
+	return values, nil
+}
+
+// uint returns the single value of an integer tag, or def if it is missing.
+func (t *geoTIFF) uint(tag uint16, def int) (int, error) {
+	values, err := t.uints(tag)
+	if err != nil || values == nil {
+		return def, err
+	}
+	if len(values) == 0 || values[0] > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid value %v for tag %d", values, tag)
+	}
+	// Tags such as BitsPerSample repeat their value for every sample
+	for _, v := range values[1:] {
+		if v != values[0] {
+			return 0, fmt.Errorf("tag %d has different values %v", tag, values)
+		}
+	}
+	return int(values[0]), nil
+}
+
+// imageSize returns the width and height of the image.
+func (t *geoTIFF) imageSize() (width, height int, err error) {
+	if width, err = t.uint(tiffImageWidth, 0); err != nil {
+		return 0, 0, err
+	}
+	if height, err = t.uint(tiffImageLength, 0); err != nil {
+		return 0, 0, err
+	}
+	if err := checkDEMSize(width, height); err != nil {
+		return 0, 0, err
+	}
+	return width, height, nil
+}
+
+// noData returns the GDAL nodata value, NaN if there is none.
+func (t *geoTIFF) noData() (float64, error) {
+	f, ok := t.fields[tiffGDALNoData]
+	if !ok {
+		return math.NaN(), nil
+	}
+	s := strings.TrimSpace(strings.TrimRight(string(f.data), "\x00"))
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid nodata value %q", s)
+	}
+	return v, nil
+}
+
+// decode reads the elevations of the image. Samples equal to the nodata
+// value become NaN.
+func (t *geoTIFF) decode() (*Heightmap, error) {
+	width, height, err := t.imageSize()
+	if err != nil {
+		return nil, err
+	}
+	samples, err := t.uint(tiffSamplesPerPixel, 1)
+	if err != nil {
+		return nil, err
+	}
+	if samples != 1 {
+		return nil, fmt.Errorf("%d samples per pixel, want a single band", samples)
+	}
+	bitDepth, err := t.uint(tiffBitsPerSample, 1)
+	if err != nil {
+		return nil, err
+	}
+	format, err := t.uint(tiffSampleFormat, 1)
+	if err != nil {
+		return nil, err
+	}
+	sample, err := tiffSampleReader(format, bitDepth)
+	if err != nil {
+		return nil, err
+	}
+	compression, err := t.uint(tiffCompression, 1)
+	if err != nil {
+		return nil, err
+	}
+	predictor, err := t.uint(tiffPredictor, 1)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case predictor == 1:
+	case predictor == 2 && format != 3, predictor == 3 && format == 3:
+	default:
+		return nil, fmt.Errorf("predictor %d is not supported for sample format %d", predictor, format)
+	}
+	noData, err := t.noData()
+	if err != nil {
+		return nil, err
+	}
+
+	// Strips are tiles as wide as the image
+	blockWidth, blockHeight := width, height
+	offsetsTag, countsTag := uint16(tiffStripOffsets), uint16(tiffStripByteCounts)
+	if _, tiled := t.fields[tiffTileWidth]; tiled {
+		if blockWidth, err = t.uint(tiffTileWidth, 0); err != nil {
+			return nil, err
+		}
+		if blockHeight, err = t.uint(tiffTileLength, 0); err != nil {
+			return nil, err
+		}
+		offsetsTag, countsTag = tiffTileOffsets, tiffTileByteCounts
+	} else {
+		if blockHeight, err = t.uint(tiffRowsPerStrip, height); err != nil {
+			return nil, err
+		}
+		blockHeight = min(blockHeight, height)
+	}
+	// Tiles may reach past the edges of the image, but not by much
+	if blockWidth <= 0 || blockHeight <= 0 || blockWidth > max(width, 1<<12) || blockHeight > max(height, 1<<12) {
+		return nil, fmt.Errorf("invalid block size %dx%d", blockWidth, blockHeight)
+	}
+	across := (width + blockWidth - 1) / blockWidth
+	down := (height + blockHeight - 1) / blockHeight
+	offsets, err := t.uints(offsetsTag)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := t.uints(countsTag)
+	if err != nil {
+		return nil, err
+	}
+	if len(offsets) < across*down || len(counts) < across*down {
+		return nil, fmt.Errorf("%d offsets and %d byte counts for %d blocks", len(offsets), len(counts), across*down)
+	}
+
+	h := NewHeightmap(width, height)
+	sampleBytes := bitDepth / 8
+	order := t.order
+	if predictor == 3 {
+		order = binary.BigEndian
+	}
+	for by := 0; by < down; by++ {
+		for bx := 0; bx < across; bx++ {
+			i := by*across + bx
+			// The last strip only holds the rows that are left; tiles are
+			// always whole
+			rows := blockHeight
+			if offsetsTag == tiffStripOffsets {
+				rows = min(rows, height-by*blockHeight)
+			}
+			rowBytes := blockWidth * sampleBytes
+			block, err := t.readBlock(int64(offsets[i]), int64(counts[i]), compression, rowBytes*rows)
+			if err != nil {
+				return nil, fmt.Errorf("block %d: %w", i, err)
+			}
+			for y := 0; y < rows && by*blockHeight+y < height; y++ {
+				row := block[y*rowBytes : (y+1)*rowBytes]
+				switch predictor {
+				case 2:
+					undoHorizontalPredictor(row, sampleBytes, t.order)
+				case 3:
+					undoFloatPredictor(row, sampleBytes)
+				}
+				py := by*blockHeight + y
+				for x := 0; x < blockWidth && bx*blockWidth+x < width; x++ {
+					v := sample(row[x*sampleBytes:], order)
+					if float32(v) == float32(noData) {
+						v = math.NaN()
+					}
+					h.Elevation[py*width+bx*blockWidth+x] = float32(v)
+				}
+			}
+		}
+	}
+	return h, nil
+}
+
+// readBlock reads and decompresses a strip or tile of n bytes.
+func (t *geoTIFF) readBlock(offset, count int64, compression, n int) ([]byte, error) {
+	raw, err := t.read(offset, int(count))
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader
+	switch compression {
+	case 1:
+		if len(raw) < n {
+			return nil, errors.New("block is too short")
+		}
+		return raw[:n], nil
+	case 5:
+		r = lzw.NewReader(bytes.NewReader(raw), lzw.MSB, 8)
+	case 8, 32946:
+		if r, err = zlib.NewReader(bytes.NewReader(raw)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("compression %d is not supported, use none, LZW or Deflate", compression)
+	}
+	block := make([]byte, n)
+	if _, err := io.ReadFull(r, block); err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	return block, nil
+}
+
+// tiffSampleReader returns a function reading one sample of the given TIFF
+// sample format and bit depth.
+func tiffSampleReader(format, bitDepth int) (func(b []byte, order binary.ByteOrder) float64, error) {
+	switch {
+	case format == 1 && bitDepth == 8:
+		return func(b []byte, _ binary.ByteOrder) float64 { return float64(b[0]) }, nil
+	case format == 1 && bitDepth == 16:
+		return func(b []byte, o binary.ByteOrder) float64 { return float64(o.Uint16(b)) }, nil
+	case format == 1 && bitDepth == 32:
+		return func(b []byte, o binary.ByteOrder) float64 { return float64(o.Uint32(b)) }, nil
+	case format == 2 && bitDepth == 8:
+		return func(b []byte, _ binary.ByteOrder) float64 { return float64(int8(b[0])) }, nil
+	case format == 2 && bitDepth == 16:
+		return func(b []byte, o binary.ByteOrder) float64 { return float64(int16(o.Uint16(b))) }, nil
+	case format == 2 && bitDepth == 32:
+		return func(b []byte, o binary.ByteOrder) float64 { return float64(int32(o.Uint32(b))) }, nil
+	case format == 3 && bitDepth == 32:
+		return func(b []byte, o binary.ByteOrder) float64 { return float64(math.Float32frombits(o.Uint32(b))) }, nil
+	case format == 3 && bitDepth == 64:
+		return func(b []byte, o binary.ByteOrder) float64 { return math.Float64frombits(o.Uint64(b)) }, nil
+	}
+	return nil, fmt.Errorf("%d-bit samples of sample format %d are not supported", bitDepth, format)
+}
+
+// undoHorizontalPredictor turns the differences between neighbouring
+// samples of a row back into samples.
+func undoHorizontalPredictor(row []byte, sampleBytes int, order binary.ByteOrder) {
+	switch sampleBytes {
+	case 1:
+		for i := 1; i < len(row); i++ {
+			row[i] += row[i-1]
+		}
+	case 2:
+		for i := 2; i+2 <= len(row); i += 2 {
+			order.PutUint16(row[i:], order.Uint16(row[i:])+order.Uint16(row[i-2:]))
+		}
+	case 4:
+		for i := 4; i+4 <= len(row); i += 4 {
+			order.PutUint32(row[i:], order.Uint32(row[i:])+order.Uint32(row[i-4:]))
+		}
+	}
+}
+
+// undoFloatPredictor undoes the floating point predictor, which stores the
+// bytes of a row's samples as differences, most significant bytes of every
+// sample first. The samples are left big-endian.
+func undoFloatPredictor(row []byte, sampleBytes int) {
+	for i := 1; i < len(row); i++ {
+		row[i] += row[i-1]
+	}
+	planes := append([]byte(nil), row...)
+	n := len(row) / sampleBytes
+	for i := 0; i < n; i++ {
+		for b := 0; b < sampleBytes; b++ {
+			row[i*sampleBytes+b] = planes[b*n+i]
+		}
+	}
+}
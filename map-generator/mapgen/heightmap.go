@@ -0,0 +1,192 @@
+package mapgen
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// Heightmap is a map source given as the elevation of every pixel rather
+// than as colors, with a water mask saying which pixels are water.
+type Heightmap struct {
+	Width, Height int
+	// Elevation holds one value per pixel, row by row. Heightmap images and
+	// raw files give it in 16-bit units, 0-65535, whatever their bit depth,
+	// and DEMs in their own units. NaN marks pixels without an elevation,
+	// which are water.
+	Elevation []float32
+	// Water marks the water pixels, row by row. Nil means every pixel is
+	// land.
+	Water []bool
+}
+
+// NewHeightmap returns a heightmap of the given size at elevation 0 with no
+// water mask.
+func NewHeightmap(width, height int) *Heightmap {
+	return &Heightmap{Width: width, Height: height, Elevation: make([]float32, width*height)}
+}
+
+// HeightmapFromImage takes the elevations of a grayscale image. 8-bit gray
+// is scaled so that 255 is 65535, and color images are converted to gray.
+func HeightmapFromImage(img image.Image) *Heightmap {
+	b := img.Bounds()
+	h := NewHeightmap(b.Dx(), b.Dy())
+	for y := 0; y < h.Height; y++ {
+		row := h.Elevation[y*h.Width : (y+1)*h.Width]
+		switch img := img.(type) {
+		case *image.Gray16:
+			pix := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):]
+			for x := range row {
+				row[x] = float32(binary.BigEndian.Uint16(pix[2*x:]))
+			}
+		case *image.Gray:
+			pix := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):]
+			for x := range row {
+				row[x] = float32(uint16(pix[x]) * 0x101)
+			}
+		default:
+			for x := range row {
+				row[x] = float32(color.Gray16Model.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray16).Y)
+			}
+		}
+	}
+	return h
+}
+
+// RawFormat describes a raw heightmap: samples row by row with no header.
+type RawFormat struct {
+	Width, Height int
+	// BitDepth is 8 or 16.
+	BitDepth int
+	// BigEndian is the byte order of 16-bit samples. Most terrain tools
+	// write them little-endian.
+	BigEndian bool
+}
+
+// DecodeRaw reads a raw heightmap. 8-bit samples are scaled so that 255 is
+// 65535, as in HeightmapFromImage.
+func DecodeRaw(data []byte, f RawFormat) (*Heightmap, error) {
+	if f.BitDepth != 8 && f.BitDepth != 16 {
+		return nil, fmt.Errorf("raw heightmap has %d bits per sample, want 8 or 16", f.BitDepth)
+	}
+	if f.Width <= 0 || f.Height <= 0 {
+		return nil, fmt.Errorf("invalid raw heightmap size %dx%d", f.Width, f.Height)
+	}
+	if want := f.Width * f.Height * f.BitDepth / 8; len(data) != want {
+		return nil, fmt.Errorf("raw heightmap is %d bytes, want %d for %dx%d at %d bits",
+			len(data), want, f.Width, f.Height, f.BitDepth)
+	}
+
+	h := NewHeightmap(f.Width, f.Height)
+	var order binary.ByteOrder = binary.LittleEndian
+	if f.BigEndian {
+		order = binary.BigEndian
+	}
+	for i := range h.Elevation {
+		if f.BitDepth == 8 {
+			h.Elevation[i] = float32(uint16(data[i]) * 0x101)
+		} else {
+			h.Elevation[i] = float32(order.Uint16(data[2*i:]))
+		}
+	}
+	return h, nil
+}
+
+// SetWaterMask marks the pixels that are light in mask as water: those with
+// a gray value of at least 128 that are at least half opaque. The mask must
+// be the size of the heightmap.
+func (h *Heightmap) SetWaterMask(mask image.Image) error {
+	b := mask.Bounds()
+	if b.Dx() != h.Width || b.Dy() != h.Height {
+		return fmt.Errorf("water mask is %dx%d, want %dx%d like the heightmap", b.Dx(), b.Dy(), h.Width, h.Height)
+	}
+	at := nrgbaReader(mask)
+	h.Water = make([]bool, h.Width*h.Height)
+	for y := 0; y < h.Height; y++ {
+		for x := 0; x < h.Width; x++ {
+			c := at(x, y)
+			// The luminance weights of color.GrayModel
+			gray := (19595*uint32(c.R) + 38470*uint32(c.G) + 7471*uint32(c.B) + 1<<15) >> 16
+			h.Water[y*h.Width+x] = c.A >= 128 && gray >= 128
+		}
+	}
+	return nil
+}
+
+// CurvePoint is a point of a HeightCurve.
+type CurvePoint struct {
+	Elevation, Magnitude float64
+}
+
+// HeightCurve maps elevations to land magnitudes, linearly between its
+// points, which are in increasing order of elevation. Elevations beyond the
+// first or last point take its magnitude.
+type HeightCurve []CurvePoint
+
+// DefaultHeightCurve spreads the 16-bit elevations of a heightmap evenly
+// over the land magnitudes.
+var DefaultHeightCurve = HeightCurve{{0, 0}, {65535, MaxLandMagnitude}}
+
+// Validate reports curves without points, with elevations out of order and
+// with magnitudes a map can't hold.
+func (c HeightCurve) Validate() error {
+	if len(c) == 0 {
+		return errors.New("height curve has no points")
+	}
+	for i, p := range c {
+		if math.IsNaN(p.Elevation) || math.IsInf(p.Elevation, 0) {
+			return fmt.Errorf("height curve point %d has elevation %v", i, p.Elevation)
+		}
+		if !(p.Magnitude >= 0 && p.Magnitude <= MaxLandMagnitude) {
+			return fmt.Errorf("height curve point %d has magnitude %v, want 0-%d", i, p.Magnitude, MaxLandMagnitude)
+		}
+		if i > 0 && p.Elevation <= c[i-1].Elevation {
+			return fmt.Errorf("height curve point %d is at elevation %v, not above the %v before it", i, p.Elevation, c[i-1].Elevation)
+		}
+	}
+	return nil
+}
+
+// Magnitude returns the land magnitude of an elevation.
+func (c HeightCurve) Magnitude(elevation float64) float64 {
+	i := sort.Search(len(c), func(i int) bool { return c[i].Elevation >= elevation })
+	switch {
+	case i == 0:
+		return c[0].Magnitude
+	case i == len(c):
+		return c[len(c)-1].Magnitude
+	}
+	lo, hi := c[i-1], c[i]
+	return lo.Magnitude + (elevation-lo.Elevation)*(hi.Magnitude-lo.Magnitude)/(hi.Elevation-lo.Elevation)
+}
+
+// Classify turns the heightmap into a grid: water where the water mask is
+// set or there is no elevation, and land elsewhere, with the magnitude curve
+// gives its elevation, which must be valid. The grid is cropped like
+// Classify's.
+func (h *Heightmap) Classify(curve HeightCurve) *Grid {
+	terrain := NewGrid(h.Width-h.Width%4, h.Height-h.Height%4)
+	last := float32(math.NaN())
+	var lastTile tile
+	for y := 0; y < terrain.Height; y++ {
+		for x := 0; x < terrain.Width; x++ {
+			i := y*h.Width + x
+			e := h.Elevation[i]
+			if e != e || h.Water != nil && h.Water[i] {
+				continue
+			}
+			// Neighbouring pixels mostly have the same elevation
+			if e != last {
+				last = e
+				// Rounded down to a half, like legend channels
+				lastTile = tile{flags: tileLand, magnitude: uint8(curve.Magnitude(float64(e)) * 2)}
+			}
+			terrain.tiles[y*terrain.Width+x] = lastTile
+		}
+	}
+	return terrain
+}
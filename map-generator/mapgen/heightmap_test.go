@@ -0,0 +1,159 @@
+package mapgen
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestHeightCurve(t *testing.T) {
+	curve := HeightCurve{{100, 2}, {200, 10}, {1000, 30}}
+	if err := curve.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ elevation, want float64 }{
+		{0, 2}, {100, 2}, {150, 6}, {200, 10}, {600, 20}, {1000, 30}, {5000, 30},
+	} {
+		if got := curve.Magnitude(tc.elevation); got != tc.want {
+			t.Errorf("Magnitude(%v) = %v, want %v", tc.elevation, got, tc.want)
+		}
+	}
+	if got := DefaultHeightCurve.Magnitude(65535); got != MaxLandMagnitude {
+		t.Errorf("default curve tops out at %v, want %v", got, MaxLandMagnitude)
+	}
+
+	for name, c := range map[string]HeightCurve{
+		"no points":      {},
+		"out of order":   {{200, 0}, {100, 10}},
+		"same elevation": {{100, 0}, {100, 10}},
+		"high magnitude": {{0, 0}, {100, 32}},
+		"negative":       {{0, -1}},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: Validate succeeded", name)
+		}
+	}
+}
+
+func TestDecodeRaw(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		format RawFormat
+		want   []float32
+	}{
+		{"16-bit little-endian", []byte{0x34, 0x12, 0xff, 0xff}, RawFormat{Width: 2, Height: 1, BitDepth: 16}, []float32{0x1234, 0xffff}},
+		{"16-bit big-endian", []byte{0x12, 0x34, 0x00, 0x01}, RawFormat{Width: 1, Height: 2, BitDepth: 16, BigEndian: true}, []float32{0x1234, 1}},
+		{"8-bit", []byte{0, 1, 128, 255}, RawFormat{Width: 2, Height: 2, BitDepth: 8}, []float32{0, 0x101, 0x8080, 0xffff}},
+	}
+	for _, tt := range tests {
+		h, err := DecodeRaw(tt.data, tt.format)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if h.Width != tt.format.Width || h.Height != tt.format.Height {
+			t.Errorf("%s: heightmap is %dx%d", tt.name, h.Width, h.Height)
+		}
+		for i, want := range tt.want {
+			if h.Elevation[i] != want {
+				t.Errorf("%s: elevation %d = %v, want %v", tt.name, i, h.Elevation[i], want)
+			}
+		}
+	}
+
+	for _, f := range []RawFormat{
+		{Width: 2, Height: 2, BitDepth: 16},
+		{Width: 2, Height: 2, BitDepth: 12},
+		{Width: 0, Height: 4, BitDepth: 8},
+	} {
+		if _, err := DecodeRaw(make([]byte, 4), f); err == nil {
+			t.Errorf("DecodeRaw(%+v) of 4 bytes succeeded", f)
+		}
+	}
+}
+
+func TestHeightmapFromImage(t *testing.T) {
+	bounds := image.Rect(2, 3, 4, 4)
+	gray16 := image.NewGray16(bounds)
+	gray16.SetGray16(2, 3, color.Gray16{0x1234})
+	gray16.SetGray16(3, 3, color.Gray16{0xfedc})
+	gray := image.NewGray(bounds)
+	gray.SetGray(2, 3, color.Gray{0x12})
+	gray.SetGray(3, 3, color.Gray{0xfe})
+	nrgba := image.NewNRGBA(bounds)
+	nrgba.SetNRGBA(2, 3, color.NRGBA{0x12, 0x12, 0x12, 0xff})
+	nrgba.SetNRGBA(3, 3, color.NRGBA{0xfe, 0xfe, 0xfe, 0xff})
+
+	for name, tc := range map[string]struct {
+		img  image.Image
+		want []float32
+	}{
+		"gray16": {gray16, []float32{0x1234, 0xfedc}},
+		"gray":   {gray, []float32{0x1212, 0xfefe}},
+		"nrgba":  {nrgba, []float32{0x1212, 0xfefe}},
+	} {
+		h := HeightmapFromImage(tc.img)
+		if h.Width != 2 || h.Height != 1 || h.Elevation[0] != tc.want[0] || h.Elevation[1] != tc.want[1] {
+			t.Errorf("%s: %dx%d heightmap with elevations %v, want 2x1 with %v", name, h.Width, h.Height, h.Elevation, tc.want)
+		}
+	}
+}
+
+func TestHeightmapClassify(t *testing.T) {
+	// Rising from west to east, with water in the first column and on the
+	// cropped fifth row
+	h := NewHeightmap(8, 5)
+	mask := image.NewNRGBA(image.Rect(0, 0, 8, 5))
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 8; x++ {
+			h.Elevation[y*8+x] = float32(x * 1000)
+			switch {
+			case x == 0:
+				mask.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+			case y == 4:
+				mask.SetNRGBA(x, y, color.NRGBA{200, 200, 200, 255})
+			case x == 7:
+				// White but transparent is land
+				mask.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 100})
+			default:
+				mask.SetNRGBA(x, y, color.NRGBA{0, 0, 0, 255})
+			}
+		}
+	}
+	if err := h.SetWaterMask(mask); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetWaterMask(image.NewGray(image.Rect(0, 0, 8, 4))); err == nil {
+		t.Error("SetWaterMask accepted a mask of another size")
+	}
+
+	g := h.Classify(HeightCurve{{1000, 0}, {6000, 20}})
+	if g.Width != 8 || g.Height != 4 {
+		t.Fatalf("grid is %dx%d, want 8x4", g.Width, g.Height)
+	}
+	for x, want := range []Terrain{
+		{Type: Water}, {Type: Land}, {Type: Land, Magnitude: 4}, {Type: Land, Magnitude: 8},
+		{Type: Land, Magnitude: 12}, {Type: Land, Magnitude: 16}, {Type: Land, Magnitude: 20}, {Type: Land, Magnitude: 20},
+	} {
+		if got := g.At(x, 2); got.Type != want.Type || got.Magnitude != want.Magnitude {
+			t.Errorf("(%d, 2) = type %d magnitude %v, want type %d magnitude %v", x, got.Type, got.Magnitude, want.Type, want.Magnitude)
+		}
+	}
+
+	// GenerateMap takes the default curve, and like Classify rounds
+	// magnitudes down to a half
+	h.Elevation[2*8+3] = 65535 * 4.25 / 31
+	result, err := GenerateMap(GeneratorArgs{Heightmap: h})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Map.NumLandTiles != 28 {
+		t.Errorf("NumLandTiles = %d, want 28", result.Map.NumLandTiles)
+	}
+	if got := result.Map.Data[2*8+3] & MagnitudeMask; got != 4 {
+		t.Errorf("packed magnitude = %d, want 4 from 4.25", got)
+	}
+	if _, err := GenerateMap(GeneratorArgs{Heightmap: h, HeightCurve: HeightCurve{}}); err == nil {
+		t.Error("GenerateMap accepted an empty height curve")
+	}
+}
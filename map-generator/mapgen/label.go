@@ -0,0 +1,251 @@
+package mapgen
+
+import (
+	"runtime"
+	"sync"
+)
+
+// minStripRows keeps strips tall enough that labeling one outweighs the cost
+// of merging it with its neighbours.
+const minStripRows = 64
+
+// strip is a band of rows [y0, y1) handled by one goroutine.
+type strip struct {
+	y0, y1 int
+}
+
+// splitRows divides height rows into at most workers strips of at least
+// minRows rows each.
+func splitRows(height, workers, minRows int) []strip {
+	n := min(workers, height/max(minRows, 1))
+	if n < 1 {
+		n = 1
+	}
+	strips := make([]strip, n)
+	for k := range strips {
+		strips[k] = strip{y0: k * height / n, y1: (k + 1) * height / n}
+	}
+	return strips
+}
+
+// forEachStrip calls fn for every strip concurrently and waits for them.
+func forEachStrip(strips []strip, fn func(k int, s strip)) {
+	if len(strips) == 1 {
+		fn(0, strips[0])
+		return
+	}
+	var wg sync.WaitGroup
+	for k, s := range strips {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(k, s)
+		}()
+	}
+	wg.Wait()
+}
+
+// workerStrips splits g for labeling on every available CPU.
+func (g *Grid) workerStrips() []strip {
+	return splitRows(g.Height, runtime.GOMAXPROCS(0), minStripRows)
+}
+
+// component is a 4-connected area of tiles of the same type.
+type component struct {
+	land bool
+	size int
+	// first is the smallest x*Height+y of its tiles: components ordered by
+	// first are in the order a column by column scan finds them
+	first int
+}
+
+// labeling assigns every tile the index of its component.
+type labeling struct {
+	labels     []int32
+	components []component
+}
+
+// unionFind tracks provisional labels. Parents always have a lower label
+// than their children, so one pass in label order flattens every tree.
+type unionFind struct {
+	parent []int32
+	size   []int32
+	first  []int32
+	land   []bool
+}
+
+func (uf *unionFind) add(land bool, first int32) int32 {
+	l := int32(len(uf.parent))
+	uf.parent = append(uf.parent, l)
+	uf.size = append(uf.size, 0)
+	uf.first = append(uf.first, first)
+	uf.land = append(uf.land, land)
+	return l
+}
+
+func (uf *unionFind) find(l int32) int32 {
+	for uf.parent[l] != l {
+		// Path halving keeps parents below their children
+		uf.parent[l] = uf.parent[uf.parent[l]]
+		l = uf.parent[l]
+	}
+	return l
+}
+
+func (uf *unionFind) union(a, b int32) int32 {
+	ra, rb := uf.find(a), uf.find(b)
+	if ra == rb {
+		return ra
+	}
+	if rb < ra {
+		ra, rb = rb, ra
+	}
+	uf.parent[rb] = ra
+	return ra
+}
+
+// labelStrip gives every tile in s a provisional label local to the strip,
+// joining labels of equal neighbours to the left and above.
+func (g *Grid) labelStrip(labels []int32, s strip) unionFind {
+	w, h := g.Width, g.Height
+	tiles := g.tiles
+	uf := unionFind{}
+
+	for y := s.y0; y < s.y1; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			land := tiles[i].isLand()
+			order := int32(x*h + y)
+
+			l := int32(-1)
+			if x > 0 && tiles[i-1].isLand() == land {
+				l = labels[i-1]
+			}
+			if y > s.y0 && tiles[i-w].isLand() == land {
+				if up := labels[i-w]; l < 0 {
+					l = up
+				} else if up != l {
+					l = uf.union(l, up)
+				}
+			}
+			if l < 0 {
+				l = uf.add(land, order)
+			}
+			labels[i] = l
+			uf.size[l]++
+			if order < uf.first[l] {
+				uf.first[l] = order
+			}
+		}
+	}
+	return uf
+}
+
+// labelComponents finds every 4-connected area of land and of water. Each
+// strip is labeled on its own goroutine, then the strips are joined along
+// their borders and the labels renumbered into component indices.
+func (g *Grid) labelComponents(strips []strip) labeling {
+	labels := make([]int32, len(g.tiles))
+	locals := make([]unionFind, len(strips))
+	forEachStrip(strips, func(k int, s strip) {
+		locals[k] = g.labelStrip(labels, s)
+	})
+
+	// Combine the strips' labels into one label space
+	bases := make([]int32, len(strips))
+	total := 0
+	for k, local := range locals {
+		bases[k] = int32(total)
+		total += len(local.parent)
+	}
+	uf := unionFind{
+		parent: make([]int32, 0, total),
+		size:   make([]int32, 0, total),
+		first:  make([]int32, 0, total),
+		land:   make([]bool, 0, total),
+	}
+	for k, local := range locals {
+		for _, p := range local.parent {
+			uf.parent = append(uf.parent, p+bases[k])
+		}
+		uf.size = append(uf.size, local.size...)
+		uf.first = append(uf.first, local.first...)
+		uf.land = append(uf.land, local.land...)
+	}
+	locals = nil
+
+	// Join components that continue across strip borders
+	for k := 1; k < len(strips); k++ {
+		row := strips[k].y0 * g.Width
+		for i := row; i < row+g.Width; i++ {
+			if g.tiles[i].isLand() == g.tiles[i-g.Width].isLand() {
+				uf.union(labels[i]+bases[k], labels[i-g.Width]+bases[k-1])
+			}
+		}
+	}
+
+	// Flatten in label order, so a parent is always resolved before its
+	// children, and number the roots
+	ids := make([]int32, total)
+	var components []component
+	for l := range uf.parent {
+		p := uf.parent[l]
+		if int(p) == l {
+			ids[l] = int32(len(components))
+			components = append(components, component{
+				land:  uf.land[l],
+				size:  int(uf.size[l]),
+				first: int(uf.first[l]),
+			})
+			continue
+		}
+		root := uf.parent[p]
+		uf.parent[l] = root
+		ids[l] = ids[root]
+		c := &components[ids[root]]
+		c.size += int(uf.size[l])
+		c.first = min(c.first, int(uf.first[l]))
+	}
+
+	forEachStrip(strips, func(k int, s strip) {
+		for i := s.y0 * g.Width; i < s.y1*g.Width; i++ {
+			labels[i] = ids[labels[i]+bases[k]]
+		}
+	})
+	return labeling{labels: labels, components: components}
+}
+
+// findComponents labels the grid in the way that suits its mode. update
+// calls fn for every tile whose component has mark set.
+func (g *Grid) findComponents() (components []component, update func(mark []bool, fn func(t *tile, id int32))) {
+	if g.lowMemory {
+		components, replay := g.labelRows()
+		return components, func(mark []bool, fn func(t *tile, id int32)) {
+			replay(func(y int, ids []int32) {
+				row := g.tiles[y*g.Width : (y+1)*g.Width]
+				for x, id := range ids {
+					if mark[id] {
+						fn(&row[x], id)
+					}
+				}
+			})
+		}
+	}
+	strips := g.workerStrips()
+	lab := g.labelComponents(strips)
+	return lab.components, func(mark []bool, fn func(t *tile, id int32)) {
+		lab.update(g, strips, mark, fn)
+	}
+}
+
+// update calls fn for every tile whose component has mark set, using the
+// same strips the labeling was made with.
+func (lab labeling) update(g *Grid, strips []strip, mark []bool, fn func(t *tile, id int32)) {
+	forEachStrip(strips, func(_ int, s strip) {
+		for i := s.y0 * g.Width; i < s.y1*g.Width; i++ {
+			if id := lab.labels[i]; mark[id] {
+				fn(&g.tiles[i], id)
+			}
+		}
+	})
+}
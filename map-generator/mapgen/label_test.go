@@ -0,0 +1,179 @@
+package mapgen
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+// floodComponents labels g with a plain breadth-first search, as the
+// reference for labelComponents.
+func floodComponents(g *Grid) labeling {
+	labels := make([]int32, len(g.tiles))
+	for i := range labels {
+		labels[i] = -1
+	}
+	var components []component
+	for start := range g.tiles {
+		if labels[start] >= 0 {
+			continue
+		}
+		id := int32(len(components))
+		land := g.tiles[start].isLand()
+		c := component{land: land, first: g.Width * g.Height}
+		labels[start] = id
+		q := newQueue(16)
+		q.push(start)
+		for q.len() > 0 {
+			i := q.pop()
+			c.size++
+			c.first = min(c.first, (i%g.Width)*g.Height+i/g.Width)
+			g.neighbors(i, func(n int) {
+				if labels[n] < 0 && g.tiles[n].isLand() == land {
+					labels[n] = id
+					q.push(n)
+				}
+			})
+		}
+		components = append(components, c)
+	}
+	return labeling{labels: labels, components: components}
+}
+
+// noiseGrid returns a grid where each tile is water with probability p,
+// giving many small components of both types.
+func noiseGrid(r *rand.Rand, width, height int, p float64) *Grid {
+	g := NewGrid(width, height)
+	for i := range g.tiles {
+		if r.Float64() >= p {
+			g.tiles[i] = tile{flags: tileLand}
+		}
+	}
+	return g
+}
+
+// sameLabeling checks that two labelings describe the same partition. The
+// component ids may differ, so they are matched through first.
+func sameLabeling(t *testing.T, want, got labeling) {
+	t.Helper()
+	if len(got.components) != len(want.components) {
+		t.Fatalf("got %d components, want %d", len(got.components), len(want.components))
+	}
+	byFirst := make(map[int]component)
+	for _, c := range want.components {
+		byFirst[c.first] = c
+	}
+	for _, c := range got.components {
+		if w, ok := byFirst[c.first]; !ok || w != c {
+			t.Fatalf("component %+v, want %+v", c, w)
+		}
+	}
+	for i := range want.labels {
+		w := want.components[want.labels[i]]
+		g := got.components[got.labels[i]]
+		if w.first != g.first {
+			t.Fatalf("tile %d is in the component starting at %d, want %d", i, g.first, w.first)
+		}
+	}
+}
+
+func TestLabelComponents(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	grids := []struct {
+		name string
+		g    *Grid
+	}{
+		{"single tile", gridFromRows("#")},
+		{"single column", gridFromRows("#", ".", ".", "#", "#")},
+		{"single row", gridFromRows("#..##.#")},
+		{"spiral", gridFromRows(
+			"#######",
+			"......#",
+			"#####.#",
+			"#...#.#",
+			"#.###.#",
+			"#.....#",
+			"#######",
+		)},
+		{"islands", func() *Grid {
+			img := randomMap(r, 97, 131)
+			return Classify(img)
+		}()},
+		{"sparse noise", noiseGrid(r, 120, 90, 0.2)},
+		{"dense noise", noiseGrid(r, 75, 140, 0.5)},
+	}
+	for _, f := range fixtures {
+		grids = append(grids, struct {
+			name string
+			g    *Grid
+		}{f.name, classifyFixture(t, f.name)})
+	}
+
+	for _, tt := range grids {
+		want := floodComponents(tt.g)
+		for _, workers := range []int{1, 2, 3, 8, 1000} {
+			t.Run(fmt.Sprintf("%s/%d workers", tt.name, workers), func(t *testing.T) {
+				sameLabeling(t, want, tt.g.labelComponents(splitRows(tt.g.Height, workers, 1)))
+			})
+		}
+	}
+}
+
+func TestSplitRows(t *testing.T) {
+	tests := []struct {
+		height, workers, minRows int
+		want                     int
+	}{
+		{100, 4, 1, 4},
+		{100, 4, 64, 1},
+		{200, 4, 64, 3},
+		{10, 1, 1, 1},
+		{0, 4, 64, 1},
+		{3, 8, 1, 3},
+	}
+	for _, tt := range tests {
+		strips := splitRows(tt.height, tt.workers, tt.minRows)
+		if len(strips) != tt.want {
+			t.Errorf("splitRows(%d, %d, %d) gave %d strips, want %d",
+				tt.height, tt.workers, tt.minRows, len(strips), tt.want)
+		}
+		y := 0
+		for _, s := range strips {
+			if s.y0 != y || s.y1 < s.y0 {
+				t.Errorf("splitRows(%d, %d, %d) = %v, not contiguous", tt.height, tt.workers, tt.minRows, strips)
+				break
+			}
+			y = s.y1
+		}
+		if y != tt.height {
+			t.Errorf("splitRows(%d, %d, %d) = %v, does not cover every row", tt.height, tt.workers, tt.minRows, strips)
+		}
+	}
+}
+
+// TestGenerateMapParallel checks that building with several strips gives the
+// same output as building with one.
+func TestGenerateMapParallel(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	data := encodePNG(t, randomMap(r, 300, 400))
+
+	generate := func(procs int) MapResult {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+		result, err := GenerateMap(GeneratorArgs{ImageBuffer: data, RemoveSmall: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	sequential := generate(1)
+	for _, procs := range []int{2, 5} {
+		parallel := generate(procs)
+		for i, lod := range parallel.LODs() {
+			if !bytes.Equal(lod.Info.Data, sequential.LODs()[i].Info.Data) {
+				t.Errorf("%d procs: %s differs from the sequential build", procs, lod.Key)
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package mapgen
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+)
+
+// LegendTerrain is what a legend entry turns a pixel into.
+type LegendTerrain uint8
+
+const (
+	LegendLand LegendTerrain = iota
+	// LegendWater is water that becomes ocean or a lake depending on the
+	// water body it is part of.
+	LegendWater
+	// LegendLake is water that is never ocean, even when it touches the
+	// ocean, and is never removed as a small lake.
+	LegendLake
+)
+
+// Channel selects a color channel of a pixel.
+type Channel uint8
+
+const (
+	ChannelNone Channel = iota
+	ChannelRed
+	ChannelGreen
+	ChannelBlue
+	ChannelAlpha
+)
+
+// LegendEntry matches pixels whose channels all lie within Min and Max,
+// inclusive, and classifies them as Terrain.
+type LegendEntry struct {
+	Terrain  LegendTerrain
+	Min, Max color.NRGBA
+	// Magnitude is the land elevation, 0-31, of matching pixels when
+	// MagnitudeChannel is ChannelNone.
+	Magnitude float64
+	// MagnitudeChannel, if set, takes the elevation from that channel of
+	// the pixel instead: MagnitudeRange[0] and below is 0 and
+	// MagnitudeRange[1] and above is 30, in steps of a half.
+	MagnitudeChannel Channel
+	MagnitudeRange   [2]uint8
+}
+
+// Legend maps the colors of a source image to terrain. Entries are tried
+// in order and the first match wins.
+type Legend struct {
+	Entries []LegendEntry
+	// Unmatched classifies pixels no entry matches. If nil they take the
+	// entry nearest to their color, the one whose bounds are off by the
+	// fewest levels in any channel.
+	Unmatched *LegendEntry
+}
+
+// DefaultLegend is the legend of the source images drawn for the game:
+// nearly transparent pixels and pixels with a blue value of 106 are water,
+// and everything else is land with an elevation taken from its blue value
+// in the 140-200 range.
+var DefaultLegend = Legend{
+	Entries: []LegendEntry{
+		{Terrain: LegendWater, Max: color.NRGBA{255, 255, 255, 19}},
+		{Terrain: LegendWater, Min: color.NRGBA{0, 0, 106, 0}, Max: color.NRGBA{255, 255, 106, 255}},
+		{Terrain: LegendLand, Min: color.NRGBA{0, 0, 140, 0}, Max: color.NRGBA{255, 255, 200, 255},
+			MagnitudeChannel: ChannelBlue, MagnitudeRange: [2]uint8{140, 200}},
+	},
+	Unmatched: &LegendEntry{Terrain: LegendLand, MagnitudeChannel: ChannelBlue, MagnitudeRange: [2]uint8{140, 200}},
+}
+
+// Validate reports entries that can never match or have no usable
+// magnitude.
+func (l *Legend) Validate() error {
+	if len(l.Entries) == 0 {
+		return errors.New("legend has no entries")
+	}
+	check := func(name string, e LegendEntry, bounds bool) error {
+		if bounds && (e.Min.R > e.Max.R || e.Min.G > e.Max.G || e.Min.B > e.Max.B || e.Min.A > e.Max.A) {
+			return fmt.Errorf("%s matches no color: its minimum is above its maximum", name)
+		}
+		if e.Terrain != LegendLand {
+			return nil
+		}
+		if e.MagnitudeChannel == ChannelNone && !(e.Magnitude >= 0 && e.Magnitude <= MaxLandMagnitude) {
+			return fmt.Errorf("%s has magnitude %v, want 0-%d", name, e.Magnitude, MaxLandMagnitude)
+		}
+		if e.MagnitudeChannel != ChannelNone && e.MagnitudeRange[0] >= e.MagnitudeRange[1] {
+			return fmt.Errorf("%s has an empty magnitude range %v", name, e.MagnitudeRange)
+		}
+		return nil
+	}
+	for i, e := range l.Entries {
+		if err := check(fmt.Sprintf("legend entry %d", i), e, true); err != nil {
+			return err
+		}
+	}
+	if l.Unmatched != nil {
+		return check("unmatched legend entry", *l.Unmatched, false)
+	}
+	return nil
+}
+
+func (e *LegendEntry) matches(c color.NRGBA) bool {
+	return c.R >= e.Min.R && c.R <= e.Max.R &&
+		c.G >= e.Min.G && c.G <= e.Max.G &&
+		c.B >= e.Min.B && c.B <= e.Max.B &&
+		c.A >= e.Min.A && c.A <= e.Max.A
+}
+
+// distance is how many levels c is off from the bounds of e in the channel
+// where it is off the most.
+func (e *LegendEntry) distance(c color.NRGBA) int {
+	off := func(v, lo, hi uint8) int {
+		return max(int(lo)-int(v), int(v)-int(hi), 0)
+	}
+	return max(off(c.R, e.Min.R, e.Max.R), off(c.G, e.Min.G, e.Max.G),
+		off(c.B, e.Min.B, e.Max.B), off(c.A, e.Min.A, e.Max.A))
+}
+
+// tile classifies a pixel as e.
+func (e *LegendEntry) tile(c color.NRGBA) tile {
+	switch e.Terrain {
+	case LegendWater:
+		return tile{}
+	case LegendLake:
+		return tile{flags: tileLake}
+	}
+	if e.MagnitudeChannel == ChannelNone {
+		return tileOf(Terrain{Type: Land, Magnitude: e.Magnitude})
+	}
+	var v uint8
+	switch e.MagnitudeChannel {
+	case ChannelRed:
+		v = c.R
+	case ChannelGreen:
+		v = c.G
+	case ChannelBlue:
+		v = c.B
+	case ChannelAlpha:
+		v = c.A
+	}
+	lo, hi := int(e.MagnitudeRange[0]), int(e.MagnitudeRange[1])
+	// 60 half units span the elevations 0-30
+	half := (min(hi, max(lo, int(v))) - lo) * 60 / (hi - lo)
+	return tile{flags: tileLand, magnitude: uint8(half)}
+}
+
+// classify returns the tile of a pixel and whether an entry matched it.
+func (l *Legend) classify(c color.NRGBA) (tile, bool) {
+	for i := range l.Entries {
+		if e := &l.Entries[i]; e.matches(c) {
+			return e.tile(c), true
+		}
+	}
+	if l.Unmatched != nil {
+		return l.Unmatched.tile(c), false
+	}
+	nearest := &l.Entries[0]
+	for i := range l.Entries[1:] {
+		if e := &l.Entries[i+1]; e.distance(c) < nearest.distance(c) {
+			nearest = e
+		}
+	}
+	return nearest.tile(c), false
+}
@@ -0,0 +1,180 @@
+package mapgen
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+// testLegend uses colors unlike the default legend's: dark blue is water
+// within a tolerance of 2, green is a lake, and red, with any alpha, is land
+// whose elevation comes from the green channel.
+var testLegend = Legend{
+	Entries: []LegendEntry{
+		{Terrain: LegendWater, Min: color.NRGBA{0, 0, 126, 0}, Max: color.NRGBA{2, 2, 130, 255}},
+		{Terrain: LegendLake, Min: color.NRGBA{0, 200, 0, 255}, Max: color.NRGBA{0, 200, 0, 255}},
+		{Terrain: LegendLand, Min: color.NRGBA{200, 0, 0, 0}, Max: color.NRGBA{255, 100, 0, 255},
+			MagnitudeChannel: ChannelGreen, MagnitudeRange: [2]uint8{0, 100}},
+		{Terrain: LegendLand, Min: color.NRGBA{128, 128, 128, 255}, Max: color.NRGBA{128, 128, 128, 255}, Magnitude: 7.5},
+	},
+}
+
+func TestLegendClassify(t *testing.T) {
+	tests := []struct {
+		name      string
+		legend    Legend
+		c         color.NRGBA
+		want      TerrainType
+		magnitude float64
+		lake      bool
+		matched   bool
+	}{
+		{"water", testLegend, color.NRGBA{0, 0, 128, 255}, Water, 0, false, true},
+		{"water within tolerance", testLegend, color.NRGBA{2, 1, 130, 255}, Water, 0, false, true},
+		{"lake", testLegend, color.NRGBA{0, 200, 0, 255}, Water, 0, true, true},
+		{"land from green", testLegend, color.NRGBA{255, 50, 0, 255}, Land, 15, false, true},
+		{"land from green, top", testLegend, color.NRGBA{220, 100, 0, 255}, Land, 30, false, true},
+		{"fixed magnitude", testLegend, color.NRGBA{128, 128, 128, 255}, Land, 7.5, false, true},
+		{"nearest is water", testLegend, color.NRGBA{4, 0, 128, 255}, Water, 0, false, false},
+		{"nearest is gray land", testLegend, color.NRGBA{120, 130, 128, 255}, Land, 7.5, false, false},
+		{"unmatched", Legend{Entries: testLegend.Entries, Unmatched: &LegendEntry{Terrain: LegendLand, Magnitude: 3}},
+			color.NRGBA{4, 0, 128, 255}, Land, 3, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tile, matched := tt.legend.classify(tt.c)
+			got := tile.terrain()
+			if got.Type != tt.want || got.Magnitude != tt.magnitude || (tile.flags&tileLake != 0) != tt.lake || matched != tt.matched {
+				t.Errorf("classify(%v) = type %d magnitude %v lake %v matched %v, want type %d magnitude %v lake %v matched %v",
+					tt.c, got.Type, got.Magnitude, tile.flags&tileLake != 0, matched, tt.want, tt.magnitude, tt.lake, tt.matched)
+			}
+		})
+	}
+}
+
+func TestLegendValidate(t *testing.T) {
+	if err := DefaultLegend.Validate(); err != nil {
+		t.Errorf("DefaultLegend: %v", err)
+	}
+	if err := testLegend.Validate(); err != nil {
+		t.Errorf("testLegend: %v", err)
+	}
+	// The same limit as heightmaps and DEMs
+	top := Legend{Entries: []LegendEntry{{Max: color.NRGBA{255, 255, 255, 255}, Magnitude: MaxLandMagnitude}}}
+	if err := top.Validate(); err != nil {
+		t.Errorf("magnitude %d: %v", MaxLandMagnitude, err)
+	}
+	for name, l := range map[string]Legend{
+		"no entries":      {},
+		"empty bounds":    {Entries: []LegendEntry{{Min: color.NRGBA{R: 10}, Max: color.NRGBA{R: 5, G: 255, B: 255, A: 255}}}},
+		"high magnitude":  {Entries: []LegendEntry{{Max: color.NRGBA{255, 255, 255, 255}, Magnitude: 32}}},
+		"empty range":     {Entries: []LegendEntry{{Max: color.NRGBA{255, 255, 255, 255}, MagnitudeChannel: ChannelRed}}},
+		"bad unmatched":   {Entries: testLegend.Entries, Unmatched: &LegendEntry{Magnitude: -1}},
+		"water range bad": {Entries: []LegendEntry{{Terrain: LegendWater, Min: color.NRGBA{A: 2}, Max: color.NRGBA{A: 1}}}},
+	} {
+		if err := l.Validate(); err == nil {
+			t.Errorf("%s: Validate succeeded", name)
+		}
+	}
+}
+
+// TestLegendLake checks that water the legend calls a lake is never ocean
+// and never removed, even where it touches the ocean or is small.
+func TestLegendLake(t *testing.T) {
+	water := color.NRGBA{0, 0, 128, 255}
+	lake := color.NRGBA{0, 200, 0, 255}
+	land := color.NRGBA{128, 128, 128, 255}
+
+	// Ocean on the left with a lake bay, land on the right holding a
+	// small lake
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			c := land
+			switch {
+			case x < 16:
+				c = water
+			case x < 20 && y < 4:
+				c = lake
+			case x >= 30 && x < 32 && y >= 10 && y < 12:
+				c = lake
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	g := testLegend.Classify(img)
+	ProcessWater(g, true)
+
+	for _, tc := range []struct {
+		x, y        int
+		want        TerrainType
+		ocean, lake bool
+	}{
+		{0, 0, Water, true, false},
+		{15, 0, Water, true, false},
+		{16, 0, Water, false, true},
+		{19, 3, Water, false, true},
+		{30, 10, Water, false, true},
+		{25, 15, Land, false, false},
+	} {
+		got := g.At(tc.x, tc.y)
+		isLake := g.tiles[tc.y*g.Width+tc.x].flags&tileLake != 0
+		if got.Type != tc.want || got.Ocean != tc.ocean || isLake != tc.lake {
+			t.Errorf("(%d, %d) = type %d ocean %v lake %v, want type %d ocean %v lake %v",
+				tc.x, tc.y, got.Type, got.Ocean, isLake, tc.want, tc.ocean, tc.lake)
+		}
+	}
+
+	// The packed output is the same as for any other lake
+	data, _ := PackTerrain(g)
+	if b := data[10*g.Width+30]; b&(LandBit|OceanBit) != 0 || b&^(ShorelineBit|MagnitudeMask) != 0 {
+		t.Errorf("lake packs to %08b", b)
+	}
+}
+
+func TestUnclassified(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 70, 9))
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 70; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{B: 106, A: 255})
+		}
+	}
+	// Off by one from water and beyond the land range, and one outside the
+	// cropped grid
+	want := map[Coord]bool{{3, 1}: true, {65, 2}: true, {0, 7}: true}
+	img.SetNRGBA(3, 1, color.NRGBA{B: 107, A: 255})
+	img.SetNRGBA(65, 2, color.NRGBA{B: 201, A: 255})
+	img.SetNRGBA(0, 7, color.NRGBA{B: 107, A: 255})
+	img.SetNRGBA(69, 8, color.NRGBA{B: 107, A: 255})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	streamed, err := ClassifyStream(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, g := range map[string]*Grid{"Classify": Classify(img), "ClassifyStream": streamed} {
+		u := g.Unclassified()
+		if u.Count != len(want) {
+			t.Errorf("%s: Count = %d, want %d", name, u.Count, len(want))
+		}
+		got := make(map[Coord]bool)
+		u.Each(func(x, y int) {
+			if !u.Has(x, y) {
+				t.Errorf("%s: Each visits (%d, %d) but Has is false", name, x, y)
+			}
+			got[Coord{x, y}] = true
+		})
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: unclassified pixels %v, want %v", name, got, want)
+		}
+	}
+	if u := Classify(image.NewNRGBA(image.Rect(0, 0, 4, 4))).Unclassified(); u.Count != 0 || u.Has(0, 0) {
+		t.Errorf("transparent image has unclassified pixels: %+v", u)
+	}
+}
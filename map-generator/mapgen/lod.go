@@ -0,0 +1,26 @@
+package mapgen
+
+// CreateMiniMap halves the grid in both dimensions. A mini tile takes the
+// last of its four source tiles in x, y order, unless one of them is water,
+// in which case it takes the first water tile.
+func CreateMiniMap(tm *Grid) *Grid {
+	miniMap := NewGrid(tm.Width/2, tm.Height/2)
+
+	for miniY := 0; miniY < miniMap.Height; miniY++ {
+		for miniX := 0; miniX < miniMap.Width; miniX++ {
+			i := 2*miniY*tm.Width + 2*miniX
+			// Column by column, as the original scan visited them
+			t := tm.tiles[i]
+			for _, j := range [3]int{i + tm.Width, i + 1, i + 1 + tm.Width} {
+				// If any of the 4 tiles has water, mini tile is water
+				if !t.isLand() {
+					break
+				}
+				t = tm.tiles[j]
+			}
+			miniMap.tiles[miniY*miniMap.Width+miniX] = t
+		}
+	}
+
+	return miniMap
+}
@@ -0,0 +1,72 @@
+package mapgen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateMiniMap(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []string
+		want []string
+	}{
+		{"all land", []string{"####", "####"}, []string{"##"}},
+		{"any water makes water", []string{
+			"#.##",
+			"####",
+			"####",
+			"###.",
+		}, []string{
+			".#",
+			"#.",
+		}},
+		{"odd size drops last row and column", []string{
+			"###",
+			"###",
+			"...",
+		}, []string{"#"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rowsFromGrid(CreateMiniMap(gridFromRows(tt.rows...)))
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestCreateMiniMapKeepsFirstWaterTile(t *testing.T) {
+	g := gridFromRows("..", "..")
+	g.Set(0, 0, Terrain{Type: Water, Magnitude: 3, Shoreline: true})
+	g.Set(1, 1, Terrain{Type: Water, Magnitude: 9, Ocean: true})
+
+	got := CreateMiniMap(g).At(0, 0)
+	if want := (Terrain{Type: Water, Magnitude: 3, Shoreline: true}); got != want {
+		t.Errorf("mini tile = %+v, want %+v", got, want)
+	}
+}
+
+func TestCreateMiniMapFixtures(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			g := classifyFixture(t, f.name)
+			ProcessWater(g, false)
+			g4 := CreateMiniMap(g)
+			g16 := CreateMiniMap(g4)
+			if g4.Width != f.width/2 || g4.Height != f.height/2 {
+				t.Errorf("map4x is %dx%d, want %dx%d", g4.Width, g4.Height, f.width/2, f.height/2)
+			}
+			if g16.Width != f.width/4 || g16.Height != f.height/4 {
+				t.Errorf("map16x is %dx%d, want %dx%d", g16.Width, g16.Height, f.width/4, f.height/4)
+			}
+			if land := g4.CountLand(); land != f.land4x {
+				t.Errorf("map4x has %d land tiles, want %d", land, f.land4x)
+			}
+			if land := g16.CountLand(); land != f.land16x {
+				t.Errorf("map16x has %d land tiles, want %d", land, f.land16x)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+// Package mapgen turns a map source image into the packed terrain binaries
+// and thumbnail used by the game.
+//
+// GenerateMap runs the whole pipeline. The stages are also exported so they
+// can be run and tested on their own:
+//
+//	Decode -> Classify -> RemoveSmallIslands -> ProcessWater
+//	       -> CreateMiniMap (x2) -> PackTerrain / CreateMapThumbnail
+//
+// Maps drawn from a heightmap start with HeightmapFromImage or DecodeRaw,
+// SetWaterMask and Heightmap.Classify instead of Decode and Classify, and
+// those drawn from an elevation model with DecodeDEM, SetSeaLevel and
+// Resample.
+//
+// The stages don't log; GenerateMap logs each one at debug level and
+// reports how long it took.
+package mapgen
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"time"
+)
+
+const (
+	// MinIslandSize is the smallest land body kept when small features are
+	// removed.
+	MinIslandSize = 30
+	// MinLakeSize is the smallest lake kept when small features are removed.
+	MinLakeSize = 200
+)
+
+type MapResult struct {
+	Thumbnail []byte
+	Map       MapInfo
+	Map4x     MapInfo
+	Map16x    MapInfo
+	// Unclassified are the source pixels the legend didn't match.
+	Unclassified Unclassified
+	// Timings lists the stages of GenerateMap in the order they ran.
+	Timings []StageTiming
+}
+
+// StageTiming is how long one stage of GenerateMap took. The stages are
+// decode, islands, water, shore, distance, lods, thumbnail and pack.
+type StageTiming struct {
+	Stage    string
+	Duration time.Duration
+}
+
+// LOD pairs a level of detail with the manifest key it is stored under.
+type LOD struct {
+	Key  string
+	Info MapInfo
+}
+
+// LODs returns the levels of detail from full resolution down.
+func (r MapResult) LODs() []LOD {
+	return []LOD{{"map", r.Map}, {"map4x", r.Map4x}, {"map16x", r.Map16x}}
+}
+
+type MapInfo struct {
+	Data         []byte
+	Width        int
+	Height       int
+	NumLandTiles int
+}
+
+type GeneratorArgs struct {
+	Name        string
+	ImageBuffer []byte
+	RemoveSmall bool
+	// Legend maps the colors of the image to terrain. Nil means
+	// DefaultLegend.
+	Legend *Legend
+	// Heightmap, if set, is the source instead of ImageBuffer. Its
+	// elevations become land magnitudes through HeightCurve, or
+	// DefaultHeightCurve if that is nil.
+	Heightmap   *Heightmap
+	HeightCurve HeightCurve
+	// Stream decodes the image in strips and labels components row by row
+	// (see ClassifyStream), which needs a fraction of the memory for very
+	// large maps but is slower. The output is the same. Only PNG images can
+	// be decoded in strips; other sources are decoded whole.
+	Stream bool
+	// MapWriter, if set, receives map.bin as it is packed instead of it
+	// being returned in MapResult.Map.Data.
+	MapWriter io.Writer
+	// Logger receives the progress of every stage at debug level, with the
+	// map name attached. Nil means slog.Default().
+	Logger *slog.Logger
+}
+
+func GenerateMap(args GeneratorArgs) (MapResult, error) {
+	logger := args.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if args.Name != "" {
+		logger = logger.With("map", args.Name)
+	}
+
+	var result MapResult
+	start := time.Now()
+	// stage records the time since the previous stage finished
+	stage := func(name string, attrs ...any) {
+		now := time.Now()
+		result.Timings = append(result.Timings, StageTiming{name, now.Sub(start)})
+		logger.Debug("Stage finished", append([]any{"stage", name, "duration", now.Sub(start)}, attrs...)...)
+		start = now
+	}
+
+	terrain, err := decodeAndClassify(args)
+	if err != nil {
+		return MapResult{}, err
+	}
+	result.Unclassified = terrain.Unclassified()
+	stage("decode", "width", terrain.Width, "height", terrain.Height, "stream", args.Stream,
+		"unclassified", result.Unclassified.Count)
+
+	removed := RemoveSmallIslands(terrain, args.RemoveSmall)
+	stage("islands", "removed", removed, "min_size", MinIslandSize)
+	water := processWaterBodies(terrain, args.RemoveSmall)
+	stage("water", "ocean_tiles", water.OceanTiles, "lakes_removed", water.LakesRemoved, "min_size", MinLakeSize)
+	shorelineWaters := ProcessShore(terrain)
+	stage("shore", "shoreline_water_tiles", len(shorelineWaters))
+	ProcessDistToLand(shorelineWaters, terrain)
+	stage("distance")
+
+	terrain4x := CreateMiniMap(terrain)
+	terrain16x := CreateMiniMap(terrain4x)
+	stage("lods")
+
+	thumb := CreateMapThumbnail(terrain4x, 0.5)
+	result.Thumbnail, err = ConvertToWebP(ThumbData{
+		Data:   thumb.Pix,
+		Width:  thumb.Bounds().Dx(),
+		Height: thumb.Bounds().Dy(),
+	})
+	if err != nil {
+		return MapResult{}, fmt.Errorf("failed to save thumbnail: %w", err)
+	}
+	stage("thumbnail")
+
+	result.Map = MapInfo{Width: terrain.Width, Height: terrain.Height}
+	if args.MapWriter != nil {
+		result.Map.NumLandTiles, err = WritePacked(args.MapWriter, terrain)
+		if err != nil {
+			return MapResult{}, fmt.Errorf("failed to write map: %w", err)
+		}
+	} else {
+		result.Map = packInfo(terrain)
+	}
+	result.Map4x = packInfo(terrain4x)
+	result.Map16x = packInfo(terrain16x)
+	stage("pack", "land_tiles", result.Map.NumLandTiles)
+
+	return result, nil
+}
+
+func decodeAndClassify(args GeneratorArgs) (*Grid, error) {
+	if args.Heightmap != nil {
+		curve := args.HeightCurve
+		if curve == nil {
+			curve = DefaultHeightCurve
+		} else if err := curve.Validate(); err != nil {
+			return nil, err
+		}
+		terrain := args.Heightmap.Classify(curve)
+		if terrain.Width == 0 || terrain.Height == 0 {
+			return nil, fmt.Errorf("heightmap is %dx%d, maps must be at least 4x4 pixels", args.Heightmap.Width, args.Heightmap.Height)
+		}
+		terrain.lowMemory = args.Stream
+		return terrain, nil
+	}
+
+	legend := args.Legend
+	if legend == nil {
+		legend = &DefaultLegend
+	} else if err := legend.Validate(); err != nil {
+		return nil, err
+	}
+
+	var terrain *Grid
+	if args.Stream && isPNG(args.ImageBuffer) {
+		var err error
+		if terrain, err = legend.ClassifyStream(bytes.NewReader(args.ImageBuffer)); err != nil {
+			return nil, err
+		}
+	} else {
+		img, err := Decode(args.ImageBuffer)
+		if err != nil {
+			return nil, err
+		}
+		terrain = legend.Classify(img)
+		terrain.lowMemory = args.Stream
+	}
+	if terrain.Width == 0 || terrain.Height == 0 {
+		cfg, _, _ := image.DecodeConfig(bytes.NewReader(args.ImageBuffer))
+		return nil, fmt.Errorf("image is %dx%d, maps must be at least 4x4 pixels", cfg.Width, cfg.Height)
+	}
+	return terrain, nil
+}
+
+func packInfo(terrain *Grid) MapInfo {
+	data, numLandTiles := PackTerrain(terrain)
+	return MapInfo{
+		Data:         data,
+		Width:        terrain.Width,
+		Height:       terrain.Height,
+		NumLandTiles: numLandTiles,
+	}
+}
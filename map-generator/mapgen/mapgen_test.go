@@ -0,0 +1,163 @@
+package mapgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixtures are the maps in assets/test_maps, built without removing small
+// islands and lakes like the generator does for test maps.
+var fixtures = []struct {
+	name          string
+	width, height int
+	land          int
+	land4x        int
+	land16x       int
+}{
+	{"plains", 100, 100, 10000, 2500, 625},
+	{"big_plains", 200, 200, 40000, 10000, 2500},
+	{"half_land_half_ocean", 16, 16, 128, 32, 8},
+	{"ocean_and_land", 16, 16, 134, 33, 8},
+}
+
+func readFixture(t testing.TB, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "assets", "test_maps", name, "image.png"))
+	if err != nil {
+		t.Fatalf("failed to read fixture %s: %v", name, err)
+	}
+	return data
+}
+
+// classifyFixture decodes and classifies a fixture.
+func classifyFixture(t testing.TB, name string) *Grid {
+	t.Helper()
+	img, err := Decode(readFixture(t, name))
+	if err != nil {
+		t.Fatalf("Decode(%s): %v", name, err)
+	}
+	return Classify(img)
+}
+
+// gridFromRows builds a grid from rows of '#' (land) and '.' (water).
+func gridFromRows(rows ...string) *Grid {
+	g := NewGrid(len(rows[0]), len(rows))
+	for y, row := range rows {
+		for x, c := range row {
+			if c == '#' {
+				g.Set(x, y, Terrain{Type: Land})
+			} else {
+				g.Set(x, y, Terrain{Type: Water})
+			}
+		}
+	}
+	return g
+}
+
+// rowsFromGrid is the inverse of gridFromRows.
+func rowsFromGrid(g *Grid) []string {
+	rows := make([]string, g.Height)
+	for y := range rows {
+		var b strings.Builder
+		for x := 0; x < g.Width; x++ {
+			if g.At(x, y).Type == Land {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		rows[y] = b.String()
+	}
+	return rows
+}
+
+func TestGenerateMap(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			result, err := GenerateMap(GeneratorArgs{Name: f.name, ImageBuffer: readFixture(t, f.name)})
+			if err != nil {
+				t.Fatalf("GenerateMap: %v", err)
+			}
+			want := []struct {
+				key           string
+				width, height int
+				land          int
+			}{
+				{"map", f.width, f.height, f.land},
+				{"map4x", f.width / 2, f.height / 2, f.land4x},
+				{"map16x", f.width / 4, f.height / 4, f.land16x},
+			}
+			lods := result.LODs()
+			if len(lods) != len(want) {
+				t.Fatalf("got %d LODs, want %d", len(lods), len(want))
+			}
+			for i, w := range want {
+				got := lods[i]
+				if got.Key != w.key || got.Info.Width != w.width || got.Info.Height != w.height || got.Info.NumLandTiles != w.land {
+					t.Errorf("LOD %d = %s %dx%d with %d land, want %s %dx%d with %d land",
+						i, got.Key, got.Info.Width, got.Info.Height, got.Info.NumLandTiles,
+						w.key, w.width, w.height, w.land)
+				}
+				if len(got.Info.Data) != w.width*w.height {
+					t.Errorf("%s has %d bytes, want %d", w.key, len(got.Info.Data), w.width*w.height)
+				}
+			}
+			if len(result.Thumbnail) == 0 {
+				t.Error("empty thumbnail")
+			}
+		})
+	}
+}
+
+func TestGenerateMapLogsStages(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	result, err := GenerateMap(GeneratorArgs{
+		Name:        "ocean_and_land",
+		ImageBuffer: readFixture(t, "ocean_and_land"),
+		Logger:      logger,
+	})
+	if err != nil {
+		t.Fatalf("GenerateMap: %v", err)
+	}
+
+	stages := []string{"decode", "islands", "water", "shore", "distance", "lods", "thumbnail", "pack"}
+	if len(result.Timings) != len(stages) {
+		t.Fatalf("got %d timings, want %d", len(result.Timings), len(stages))
+	}
+	for i, timing := range result.Timings {
+		if timing.Stage != stages[i] || timing.Duration < 0 {
+			t.Errorf("timing %d = %s %v, want stage %s", i, timing.Stage, timing.Duration, stages[i])
+		}
+	}
+
+	var logged []string
+	dec := json.NewDecoder(&logs)
+	for dec.More() {
+		var record struct {
+			Map   string `json:"map"`
+			Stage string `json:"stage"`
+		}
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Map != "ocean_and_land" {
+			t.Errorf("record for stage %q has map %q", record.Stage, record.Map)
+		}
+		logged = append(logged, record.Stage)
+	}
+	if strings.Join(logged, " ") != strings.Join(stages, " ") {
+		t.Errorf("logged stages %v, want %v", logged, stages)
+	}
+}
+
+func TestGenerateMapInvalidImage(t *testing.T) {
+	if _, err := GenerateMap(GeneratorArgs{Name: "broken", ImageBuffer: []byte("not a png")}); err == nil {
+		t.Fatal("GenerateMap succeeded on invalid input")
+	}
+}
@@ -0,0 +1,85 @@
+package mapgen
+
+// Bit layout of a packed tile in map.bin, map4x.bin and map16x.bin.
+const (
+	LandBit       = 0b10000000
+	ShorelineBit  = 0b01000000
+	OceanBit      = 0b00100000
+	MagnitudeMask = 0b00011111
+)
+
+// MaxLandMagnitude is the largest land elevation the packed map holds.
+const MaxLandMagnitude = MagnitudeMask
+
+// PackTerrain encodes the grid one byte per tile, row by row, and counts the
+// land tiles. Land keeps its magnitude; water stores half its distance to
+// land. Both are capped at 31.
+func PackTerrain(terrain *Grid) (data []byte, numLandTiles int) {
+	packedData := make([]byte, len(terrain.tiles))
+	numLandTiles = 0
+
+	for i, t := range terrain.tiles {
+		if t.isLand() {
+			numLandTiles++
+		}
+		packedData[i] = packTile(t)
+	}
+
+	return packedData, numLandTiles
+}
+
+func packTile(t tile) byte {
+	var packedByte byte = 0
+
+	if t.isLand() {
+		packedByte |= LandBit
+	}
+	if t.flags&tileShoreline != 0 {
+		packedByte |= ShorelineBit
+	}
+	if t.flags&tileOcean != 0 {
+		packedByte |= OceanBit
+	}
+
+	// Rounded up from half units: ceil(magnitude) for land and
+	// ceil(magnitude / 2) for water
+	if t.isLand() {
+		packedByte |= byte(min((int(t.magnitude)+1)/2, 31))
+	} else {
+		packedByte |= byte(min((int(t.magnitude)+3)/4, 31))
+	}
+	return packedByte
+}
+
+// PackedMap is a decoded map*.bin: one packed byte per tile, row by row.
+type PackedMap struct {
+	Width, Height int
+	Data          []byte
+	// NumLandTiles is the count recorded in manifest.json
+	NumLandTiles int
+}
+
+func (m PackedMap) IsLand(i int) bool      { return m.Data[i]&LandBit != 0 }
+func (m PackedMap) IsShoreline(i int) bool { return m.Data[i]&ShorelineBit != 0 }
+func (m PackedMap) IsOcean(i int) bool     { return m.Data[i]&OceanBit != 0 }
+func (m PackedMap) Magnitude(i int) int    { return int(m.Data[i] & MagnitudeMask) }
+
+// Neighbors returns the indices of the four tiles around i, with -1 for
+// those outside the map.
+func (m PackedMap) Neighbors(i int) [4]int {
+	x, y := i%m.Width, i/m.Width
+	n := [4]int{-1, -1, -1, -1}
+	if x > 0 {
+		n[0] = i - 1
+	}
+	if x < m.Width-1 {
+		n[1] = i + 1
+	}
+	if y > 0 {
+		n[2] = i - m.Width
+	}
+	if y < m.Height-1 {
+		n[3] = i + m.Width
+	}
+	return n
+}
@@ -0,0 +1,88 @@
+package mapgen
+
+import "testing"
+
+func TestPackTerrain(t *testing.T) {
+	tests := []struct {
+		name string
+		tile Terrain
+		want byte
+	}{
+		{"plain land", Terrain{Type: Land}, LandBit},
+		{"land magnitude", Terrain{Type: Land, Magnitude: 15}, LandBit | 15},
+		{"land magnitude rounds up", Terrain{Type: Land, Magnitude: 15.5}, LandBit | 16},
+		{"land magnitude capped", Terrain{Type: Land, Magnitude: 40}, LandBit | 31},
+		{"shoreline land", Terrain{Type: Land, Shoreline: true, Magnitude: 2}, LandBit | ShorelineBit | 2},
+		{"shoreline ocean", Terrain{Type: Water, Shoreline: true, Ocean: true}, ShorelineBit | OceanBit},
+		{"water distance halved", Terrain{Type: Water, Ocean: true, Magnitude: 9}, OceanBit | 5},
+		{"water distance capped", Terrain{Type: Water, Magnitude: 100}, 31},
+		{"lake", Terrain{Type: Water, Magnitude: 2}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGrid(1, 1)
+			g.Set(0, 0, tt.tile)
+			data, land := PackTerrain(g)
+			if data[0] != tt.want {
+				t.Errorf("packed %+v as %08b, want %08b", tt.tile, data[0], tt.want)
+			}
+			if wantLand := tt.want&LandBit != 0; (land == 1) != wantLand {
+				t.Errorf("numLandTiles = %d", land)
+			}
+		})
+	}
+}
+
+func TestPackTerrainRowMajor(t *testing.T) {
+	g := gridFromRows(
+		"#..",
+		"..#",
+	)
+	data, land := PackTerrain(g)
+	want := []bool{true, false, false, false, false, true}
+	if len(data) != len(want) {
+		t.Fatalf("got %d bytes, want %d", len(data), len(want))
+	}
+	for i, isLand := range want {
+		if (data[i]&LandBit != 0) != isLand {
+			t.Errorf("byte %d = %08b, want land %v", i, data[i], isLand)
+		}
+	}
+	if land != 2 {
+		t.Errorf("numLandTiles = %d, want 2", land)
+	}
+}
+
+func TestPackedMap(t *testing.T) {
+	m := PackedMap{
+		Width:  3,
+		Height: 2,
+		Data: []byte{
+			LandBit | 7, LandBit | ShorelineBit, ShorelineBit | OceanBit,
+			LandBit, OceanBit | 3, 2,
+		},
+	}
+	tests := []struct {
+		i                      int
+		land, shoreline, ocean bool
+		magnitude              int
+		neighbors              [4]int
+	}{
+		{0, true, false, false, 7, [4]int{-1, 1, -1, 3}},
+		{1, true, true, false, 0, [4]int{0, 2, -1, 4}},
+		{2, false, true, true, 0, [4]int{1, -1, -1, 5}},
+		{4, false, false, true, 3, [4]int{3, 5, 1, -1}},
+		{5, false, false, false, 2, [4]int{4, -1, 2, -1}},
+	}
+	for _, tt := range tests {
+		if m.IsLand(tt.i) != tt.land || m.IsShoreline(tt.i) != tt.shoreline ||
+			m.IsOcean(tt.i) != tt.ocean || m.Magnitude(tt.i) != tt.magnitude {
+			t.Errorf("tile %d = land %v shoreline %v ocean %v magnitude %d, want %v %v %v %d",
+				tt.i, m.IsLand(tt.i), m.IsShoreline(tt.i), m.IsOcean(tt.i), m.Magnitude(tt.i),
+				tt.land, tt.shoreline, tt.ocean, tt.magnitude)
+		}
+		if got := m.Neighbors(tt.i); got != tt.neighbors {
+			t.Errorf("Neighbors(%d) = %v, want %v", tt.i, got, tt.neighbors)
+		}
+	}
+}
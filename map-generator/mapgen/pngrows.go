@@ -0,0 +1,323 @@
+package mapgen
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+)
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// pngRows reads a non-interlaced PNG a strip of rows at a time. Rows are
+// inflated and unfiltered here, then handed to image/png as a small
+// stand-alone PNG, so the pixels come out exactly as png.Decode would
+// return them for the whole image.
+type pngRows struct {
+	r             *bufio.Reader
+	ihdr          []byte
+	width, height int
+	interlaced    bool
+	// palette and transparency chunks, copied into every strip
+	extra []pngChunk
+
+	// length of the IDAT chunk the reader stopped at
+	firstIDAT uint32
+
+	// bytes per row without the filter byte, and per pixel for filtering
+	rowBytes, filterBytes int
+	idat                  *idatReader
+	z                     io.ReadCloser
+	cur, prev             []byte
+	row                   int
+}
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readPNGHeader reads everything up to the data of the first IDAT chunk.
+func readPNGHeader(r io.Reader) (*pngRows, error) {
+	p := &pngRows{r: bufio.NewReader(r)}
+	sig := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(p.r, sig); err != nil || string(sig) != pngSignature {
+		return nil, errors.New("failed to decode PNG: not a PNG file")
+	}
+
+	for {
+		length, typ, err := p.chunkHeader()
+		if err != nil {
+			return nil, err
+		}
+		if typ == "IDAT" {
+			if p.ihdr == nil {
+				return nil, errors.New("failed to decode PNG: IDAT before IHDR")
+			}
+			p.firstIDAT = length
+			return p, nil
+		}
+		data, err := p.chunkData(typ, length)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case "IHDR":
+			if err := p.parseIHDR(data); err != nil {
+				return nil, err
+			}
+		case "PLTE", "tRNS":
+			p.extra = append(p.extra, pngChunk{typ, data})
+		case "IEND":
+			return nil, errors.New("failed to decode PNG: no image data")
+		}
+	}
+}
+
+func (p *pngRows) chunkHeader() (uint32, string, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(p.r, hdr[:]); err != nil {
+		return 0, "", fmt.Errorf("failed to decode PNG: %w", err)
+	}
+	return binary.BigEndian.Uint32(hdr[:4]), string(hdr[4:]), nil
+}
+
+// chunkData reads a whole chunk body and checks its CRC.
+func (p *pngRows) chunkData(typ string, length uint32) ([]byte, error) {
+	if length > 1<<26 {
+		return nil, fmt.Errorf("failed to decode PNG: %s chunk of %d bytes", typ, length)
+	}
+	data := make([]byte, length+4)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return nil, fmt.Errorf("failed to decode PNG: %w", err)
+	}
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data[:length])
+	if crc.Sum32() != binary.BigEndian.Uint32(data[length:]) {
+		return nil, fmt.Errorf("failed to decode PNG: invalid checksum in %s chunk", typ)
+	}
+	return data[:length], nil
+}
+
+func (p *pngRows) parseIHDR(data []byte) error {
+	if len(data) != 13 {
+		return errors.New("failed to decode PNG: bad IHDR length")
+	}
+	p.ihdr = data
+	w, h := binary.BigEndian.Uint32(data[0:4]), binary.BigEndian.Uint32(data[4:8])
+	if w == 0 || h == 0 || w > 1<<24 || h > 1<<24 {
+		return fmt.Errorf("failed to decode PNG: invalid image size %dx%d", w, h)
+	}
+	p.width, p.height = int(w), int(h)
+	depth, colorType := int(data[8]), data[9]
+	p.interlaced = data[12] != 0
+
+	channels := map[byte]int{0: 1, 2: 3, 3: 1, 4: 2, 6: 4}[colorType]
+	if channels == 0 {
+		return fmt.Errorf("failed to decode PNG: unsupported color type %d", colorType)
+	}
+	bitsPerPixel := channels * depth
+	p.rowBytes = (p.width*bitsPerPixel + 7) / 8
+	p.filterBytes = max(1, bitsPerPixel/8)
+	return nil
+}
+
+// startRows starts inflating the image data.
+func (p *pngRows) startRows() error {
+	crc := crc32.NewIEEE()
+	crc.Write([]byte("IDAT"))
+	p.idat = &idatReader{p: p, remaining: p.firstIDAT, crc: crc}
+	z, err := zlib.NewReader(p.idat)
+	if err != nil {
+		return fmt.Errorf("failed to decode PNG: %w", err)
+	}
+	p.z = z
+	p.cur = make([]byte, 1+p.rowBytes)
+	p.prev = make([]byte, 1+p.rowBytes)
+	return nil
+}
+
+// whole returns the complete PNG again, for images that can't be read by
+// rows. Chunks that image/png ignores are left out.
+func (p *pngRows) whole() io.Reader {
+	var head bytes.Buffer
+	head.WriteString(pngSignature)
+	writePNGChunk(&head, "IHDR", p.ihdr)
+	for _, c := range p.extra {
+		writePNGChunk(&head, c.typ, c.data)
+	}
+	var idat [8]byte
+	binary.BigEndian.PutUint32(idat[:4], p.firstIDAT)
+	copy(idat[4:], "IDAT")
+	head.Write(idat[:])
+	return io.MultiReader(&head, p.r)
+}
+
+// idatReader presents consecutive IDAT chunks as one stream.
+type idatReader struct {
+	p         *pngRows
+	remaining uint32
+	crc       hash.Hash32
+	done      bool
+}
+
+func (d *idatReader) Read(b []byte) (int, error) {
+	for d.remaining == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		var sum [4]byte
+		if _, err := io.ReadFull(d.p.r, sum[:]); err != nil {
+			return 0, err
+		}
+		if d.crc.Sum32() != binary.BigEndian.Uint32(sum[:]) {
+			return 0, errors.New("invalid checksum in IDAT chunk")
+		}
+		length, typ, err := d.p.chunkHeader()
+		if err != nil {
+			return 0, err
+		}
+		if typ != "IDAT" {
+			d.done = true
+			return 0, io.EOF
+		}
+		d.remaining = length
+		d.crc.Reset()
+		d.crc.Write([]byte(typ))
+	}
+	if uint32(len(b)) > d.remaining {
+		b = b[:d.remaining]
+	}
+	n, err := d.p.r.Read(b)
+	d.crc.Write(b[:n])
+	d.remaining -= uint32(n)
+	return n, err
+}
+
+// nextRow inflates and unfilters the next row into p.cur[1:].
+func (p *pngRows) nextRow() error {
+	p.cur, p.prev = p.prev, p.cur
+	if _, err := io.ReadFull(p.z, p.cur); err != nil {
+		return fmt.Errorf("failed to decode PNG row %d: %w", p.row, err)
+	}
+	cdat, pdat, bpp := p.cur[1:], p.prev[1:], p.filterBytes
+	switch p.cur[0] {
+	case 0:
+	case 1: // Sub
+		for i := bpp; i < len(cdat); i++ {
+			cdat[i] += cdat[i-bpp]
+		}
+	case 2: // Up
+		for i := range cdat {
+			cdat[i] += pdat[i]
+		}
+	case 3: // Average
+		for i := range cdat {
+			left := 0
+			if i >= bpp {
+				left = int(cdat[i-bpp])
+			}
+			cdat[i] += uint8((left + int(pdat[i])) / 2)
+		}
+	case 4: // Paeth
+		for i := range cdat {
+			var a, c int
+			if i >= bpp {
+				a, c = int(cdat[i-bpp]), int(pdat[i-bpp])
+			}
+			cdat[i] += uint8(paeth(a, int(pdat[i]), c))
+		}
+	default:
+		return fmt.Errorf("failed to decode PNG: bad filter type %d in row %d", p.cur[0], p.row)
+	}
+	p.cur[0] = 0
+	p.row++
+	return nil
+}
+
+func paeth(a, b, c int) int {
+	pa, pb, pc := abs(b-c), abs(a-c), abs(a+b-2*c)
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// finish reads the rows that weren't decoded and the rest of the image
+// data, so the zlib and chunk checksums are verified like png.Decode does.
+func (p *pngRows) finish() error {
+	for p.row < p.height {
+		if err := p.nextRow(); err != nil {
+			return err
+		}
+	}
+	n, err := io.Copy(io.Discard, p.z)
+	if err != nil {
+		return fmt.Errorf("failed to decode PNG: %w", err)
+	}
+	if n > 0 {
+		return errors.New("failed to decode PNG: too much pixel data")
+	}
+	// zlib stops at its checksum, before the CRC of the last IDAT chunk
+	if _, err := io.Copy(io.Discard, p.idat); err != nil {
+		return fmt.Errorf("failed to decode PNG: %w", err)
+	}
+	return nil
+}
+
+// readStrip decodes the next n rows as an image n rows high.
+func (p *pngRows) readStrip(n int) (image.Image, error) {
+	var idat bytes.Buffer
+	zw, _ := zlib.NewWriterLevel(&idat, zlib.NoCompression)
+	for i := 0; i < n; i++ {
+		if err := p.nextRow(); err != nil {
+			return nil, err
+		}
+		// Unfiltered rows are stored with filter type 0
+		zw.Write(p.cur)
+	}
+	zw.Close()
+
+	var buf bytes.Buffer
+	buf.WriteString(pngSignature)
+	ihdr := append([]byte(nil), p.ihdr...)
+	binary.BigEndian.PutUint32(ihdr[4:8], uint32(n))
+	writePNGChunk(&buf, "IHDR", ihdr)
+	for _, c := range p.extra {
+		writePNGChunk(&buf, c.typ, c.data)
+	}
+	writePNGChunk(&buf, "IDAT", idat.Bytes())
+	writePNGChunk(&buf, "IEND", nil)
+	return png.Decode(&buf)
+}
+
+func writePNGChunk(w *bytes.Buffer, typ string, data []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(data)))
+	w.Write(n[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	w.WriteString(typ)
+	w.Write(data)
+	binary.BigEndian.PutUint32(n[:], crc.Sum32())
+	w.Write(n[:])
+}
@@ -0,0 +1,166 @@
+package mapgen
+
+import (
+	"bufio"
+	"fmt"
+	"image/png"
+	"io"
+)
+
+// stripRows is how many image rows ClassifyStream decodes at a time.
+const stripRows = 256
+
+// ClassifyStream is Classify for a PNG that is decoded a strip of rows at a
+// time, so the decoded image is never held in memory as a whole. Interlaced
+// images can't be split into rows and are decoded whole.
+//
+// The grid it returns is in low memory mode: RemoveSmallIslands and
+// ProcessWater label it with two rows of component labels instead of one
+// label per tile, at the cost of scanning it twice and on one goroutine.
+func ClassifyStream(r io.Reader) (*Grid, error) {
+	return DefaultLegend.ClassifyStream(r)
+}
+
+// ClassifyStream is ClassifyStream with the colors of legend l.
+func (l *Legend) ClassifyStream(r io.Reader) (*Grid, error) {
+	rows, err := readPNGHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var terrain *Grid
+	if rows.interlaced {
+		img, err := png.Decode(rows.whole())
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode PNG: %w", err)
+		}
+		terrain = l.Classify(img)
+	} else {
+		if err := rows.startRows(); err != nil {
+			return nil, err
+		}
+		terrain = NewGrid(rows.width-rows.width%4, rows.height-rows.height%4)
+		for y := 0; y < terrain.Height; y += stripRows {
+			n := min(stripRows, terrain.Height-y)
+			strip, err := rows.readStrip(n)
+			if err != nil {
+				return nil, err
+			}
+			terrain.classifyRows(strip, l, y, n)
+		}
+		if err := rows.finish(); err != nil {
+			return nil, err
+		}
+	}
+	terrain.lowMemory = true
+	return terrain, nil
+}
+
+// labelRows is the low memory counterpart of labelComponents. It finds the
+// components in one scan, keeping only the labels of the previous row.
+// replay scans the grid again, assigning the same labels, and calls visit
+// with the component index of every tile one row at a time.
+func (g *Grid) labelRows() (components []component, replay func(visit func(y int, ids []int32))) {
+	w, h := g.Width, g.Height
+	prev, cur := make([]int32, w), make([]int32, w)
+	uf := unionFind{}
+
+	for y := 0; y < h; y++ {
+		row := g.tiles[y*w : (y+1)*w]
+		for x, t := range row {
+			land := t.isLand()
+			order := int32(x*h + y)
+
+			l := int32(-1)
+			if x > 0 && row[x-1].isLand() == land {
+				l = cur[x-1]
+			}
+			if y > 0 && g.tiles[(y-1)*w+x].isLand() == land {
+				if up := prev[x]; l < 0 {
+					l = up
+				} else if up != l {
+					l = uf.union(l, up)
+				}
+			}
+			if l < 0 {
+				l = uf.add(land, order)
+			}
+			cur[x] = l
+			uf.size[l]++
+			if order < uf.first[l] {
+				uf.first[l] = order
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	// Flatten in label order as labelComponents does
+	ids := make([]int32, len(uf.parent))
+	for l := range uf.parent {
+		p := uf.parent[l]
+		if int(p) == l {
+			ids[l] = int32(len(components))
+			components = append(components, component{
+				land:  uf.land[l],
+				size:  int(uf.size[l]),
+				first: int(uf.first[l]),
+			})
+			continue
+		}
+		root := uf.parent[p]
+		uf.parent[l] = root
+		ids[l] = ids[root]
+		c := &components[ids[root]]
+		c.size += int(uf.size[l])
+		c.first = min(c.first, int(uf.first[l]))
+	}
+	uf = unionFind{}
+
+	replay = func(visit func(y int, ids []int32)) {
+		// A tile joins the component of its left or upper neighbour when
+		// it has the same type, and otherwise starts the next label,
+		// exactly as in the first scan.
+		// visit may change the row, so the row above is compared as it
+		// was before the visit.
+		above := make([]tile, w)
+		next := 0
+		for y := 0; y < h; y++ {
+			row := g.tiles[y*w : (y+1)*w]
+			for x, t := range row {
+				land := t.isLand()
+				switch {
+				case x > 0 && row[x-1].isLand() == land:
+					cur[x] = cur[x-1]
+				case y > 0 && above[x].isLand() == land:
+					cur[x] = prev[x]
+				default:
+					cur[x] = ids[next]
+					next++
+				}
+			}
+			copy(above, row)
+			visit(y, cur)
+			prev, cur = cur, prev
+		}
+	}
+	return components, replay
+}
+
+// WritePacked writes the grid to w in the packed format of PackTerrain, one
+// row at a time, and returns the number of land tiles.
+func WritePacked(w io.Writer, terrain *Grid) (numLandTiles int, err error) {
+	bw := bufio.NewWriter(w)
+	row := make([]byte, terrain.Width)
+	for y := 0; y < terrain.Height; y++ {
+		for x, t := range terrain.tiles[y*terrain.Width : (y+1)*terrain.Width] {
+			row[x] = packTile(t)
+			if t.isLand() {
+				numLandTiles++
+			}
+		}
+		if _, err := bw.Write(row); err != nil {
+			return 0, err
+		}
+	}
+	return numLandTiles, bw.Flush()
+}
@@ -0,0 +1,258 @@
+package mapgen
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"testing"
+)
+
+// encodings draws the same random map into every image type png.Encode
+// handles, which between them produce each PNG color type and bit depth the
+// encoder writes.
+func encodings(r *rand.Rand, width, height int) map[string]image.Image {
+	src := randomMap(r, width, height)
+	// Some transparent and semi-transparent pixels
+	for i := 0; i < width*height/10; i++ {
+		x, y := r.Intn(width), r.Intn(height)
+		c := src.NRGBAAt(x, y)
+		c.A = uint8(r.Intn(256))
+		src.SetNRGBA(x, y, c)
+	}
+	opaque := image.NewNRGBA(src.Bounds())
+	gray := image.NewGray(src.Bounds())
+	gray16 := image.NewGray16(src.Bounds())
+	rgba := image.NewRGBA(src.Bounds())
+	nrgba64 := image.NewNRGBA64(src.Bounds())
+	rgba64 := image.NewRGBA64(src.Bounds())
+	palette := color.Palette{
+		color.NRGBA{B: 106, A: 255}, color.NRGBA{B: 150, A: 255},
+		color.NRGBA{B: 180, A: 255}, color.NRGBA{B: 200, A: 128}, color.NRGBA{},
+	}
+	paletted := image.NewPaletted(src.Bounds(), palette)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := src.NRGBAAt(x, y)
+			opaque.SetNRGBA(x, y, color.NRGBA{c.R, c.G, c.B, 255})
+			gray.SetGray(x, y, color.Gray{c.B})
+			gray16.SetGray16(x, y, color.Gray16{uint16(c.B)<<8 | uint16(r.Intn(256))})
+			rgba.Set(x, y, c)
+			nrgba64.Set(x, y, c)
+			rgba64.Set(x, y, c)
+			paletted.Set(x, y, c)
+		}
+	}
+	return map[string]image.Image{
+		"nrgba": src, "opaque": opaque, "gray": gray, "gray16": gray16,
+		"rgba": rgba, "nrgba64": nrgba64, "rgba64": rgba64, "paletted": paletted,
+	}
+}
+
+func sameGrid(t *testing.T, want, got *Grid) {
+	t.Helper()
+	if want.Width != got.Width || want.Height != got.Height {
+		t.Fatalf("grid is %dx%d, want %dx%d", got.Width, got.Height, want.Width, want.Height)
+	}
+	for i := range want.tiles {
+		if want.tiles[i] != got.tiles[i] {
+			t.Fatalf("tile (%d, %d) = %+v, want %+v", i%want.Width, i/want.Width, got.tiles[i], want.tiles[i])
+		}
+	}
+}
+
+func TestClassifyStream(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	// Taller than stripRows, so rows are split across strips, and not a
+	// multiple of 4 in either direction
+	for name, img := range encodings(r, 83, 2*stripRows+7) {
+		t.Run(name, func(t *testing.T) {
+			data := encodePNG(t, img)
+			decoded, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ClassifyStream(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("ClassifyStream: %v", err)
+			}
+			sameGrid(t, Classify(decoded), got)
+			if !got.lowMemory {
+				t.Error("grid is not in low memory mode")
+			}
+		})
+	}
+}
+
+// interlace encodes an 8-bit grayscale image as an Adam7 interlaced PNG,
+// which png.Encode can't write.
+func interlace(t *testing.T, img *image.Gray) []byte {
+	passes := []struct{ x0, y0, dx, dy int }{
+		{0, 0, 8, 8}, {4, 0, 8, 8}, {0, 4, 4, 8}, {2, 0, 4, 4}, {0, 2, 2, 4}, {1, 0, 2, 2}, {0, 1, 1, 2},
+	}
+	b := img.Bounds()
+	var raw bytes.Buffer
+	for _, p := range passes {
+		for y := p.y0; y < b.Dy(); y += p.dy {
+			if p.x0 >= b.Dx() {
+				break
+			}
+			raw.WriteByte(0)
+			for x := p.x0; x < b.Dx(); x += p.dx {
+				raw.WriteByte(img.GrayAt(x, y).Y)
+			}
+		}
+	}
+	var idat bytes.Buffer
+	zw := zlib.NewWriter(&idat)
+	zw.Write(raw.Bytes())
+	zw.Close()
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(b.Dy()))
+	ihdr[8], ihdr[12] = 8, 1
+	var out bytes.Buffer
+	out.WriteString(pngSignature)
+	writePNGChunk(&out, "IHDR", ihdr)
+	writePNGChunk(&out, "IDAT", idat.Bytes())
+	writePNGChunk(&out, "IEND", nil)
+	return out.Bytes()
+}
+
+func TestClassifyStreamInterlaced(t *testing.T) {
+	r := rand.New(rand.NewSource(6))
+	img := encodings(r, 21, 30)["gray"].(*image.Gray)
+	data := interlace(t, img)
+
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("test image does not decode: %v", err)
+	}
+	got, err := ClassifyStream(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ClassifyStream: %v", err)
+	}
+	sameGrid(t, Classify(decoded), got)
+}
+
+func TestClassifyStreamErrors(t *testing.T) {
+	data := encodePNG(t, randomMap(rand.New(rand.NewSource(7)), 40, 40))
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)/2] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not a png", []byte("not a png at all")},
+		{"header only", data[:40]},
+		{"truncated", data[:len(data)-30]},
+		{"corrupt", corrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ClassifyStream(bytes.NewReader(tt.data)); err == nil {
+				t.Error("ClassifyStream succeeded")
+			}
+		})
+	}
+}
+
+func TestLabelRows(t *testing.T) {
+	r := rand.New(rand.NewSource(8))
+	grids := map[string]*Grid{
+		"islands":     Classify(randomMap(r, 90, 70)),
+		"dense noise": noiseGrid(r, 64, 48, 0.5),
+		"single row":  gridFromRows("#..##.#"),
+		"spiral": gridFromRows(
+			"#######",
+			"......#",
+			"#####.#",
+			"#...#.#",
+			"#.###.#",
+			"#.....#",
+			"#######",
+		),
+	}
+	for name, g := range grids {
+		t.Run(name, func(t *testing.T) {
+			components, replay := g.labelRows()
+			got := labeling{labels: make([]int32, len(g.tiles)), components: components}
+			replay(func(y int, ids []int32) {
+				copy(got.labels[y*g.Width:], ids)
+			})
+			sameLabeling(t, floodComponents(g), got)
+		})
+	}
+}
+
+func TestGenerateMapStream(t *testing.T) {
+	r := rand.New(rand.NewSource(9))
+	images := map[string][]byte{
+		"islands": encodePNG(t, randomMap(r, 300, 2*stripRows+40)),
+		"noise":   encodePNG(t, imageFromBytes(bytes.Repeat([]byte{106, 255, 150, 255, 150, 255}, 4000), 120)),
+	}
+	for _, f := range fixtures {
+		images[f.name] = readFixture(t, f.name)
+	}
+
+	for name, data := range images {
+		for _, removeSmall := range []bool{false, true} {
+			want, err := GenerateMap(GeneratorArgs{ImageBuffer: data, RemoveSmall: removeSmall})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var mapBin bytes.Buffer
+			got, err := GenerateMap(GeneratorArgs{ImageBuffer: data, RemoveSmall: removeSmall, Stream: true, MapWriter: &mapBin})
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if got.Map.Data != nil {
+				t.Errorf("%s: map data returned as well as written", name)
+			}
+			if !bytes.Equal(mapBin.Bytes(), want.Map.Data) {
+				t.Errorf("%s (remove small %v): streamed map.bin differs", name, removeSmall)
+			}
+			got.Map.Data = mapBin.Bytes()
+			for i, lod := range got.LODs() {
+				w := want.LODs()[i].Info
+				if lod.Info.Width != w.Width || lod.Info.Height != w.Height || lod.Info.NumLandTiles != w.NumLandTiles ||
+					!bytes.Equal(lod.Info.Data, w.Data) {
+					t.Errorf("%s (remove small %v): %s differs", name, removeSmall, lod.Key)
+				}
+			}
+			if !bytes.Equal(got.Thumbnail, want.Thumbnail) {
+				t.Errorf("%s (remove small %v): thumbnail differs", name, removeSmall)
+			}
+		}
+	}
+}
+
+// FuzzClassifyStream checks that streaming decodes any PNG that image/png
+// accepts to the same grid.
+func FuzzClassifyStream(f *testing.F) {
+	r := rand.New(rand.NewSource(10))
+	for _, img := range encodings(r, 12, 9) {
+		f.Add(encodePNG(f, img))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		cfg, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil || cfg.Width*cfg.Height > maxFuzzPixels {
+			return
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		got, streamErr := ClassifyStream(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if streamErr != nil {
+			t.Fatalf("png.Decode succeeded but ClassifyStream failed: %v", streamErr)
+		}
+		sameGrid(t, Classify(img), got)
+	})
+}
@@ -0,0 +1,119 @@
+package mapgen
+
+import "math"
+
+type TerrainType int
+
+const (
+	Land TerrainType = iota
+	Water
+)
+
+// Terrain is the expanded form of a tile, as read from and written to a Grid.
+type Terrain struct {
+	Type      TerrainType
+	Shoreline bool
+	// Magnitude is the elevation of land (0-31) or the distance of water to
+	// land in tiles. A Grid stores it rounded up to the next half, capped at
+	// 127.5, which is more than any stage or output format needs.
+	Magnitude float64
+	Ocean     bool
+}
+
+type Coord struct {
+	X, Y int
+}
+
+// Flags of a tile.
+const (
+	tileLand uint8 = 1 << iota
+	tileShoreline
+	tileOcean
+	// tileLake marks water a legend classified as a lake, which is never
+	// ocean. It is not part of the packed tile.
+	tileLake
+)
+
+// maxHalfMagnitude is the largest magnitude a tile can hold, in half units.
+const maxHalfMagnitude = math.MaxUint8
+
+// tile is the compact form of Terrain stored in a Grid.
+type tile struct {
+	flags uint8
+	// magnitude in half units, so that land elevations, which come in
+	// steps of 0.5, are stored exactly
+	magnitude uint8
+}
+
+// BytesPerTile is the memory a Grid uses per tile.
+const BytesPerTile = 2
+
+func (t tile) isLand() bool { return t.flags&tileLand != 0 }
+
+func (t tile) terrain() Terrain {
+	tt := Terrain{
+		Type:      Water,
+		Shoreline: t.flags&tileShoreline != 0,
+		Ocean:     t.flags&tileOcean != 0,
+		Magnitude: float64(t.magnitude) / 2,
+	}
+	if t.isLand() {
+		tt.Type = Land
+	}
+	return tt
+}
+
+func tileOf(t Terrain) tile {
+	var c tile
+	if t.Type == Land {
+		c.flags |= tileLand
+	}
+	if t.Shoreline {
+		c.flags |= tileShoreline
+	}
+	if t.Ocean {
+		c.flags |= tileOcean
+	}
+	// NaN and negative magnitudes end up as 0
+	if half := math.Ceil(t.Magnitude * 2); half > 0 {
+		c.magnitude = uint8(math.Min(half, maxHalfMagnitude))
+	}
+	return c
+}
+
+// Grid is a width x height map of terrain tiles addressed by x, y. Tiles are
+// stored row by row in a single slice, the same order as the packed output.
+type Grid struct {
+	Width, Height int
+	tiles         []tile
+	// lowMemory trades speed for memory in the later stages, see
+	// ClassifyStream
+	lowMemory bool
+	// unclassified marks the tiles whose source pixel no legend entry
+	// matched; nil if there are none
+	unclassified    bitset
+	numUnclassified int
+}
+
+func NewGrid(width, height int) *Grid {
+	return &Grid{Width: width, Height: height, tiles: make([]tile, width*height)}
+}
+
+func (g *Grid) At(x, y int) Terrain {
+	return g.tiles[y*g.Width+x].terrain()
+}
+
+func (g *Grid) Set(x, y int, t Terrain) {
+	g.tiles[y*g.Width+x] = tileOf(t)
+}
+
+// CountLand returns the number of land tiles in the grid.
+func (g *Grid) CountLand() int {
+	n := 0
+	for _, t := range g.tiles {
+		if t.isLand() {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,124 @@
+package mapgen
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/chai2010/webp"
+)
+
+type ThumbData struct {
+	Data   []byte
+	Width  int
+	Height int
+}
+
+type RGBA struct {
+	R, G, B, A uint8
+}
+
+// CreateMapThumbnail renders the grid scaled by quality with nearest
+// neighbour sampling. An empty grid gives an empty image.
+func CreateMapThumbnail(terrain *Grid, quality float64) *image.RGBA {
+	srcWidth, srcHeight := terrain.Width, terrain.Height
+	if srcWidth == 0 || srcHeight == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0))
+	}
+
+	targetWidth := int(math.Max(1, math.Floor(float64(srcWidth)*quality)))
+	targetHeight := int(math.Max(1, math.Floor(float64(srcHeight)*quality)))
+
+	img := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+
+	for x := 0; x < targetWidth; x++ {
+		for y := 0; y < targetHeight; y++ {
+			srcX := int(math.Floor(float64(x) / quality))
+			srcY := int(math.Floor(float64(y) / quality))
+
+			srcX = int(math.Min(float64(srcX), float64(srcWidth-1)))
+			srcY = int(math.Min(float64(srcY), float64(srcHeight-1)))
+
+			rgba := ThumbnailColor(terrain.tiles[srcY*srcWidth+srcX].terrain())
+			img.Set(x, y, color.RGBA{R: rgba.R, G: rgba.G, B: rgba.B, A: rgba.A})
+		}
+	}
+
+	return img
+}
+
+// ThumbnailColor returns the thumbnail color of a tile. Water is fully
+// transparent so the game's background shows through.
+func ThumbnailColor(t Terrain) RGBA {
+	if t.Type == Water {
+		// Shoreline water
+		if t.Shoreline {
+			return RGBA{R: 100, G: 143, B: 255, A: 0}
+		}
+		// Other water: adjust based on magnitude
+		waterAdjRGB := 11 - math.Min(t.Magnitude/2, 10) - 10
+		return RGBA{
+			R: uint8(math.Max(70+waterAdjRGB, 0)),
+			G: uint8(math.Max(132+waterAdjRGB, 0)),
+			B: uint8(math.Max(180+waterAdjRGB, 0)),
+			A: 0,
+		}
+	}
+
+	// Shoreline land
+	if t.Shoreline {
+		return RGBA{R: 204, G: 203, B: 158, A: 255}
+	}
+
+	var adjRGB float64
+	if t.Magnitude < 10 {
+		// Plains
+		adjRGB = 220 - 2*t.Magnitude
+		return RGBA{
+			R: 190,
+			G: uint8(adjRGB),
+			B: 138,
+			A: 255,
+		}
+	} else if t.Magnitude < 20 {
+		// Highlands
+		adjRGB = 2 * t.Magnitude
+		return RGBA{
+			R: uint8(200 + adjRGB),
+			G: uint8(183 + adjRGB),
+			B: uint8(138 + adjRGB),
+			A: 255,
+		}
+	} else {
+		// Mountains
+		adjRGB = math.Floor(230 + t.Magnitude/2)
+		return RGBA{
+			R: uint8(adjRGB),
+			G: uint8(adjRGB),
+			B: uint8(adjRGB),
+			A: 255,
+		}
+	}
+}
+
+func ConvertToWebP(thumb ThumbData) ([]byte, error) {
+	// Create RGBA image from raw data
+	img := image.NewRGBA(image.Rect(0, 0, thumb.Width, thumb.Height))
+
+	// Copy the raw RGBA data
+	if len(thumb.Data) != thumb.Width*thumb.Height*4 {
+		return nil, fmt.Errorf("invalid thumb data length: expected %d, got %d",
+			thumb.Width*thumb.Height*4, len(thumb.Data))
+	}
+
+	copy(img.Pix, thumb.Data)
+
+	// Encode as WebP with quality 45 (equivalent to the JavaScript version)
+	webpData, err := webp.EncodeRGBA(img, 45)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode WebP: %w", err)
+	}
+
+	return webpData, nil
+}
@@ -0,0 +1,81 @@
+package mapgen
+
+import "testing"
+
+func TestThumbnailColor(t *testing.T) {
+	tests := []struct {
+		name string
+		tile Terrain
+		want RGBA
+	}{
+		{"shoreline water", Terrain{Type: Water, Shoreline: true}, RGBA{100, 143, 255, 0}},
+		{"shallow water", Terrain{Type: Water, Magnitude: 0}, RGBA{71, 133, 181, 0}},
+		{"deep water", Terrain{Type: Water, Magnitude: 40}, RGBA{61, 123, 171, 0}},
+		{"shoreline land", Terrain{Type: Land, Shoreline: true, Magnitude: 25}, RGBA{204, 203, 158, 255}},
+		{"plains", Terrain{Type: Land, Magnitude: 5}, RGBA{190, 210, 138, 255}},
+		{"highlands", Terrain{Type: Land, Magnitude: 10}, RGBA{220, 203, 158, 255}},
+		{"mountains", Terrain{Type: Land, Magnitude: 20}, RGBA{240, 240, 240, 255}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ThumbnailColor(tt.tile); got != tt.want {
+				t.Errorf("ThumbnailColor(%+v) = %v, want %v", tt.tile, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateMapThumbnail(t *testing.T) {
+	tests := []struct {
+		name                  string
+		width, height         int
+		quality               float64
+		wantWidth, wantHeight int
+	}{
+		{"half", 8, 4, 0.5, 4, 2},
+		{"full", 8, 4, 1, 8, 4},
+		{"never empty", 2, 2, 0.1, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := CreateMapThumbnail(NewGrid(tt.width, tt.height), tt.quality)
+			if b := img.Bounds(); b.Dx() != tt.wantWidth || b.Dy() != tt.wantHeight {
+				t.Errorf("thumbnail is %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestCreateMapThumbnailFixtures(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			g := classifyFixture(t, f.name)
+			ProcessWater(g, false)
+			g4 := CreateMiniMap(g)
+			img := CreateMapThumbnail(g4, 0.5)
+
+			if b := img.Bounds(); b.Dx() != f.width/4 || b.Dy() != f.height/4 {
+				t.Fatalf("thumbnail is %dx%d, want %dx%d", b.Dx(), b.Dy(), f.width/4, f.height/4)
+			}
+			// Every thumbnail pixel samples every other map4x tile
+			for x := 0; x < img.Bounds().Dx(); x++ {
+				for y := 0; y < img.Bounds().Dy(); y++ {
+					want := ThumbnailColor(g4.At(x*2, y*2))
+					got := img.RGBAAt(x, y)
+					if got.R != want.R || got.G != want.G || got.B != want.B || got.A != want.A {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+			if _, err := ConvertToWebP(ThumbData{Data: img.Pix, Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}); err != nil {
+				t.Errorf("ConvertToWebP: %v", err)
+			}
+		})
+	}
+}
+
+func TestConvertToWebPRejectsShortData(t *testing.T) {
+	if _, err := ConvertToWebP(ThumbData{Data: make([]byte, 10), Width: 2, Height: 2}); err == nil {
+		t.Error("ConvertToWebP accepted 10 bytes for a 2x2 image")
+	}
+}
@@ -0,0 +1,129 @@
+package mapgen
+
+// WaterStats describes the water bodies found by ProcessWater.
+type WaterStats struct {
+	// OceanTiles is the size of the ocean, zero if the map has no water.
+	OceanTiles int
+	// LakesRemoved is the number of lakes turned into land.
+	LakesRemoved int
+}
+
+// ProcessWater marks the largest water body as ocean, optionally turns lakes
+// smaller than MinLakeSize into land, and then sets shorelines and the
+// distance of every water tile to land.
+func ProcessWater(terrain *Grid, removeSmall bool) WaterStats {
+	stats := processWaterBodies(terrain, removeSmall)
+	shorelineWaters := ProcessShore(terrain)
+	ProcessDistToLand(shorelineWaters, terrain)
+	return stats
+}
+
+// processWaterBodies is the part of ProcessWater before shorelines.
+func processWaterBodies(terrain *Grid, removeSmall bool) WaterStats {
+	var stats WaterStats
+	components, update := terrain.findComponents()
+
+	// The largest water body is the ocean. Of equally large bodies the one
+	// found first in a column by column scan wins, as it always has.
+	ocean := -1
+	for id, body := range components {
+		if body.land {
+			continue
+		}
+		if ocean < 0 || body.size > components[ocean].size ||
+			body.size == components[ocean].size && body.first < components[ocean].first {
+			ocean = id
+		}
+	}
+
+	if ocean >= 0 {
+		stats.OceanTiles = components[ocean].size
+
+		mark := make([]bool, len(components))
+		mark[ocean] = true
+		if removeSmall {
+			// Remove small water bodies
+			for id, body := range components {
+				if !body.land && id != ocean && body.size < MinLakeSize {
+					stats.LakesRemoved++
+					mark[id] = true
+				}
+			}
+		}
+
+		// Mark the ocean and fill in the small lakes, leaving out water
+		// the legend says is a lake
+		update(mark, func(t *tile, id int32) {
+			switch {
+			case t.flags&tileLake != 0:
+			case int(id) == ocean:
+				t.flags |= tileOcean
+			default:
+				*t = tile{flags: tileLand}
+			}
+		})
+	}
+	return stats
+}
+
+// ProcessShore marks land tiles next to water and water tiles next to land
+// as shoreline, and returns the shoreline water tiles.
+func ProcessShore(terrain *Grid) []Coord {
+	var shorelineWaters []Coord
+	tiles := terrain.tiles
+
+	for i := range tiles {
+		land := tiles[i].isLand()
+		shore := false
+		terrain.neighbors(i, func(n int) {
+			if tiles[n].isLand() != land {
+				shore = true
+			}
+		})
+		if !shore {
+			continue
+		}
+		// Land tile adjacent to water or water tile adjacent to land
+		tiles[i].flags |= tileShoreline
+		if !land {
+			shorelineWaters = append(shorelineWaters, Coord{X: i % terrain.Width, Y: i / terrain.Width})
+		}
+	}
+
+	return shorelineWaters
+}
+
+// ProcessDistToLand sets the magnitude of every water tile reachable from
+// shorelineWaters to its Manhattan distance from the nearest land.
+func ProcessDistToLand(shorelineWaters []Coord, terrain *Grid) {
+	tiles := terrain.tiles
+	visited := newBitset(len(tiles))
+	q := newQueue(len(shorelineWaters))
+
+	// Initialize queue with shoreline waters
+	for _, coord := range shorelineWaters {
+		i := coord.Y*terrain.Width + coord.X
+		if visited.has(i) {
+			continue
+		}
+		visited.add(i)
+		tiles[i].magnitude = 0
+		q.push(i)
+	}
+
+	for q.len() > 0 {
+		current := q.pop()
+		// Magnitudes are in half units; distances past the cap stay capped
+		dist := int(tiles[current].magnitude) + 2
+		if dist > maxHalfMagnitude {
+			dist = maxHalfMagnitude
+		}
+		terrain.neighbors(current, func(n int) {
+			if !visited.has(n) && !tiles[n].isLand() {
+				visited.add(n)
+				tiles[n].magnitude = uint8(dist)
+				q.push(n)
+			}
+		})
+	}
+}
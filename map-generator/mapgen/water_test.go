@@ -0,0 +1,175 @@
+package mapgen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProcessWater(t *testing.T) {
+	// A 14x14 lake of 196 tiles inside a land ring, next to a larger ocean
+	lakeMap := func(lakeSize int) []string {
+		width := lakeSize + 2
+		rows := []string{strings.Repeat("#", width) + strings.Repeat(".", 20)}
+		for y := 0; y < lakeSize; y++ {
+			rows = append(rows, "#"+strings.Repeat(".", lakeSize)+"#"+strings.Repeat(".", 20))
+		}
+		return append(rows, strings.Repeat("#", width)+strings.Repeat(".", 20))
+	}
+
+	tests := []struct {
+		name        string
+		rows        []string
+		removeSmall bool
+		wantOcean   int
+		wantLake    int
+		wantLand    int
+	}{
+		{"no water", []string{"####", "####"}, true, 0, 0, 8},
+		{"all water", []string{"....", "...."}, true, 8, 0, 0},
+		{"largest body is ocean", []string{
+			"..#...",
+			"..#...",
+		}, false, 6, 4, 2},
+		{"small lake kept", lakeMap(14), false, 320, 196, 60},
+		{"small lake removed", lakeMap(14), true, 320, 0, 256},
+		{"lake of minimum size kept", []string{
+			strings.Repeat("#", 202),
+			"#" + strings.Repeat(".", MinLakeSize) + "#",
+			strings.Repeat("#", 202),
+			strings.Repeat(".", 202),
+			strings.Repeat(".", 202),
+		}, true, 404, MinLakeSize, 406},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gridFromRows(tt.rows...)
+			ProcessWater(g, tt.removeSmall)
+
+			var ocean, lake, land int
+			for x := 0; x < g.Width; x++ {
+				for y := 0; y < g.Height; y++ {
+					tile := g.At(x, y)
+					switch {
+					case tile.Type == Land:
+						land++
+						if tile.Ocean {
+							t.Errorf("land tile (%d, %d) is marked ocean", x, y)
+						}
+					case tile.Ocean:
+						ocean++
+					default:
+						lake++
+					}
+				}
+			}
+			if ocean != tt.wantOcean || lake != tt.wantLake || land != tt.wantLand {
+				t.Errorf("got %d ocean, %d lake and %d land tiles, want %d, %d and %d",
+					ocean, lake, land, tt.wantOcean, tt.wantLake, tt.wantLand)
+			}
+		})
+	}
+}
+
+func TestProcessWaterFixtures(t *testing.T) {
+	tests := []struct {
+		name                          string
+		ocean                         int
+		landShoreline, waterShoreline int
+	}{
+		{"plains", 0, 0, 0},
+		{"half_land_half_ocean", 128, 16, 16},
+		{"ocean_and_land", 122, 21, 23},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := classifyFixture(t, tt.name)
+			ProcessWater(g, false)
+
+			var ocean, landShoreline, waterShoreline int
+			for x := 0; x < g.Width; x++ {
+				for y := 0; y < g.Height; y++ {
+					tile := g.At(x, y)
+					if tile.Ocean {
+						ocean++
+					}
+					if tile.Shoreline && tile.Type == Land {
+						landShoreline++
+					}
+					if tile.Shoreline && tile.Type == Water {
+						waterShoreline++
+					}
+				}
+			}
+			if ocean != tt.ocean || landShoreline != tt.landShoreline || waterShoreline != tt.waterShoreline {
+				t.Errorf("got %d ocean, %d land shoreline and %d water shoreline tiles, want %d, %d and %d",
+					ocean, landShoreline, waterShoreline, tt.ocean, tt.landShoreline, tt.waterShoreline)
+			}
+		})
+	}
+}
+
+func TestProcessShore(t *testing.T) {
+	g := gridFromRows(
+		"##..",
+		"##..",
+		"....",
+	)
+	shorelineWaters := ProcessShore(g)
+
+	want := []string{
+		".LW.",
+		"LLW.",
+		"WW..",
+	}
+	for y, row := range want {
+		for x, c := range row {
+			tile := g.At(x, y)
+			wantShore := c == 'L' || c == 'W'
+			if tile.Shoreline != wantShore {
+				t.Errorf("(%d, %d) shoreline = %v, want %v", x, y, tile.Shoreline, wantShore)
+			}
+		}
+	}
+	wantCoords := map[Coord]bool{{2, 0}: true, {2, 1}: true, {0, 2}: true, {1, 2}: true}
+	if len(shorelineWaters) != len(wantCoords) {
+		t.Fatalf("got %d shoreline waters %v, want %d", len(shorelineWaters), shorelineWaters, len(wantCoords))
+	}
+	for _, c := range shorelineWaters {
+		if !wantCoords[c] {
+			t.Errorf("unexpected shoreline water %v", c)
+		}
+	}
+}
+
+func TestProcessDistToLand(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []string
+		want [][]float64
+	}{
+		{"strip", []string{"#....."}, [][]float64{{0, 0, 1, 2, 3, 4}}},
+		{"between two coasts", []string{"#.....#"}, [][]float64{{0, 0, 1, 2, 1, 0, 0}}},
+		{"manhattan distance", []string{
+			"#..",
+			"...",
+			"...",
+		}, [][]float64{
+			{0, 0, 1},
+			{0, 1, 2},
+			{1, 2, 3},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gridFromRows(tt.rows...)
+			ProcessDistToLand(ProcessShore(g), g)
+			for y, row := range tt.want {
+				for x, want := range row {
+					if got := g.At(x, y).Magnitude; got != want {
+						t.Errorf("(%d, %d) magnitude = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// stagingInfix marks the temporary directories a map's output is written to
+// before it replaces the previous output: .<name>.staging-<random>. They are
+// hidden so the game never lists them as maps.
+const stagingInfix = ".staging-"
+
+// stagedDir collects a map's output files next to the output directory they
+// will replace, so a failed build never leaves a mix of old and new files.
+type stagedDir struct {
+	dir       string
+	committed bool
+}
+
+// newStagedDir creates a staging directory for map name in baseDir. Staging
+// directories left behind by an interrupted run are removed first, which is
+// safe because the caller holds the output lock.
+func newStagedDir(baseDir, name string) (*stagedDir, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory %s: %w", baseDir, err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(baseDir, "."+name+stagingInfix+"*"))
+	for _, dir := range leftovers {
+		slog.Warn("Removing output left by an interrupted build", "map", name, "dir", dir)
+		os.RemoveAll(dir)
+	}
+
+	dir, err := os.MkdirTemp(baseDir, "."+name+stagingInfix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory for %s: %w", name, err)
+	}
+	// MkdirTemp makes the directory private to the user
+	if err := os.Chmod(dir, 0755); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create staging directory for %s: %w", name, err)
+	}
+	return &stagedDir{dir: dir}, nil
+}
+
+// create opens a file in the staging directory for writing.
+func (s *stagedDir) create(name string) (*os.File, error) {
+	return os.Create(filepath.Join(s.dir, name))
+}
+
+// writeFile writes a file to the staging directory and flushes it to disk.
+func (s *stagedDir) writeFile(name string, data []byte) error {
+	f, err := s.create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// commit moves the staged output to target, replacing what is there. Where
+// replaceDir can swap the two directories atomically, target always holds
+// either the complete old or the complete new output; otherwise there is a
+// moment where it doesn't exist, see renameAside.
+func (s *stagedDir) commit(target string) error {
+	old := ""
+	if _, err := os.Lstat(target); err == nil {
+		if old, err = replaceDir(s.dir, target); err != nil {
+			return fmt.Errorf("failed to replace output: %w", err)
+		}
+	} else if err := os.Rename(s.dir, target); err != nil {
+		return fmt.Errorf("failed to replace output: %w", err)
+	}
+	s.committed = true
+	if old != "" {
+		if err := os.RemoveAll(old); err != nil {
+			slog.Warn("Failed to remove previous output", "dir", old, "err", err)
+		}
+	}
+	return nil
+}
+
+// renameAside replaces the directory target with staged using two renames,
+// for systems and file systems that can't swap them atomically. The previous
+// output is moved aside first and put back if the second rename fails, but
+// between the two renames target doesn't exist, and a reader may find it
+// missing. It returns where the previous output was moved.
+func renameAside(staged, target string) (string, error) {
+	old := staged + ".old"
+	if err := os.Rename(target, old); err != nil {
+		return "", fmt.Errorf("failed to move previous output aside: %w", err)
+	}
+	if err := os.Rename(staged, target); err != nil {
+		if restoreErr := os.Rename(old, target); restoreErr != nil {
+			return "", fmt.Errorf("%w; previous output is in %s", err, old)
+		}
+		return "", err
+	}
+	return old, nil
+}
+
+// discard removes the staging directory unless it was committed.
+func (s *stagedDir) discard() {
+	if !s.committed {
+		os.RemoveAll(s.dir)
+	}
+}
+
+// isStagingDir reports whether name is a staging directory, or previous
+// output moved aside by commit.
+func isStagingDir(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, stagingInfix)
+}
+
+// outputLock keeps concurrent runs from writing to the same output
+// directories. The lock files live in the system temp directory, one per
+// output directory, so they don't show up next to the committed output.
+type outputLock struct {
+	files []*lockFile
+}
+
+// lockOutputs takes the lock of every output directory the maps are written
+// to, waiting for other runs that hold them.
+func lockOutputs(paths Paths, maps []MapEntry) (*outputLock, error) {
+	var dirs []string
+	for _, m := range maps {
+		dirs = append(dirs, paths.outputMapDir(m.IsTest))
+	}
+	return lockDirs(dirs)
+}
+
+// lockDirs takes the lock of each output directory in outputDirs.
+func lockDirs(outputDirs []string) (*outputLock, error) {
+	dirs := make(map[string]bool)
+	for _, dir := range outputDirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		dirs[abs] = true
+	}
+	// A fixed order keeps two runs from each holding a lock the other needs
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Strings(sorted)
+
+	l := &outputLock{}
+	for _, dir := range sorted {
+		sum := sha256.Sum256([]byte(dir))
+		path := filepath.Join(os.TempDir(), "map-generator-"+hex.EncodeToString(sum[:8])+".lock")
+		f, err := acquireLock(path, func() {
+			slog.Info("Waiting for another run to finish writing", "dir", dir)
+		})
+		if err != nil {
+			l.unlock()
+			return nil, fmt.Errorf("failed to lock %s: %w", dir, err)
+		}
+		l.files = append(l.files, f)
+	}
+	return l, nil
+}
+
+func (l *outputLock) unlock() {
+	for _, f := range l.files {
+		f.release()
+	}
+	l.files = nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// listDir returns the names in dir, sorted.
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestStagedDirCommit(t *testing.T) {
+	base := t.TempDir()
+	target := filepath.Join(base, "pluto")
+	if err := os.MkdirAll(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(target, "map.bin"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(target, "stale.bin"), []byte("old"), 0644)
+	// Left by an interrupted run
+	os.MkdirAll(filepath.Join(base, ".pluto"+stagingInfix+"123"), 0755)
+
+	staged, err := newStagedDir(base, "pluto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer staged.discard()
+	if err := staged.writeFile("map.bin", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(target, "map.bin")); string(got) != "old" {
+		t.Errorf("output changed before commit: %q", got)
+	}
+	if err := staged.commit(target); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := listDir(t, base); len(got) != 1 || got[0] != "pluto" {
+		t.Errorf("output directory holds %v, want only pluto", got)
+	}
+	if got := listDir(t, target); len(got) != 1 || got[0] != "map.bin" {
+		t.Errorf("map directory holds %v, want only map.bin", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(target, "map.bin")); string(got) != "new" {
+		t.Errorf("map.bin = %q after commit, want new", got)
+	}
+	if fi, err := os.Stat(target); err != nil {
+		t.Error(err)
+	} else if fi.Mode().Perm() != 0755 {
+		t.Errorf("map directory mode = %v, want 0755", fi.Mode().Perm())
+	}
+}
+
+// TestReplaceDir checks the platform's replaceDir and the renameAside
+// fallback leave the new output in place and the old output where they say.
+func TestReplaceDir(t *testing.T) {
+	for name, replace := range map[string]func(staged, target string) (string, error){
+		"replaceDir":  replaceDir,
+		"renameAside": renameAside,
+	} {
+		base := t.TempDir()
+		staged, target := filepath.Join(base, ".pluto.staging-1"), filepath.Join(base, "pluto")
+		for dir, content := range map[string]string{staged: "new", target: "old"} {
+			os.MkdirAll(dir, 0755)
+			os.WriteFile(filepath.Join(dir, "map.bin"), []byte(content), 0644)
+		}
+
+		old, err := replace(staged, target)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, _ := os.ReadFile(filepath.Join(target, "map.bin")); string(got) != "new" {
+			t.Errorf("%s: map.bin = %q, want new", name, got)
+		}
+		if got, _ := os.ReadFile(filepath.Join(old, "map.bin")); string(got) != "old" {
+			t.Errorf("%s: previous map.bin in %s = %q, want old", name, old, got)
+		}
+	}
+}
+
+func TestProcessMapKeepsOutputOnFailure(t *testing.T) {
+	assets, out := t.TempDir(), t.TempDir()
+	dir := filepath.Join(assets, "maps", "broken")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "image.png"), []byte("not a png"), 0644)
+	os.WriteFile(filepath.Join(dir, "info.json"), []byte(`{"name": "Broken"}`), 0644)
+	previous := filepath.Join(out, "broken")
+	os.MkdirAll(previous, 0755)
+	os.WriteFile(filepath.Join(previous, "map.bin"), []byte("old"), 0644)
+
+	paths := Paths{Assets: assets, Out: out, TestOut: t.TempDir()}
+	m := MapEntry{Name: "broken", Dir: dir, Image: "image.png"}
+	var report MapReport
+	if err := processMap(paths, m, BuildOptions{Force: true}, &report); err == nil {
+		t.Fatal("processMap succeeded on a broken image")
+	}
+	if got := listDir(t, out); len(got) != 1 || got[0] != "broken" {
+		t.Errorf("output directory holds %v, want only broken", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(previous, "map.bin")); string(got) != "old" {
+		t.Errorf("previous output changed to %q", got)
+	}
+}
+
+func TestLockOutputs(t *testing.T) {
+	paths := Paths{Out: t.TempDir(), TestOut: t.TempDir()}
+	maps := []MapEntry{{Name: "a"}, {Name: "b", IsTest: true}}
+	first, err := lockOutputs(paths, maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan *outputLock)
+	go func() {
+		second, err := lockOutputs(paths, maps[1:])
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- second
+	}()
+	select {
+	case <-locked:
+		t.Fatal("second run took the lock while the first held it")
+	case <-time.After(200 * time.Millisecond):
+	}
+	first.unlock()
+	select {
+	case second := <-locked:
+		second.unlock()
+	case <-time.After(5 * time.Second):
+		t.Fatal("second run did not get the lock after the first released it")
+	}
+}
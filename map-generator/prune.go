@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// keepFile lists outputs that no map owns but that must not be pruned, such
+// as a copy of a production map used by tests. It lives in the output
+// directory and holds one path.Match pattern per line, relative to that
+// directory, e.g. "giantworldmap" or "*/extra.bin". Lines starting with #
+// are comments.
+const keepFile = ".generator-keep"
+
+// orphan is an output directory or file that no map owns.
+type orphan struct {
+	Path string
+	Dir  bool
+}
+
+// ownedOutputs returns the names of the map folders each output directory
+// should hold, keyed by output directory. Unlike discoverMaps it includes
+// maps without an image.png, whose committed output is still served by the
+// game.
+func ownedOutputs(paths Paths) (map[string]map[string]bool, error) {
+	folders, _, err := scanMapFolders(paths)
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[string]map[string]bool)
+	for _, f := range folders {
+		outDir := filepath.Clean(paths.outputMapDir(f.isTest()))
+		if owned[outDir] == nil {
+			owned[outDir] = make(map[string]bool)
+		}
+		owned[outDir][f.Name] = true
+	}
+	return owned, nil
+}
+
+// readKeepFile returns the patterns in dir's keep file, if it has one.
+func readKeepFile(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, keepFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in %s: %w", line, filepath.Join(dir, keepFile), err)
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneDirs returns the output directories of set.
+func pruneDirs(paths Paths, set string) ([]string, error) {
+	switch set {
+	case "all":
+		if filepath.Clean(paths.Out) == filepath.Clean(paths.TestOut) {
+			return []string{paths.Out}, nil
+		}
+		return []string{paths.Out, paths.TestOut}, nil
+	case "prod":
+		return []string{paths.Out}, nil
+	case "test":
+		return []string{paths.TestOut}, nil
+	}
+	return nil, fmt.Errorf("unknown map set %q (want all, prod or test)", set)
+}
+
+// findOrphans lists what no map owns in the given output directories: map
+// folders without a source asset, files other than the generator's output
+// inside map folders, stray files and leftover staging directories.
+func findOrphans(paths Paths, outputDirs []string) ([]orphan, error) {
+	owned, err := ownedOutputs(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []orphan
+	for _, outDir := range outputDirs {
+		outDir = filepath.Clean(outDir)
+		keep, err := readKeepFile(outDir)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := os.ReadDir(outDir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read output directory %s: %w", outDir, err)
+		}
+
+		for _, e := range entries {
+			name := e.Name()
+			p := filepath.Join(outDir, name)
+			switch {
+			case name == keepFile || matchesAny(keep, name):
+				continue
+			case !e.IsDir() || isStagingDir(name) || !owned[outDir][name]:
+				orphans = append(orphans, orphan{Path: p, Dir: e.IsDir()})
+				continue
+			}
+
+			files, err := os.ReadDir(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read output directory %s: %w", p, err)
+			}
+			for _, f := range files {
+				if slices.Contains(outputFiles, f.Name()) && !f.IsDir() || matchesAny(keep, name+"/"+f.Name()) {
+					continue
+				}
+				orphans = append(orphans, orphan{Path: filepath.Join(p, f.Name()), Dir: f.IsDir()})
+			}
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].Path < orphans[j].Path })
+	return orphans, nil
+}
+
+// pruneOutputs finds the orphans in outputDirs and removes them unless
+// dryRun is set, printing each one. The caller must hold the output lock.
+func pruneOutputs(paths Paths, outputDirs []string, dryRun bool) (int, error) {
+	orphans, err := findOrphans(paths, outputDirs)
+	if err != nil {
+		return 0, err
+	}
+	for _, o := range orphans {
+		kind := "file"
+		if o.Dir {
+			kind = "directory"
+		}
+		if dryRun {
+			fmt.Printf("would remove %s %s\n", kind, o.Path)
+			continue
+		}
+		if err := os.RemoveAll(o.Path); err != nil {
+			return 0, fmt.Errorf("failed to remove %s: %w", o.Path, err)
+		}
+		slog.Info("Pruned output no map owns", "path", o.Path)
+		fmt.Printf("removed %s %s\n", kind, o.Path)
+	}
+	return len(orphans), nil
+}
+
+func runPrune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	var paths Paths
+	paths.registerFlags(fs)
+	set := fs.String("set", "all", "which output directories to prune: all, prod or test")
+	dryRun := fs.Bool("dry-run", false, "list what would be removed without removing it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: map-generator prune [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Removes output directories and files that no map in the assets owns.\n")
+		fmt.Fprintf(fs.Output(), "Outputs listed in %s in an output directory are kept.\n\nFlags:\n", keepFile)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := paths.resolve(); err != nil {
+		return err
+	}
+	dirs, err := pruneDirs(paths, *set)
+	if err != nil {
+		return err
+	}
+	lock, err := lockDirs(dirs)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	n, err := pruneOutputs(paths, dirs, *dryRun)
+	if err != nil {
+		return err
+	}
+	switch {
+	case n == 0:
+		fmt.Println("Nothing to prune")
+	case *dryRun:
+		fmt.Printf("%d outputs would be removed; run without -dry-run to remove them\n", n)
+	default:
+		fmt.Printf("Removed %d outputs\n", n)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"assets/maps/built/info.json":               `{}`,
+		"assets/maps/built/image.png":               "",
+		"assets/maps/unbuilt/info.json":             `{}`,
+		"assets/maps/moved/info.json":               `{"generator": {"test_map": true}}`,
+		"assets/maps/noinfo/image.png":              "",
+		"assets/test_maps/small/info.json":          `{}`,
+		"out/built/map.bin":                         "",
+		"out/built/manifest.json":                   "",
+		"out/built/mini_map.bin":                    "",
+		"out/built/notes.md":                        "",
+		"out/unbuilt/map4x.bin":                     "",
+		"out/moved/map.bin":                         "",
+		"out/noinfo/map.bin":                        "",
+		"out/removed/map.bin":                       "",
+		"out/kept/map.bin":                          "",
+		"out/.built" + stagingInfix + "123/map.bin": "",
+		"out/stray.txt":                             "",
+		"out/" + keepFile:                           "# comment\nkept\n*/notes.md\n",
+		"test-out/small/map.bin":                    "",
+		"test-out/moved/map.bin":                    "",
+		"test-out/small/extra/":                     "",
+		"test-out/removed/":                         "",
+	})
+	paths := Paths{
+		Assets:  filepath.Join(root, "assets"),
+		Out:     filepath.Join(root, "out"),
+		TestOut: filepath.Join(root, "test-out"),
+	}
+	rel := func(orphans []orphan) []string {
+		var got []string
+		for _, o := range orphans {
+			r, _ := filepath.Rel(root, o.Path)
+			if o.Dir {
+				r += "/"
+			}
+			got = append(got, filepath.ToSlash(r))
+		}
+		return got
+	}
+
+	orphans, err := findOrphans(paths, []string{paths.Out, paths.TestOut})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"out/.built" + stagingInfix + "123/",
+		"out/built/mini_map.bin",
+		"out/moved/",
+		"out/noinfo/",
+		"out/removed/",
+		"out/stray.txt",
+		"test-out/removed/",
+		"test-out/small/extra/",
+	}
+	if got := rel(orphans); !reflect.DeepEqual(got, want) {
+		t.Errorf("orphans:\n got %v\nwant %v", got, want)
+	}
+
+	if n, err := pruneOutputs(paths, []string{paths.TestOut}, true); err != nil || n != 2 {
+		t.Fatalf("dry run = %d, %v; want 2 orphans", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(paths.TestOut, "removed")); err != nil {
+		t.Errorf("dry run removed an orphan: %v", err)
+	}
+	if n, err := pruneOutputs(paths, []string{paths.Out, paths.TestOut}, false); err != nil || n != len(want) {
+		t.Fatalf("prune = %d, %v; want %d orphans", n, err, len(want))
+	}
+	orphans, err = findOrphans(paths, []string{paths.Out, paths.TestOut})
+	if err != nil || len(orphans) != 0 {
+		t.Errorf("orphans left after pruning: %v, %v", rel(orphans), err)
+	}
+	for _, kept := range []string{"out/built/notes.md", "out/kept/map.bin", "out/unbuilt/map4x.bin", "test-out/moved/map.bin"} {
+		if _, err := os.Stat(filepath.Join(root, kept)); err != nil {
+			t.Errorf("%s was pruned", kept)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// registryCategories are the map categories known to the game, in the order
+// they are shown. Each needs a map_categories.<name> translation.
+var registryCategories = []string{"continental", "regional", "fantasy"}
+
+var enumKeyPattern = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+
+// enumMemberPattern matches a member of the generated GameMapType enum.
+var enumMemberPattern = regexp.MustCompile(`(?m)^  ([A-Za-z0-9]+) = "`)
+
+// RegistryInfo is the registry block of info.json:
+//
+//	"registry": {
+//	  "enum_key": "GiantWorldMap",
+//	  "display_name": "Giant World Map",
+//	  "category": "continental",
+//	  "order": 2,
+//	  "playlist_weight": 5
+//	}
+type RegistryInfo struct {
+	// EnumKey is the GameMapType member. Lowercased it must equal the map's
+	// folder name, which is how the game finds the map's files.
+	EnumKey string `json:"enum_key" schema:"required"`
+	// DisplayName is the GameMapType value. It is stored in game configs
+	// and must not change once a map has shipped.
+	DisplayName string `json:"display_name" schema:"required"`
+	Category    string `json:"category" schema:"required"`
+	// Order is the position of the map within its category.
+	Order int `json:"order"`
+	// PlaylistWeight is how many times the map appears in the public lobby
+	// playlist; zero keeps it out of the playlist.
+	PlaylistWeight int `json:"playlist_weight"`
+}
+
+type registryEntry struct {
+	Folder string
+	RegistryInfo
+}
+
+// discoverRegistry reads the registry block of every map's info.json. Unlike
+// discoverMaps it includes maps without an image.png, since their committed
+// output is still served by the game.
+func discoverRegistry(paths Paths) ([]registryEntry, []string, error) {
+	folders, warnings, err := scanMapFolders(paths)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []registryEntry
+	for _, f := range folders {
+		if f.Info.Registry == nil {
+			if !f.InTestDir {
+				warnings = append(warnings, fmt.Sprintf("%s: no registry block in info.json, map is not available in the game", f.Name))
+			}
+			continue
+		}
+		entries = append(entries, registryEntry{Folder: f.Name, RegistryInfo: *f.Info.Registry})
+	}
+
+	if err := validateRegistry(entries); err != nil {
+		return nil, nil, err
+	}
+
+	categoryIndex := make(map[string]int)
+	for i, c := range registryCategories {
+		categoryIndex[c] = i
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Category != b.Category {
+			return categoryIndex[a.Category] < categoryIndex[b.Category]
+		}
+		if a.Order != b.Order {
+			return a.Order < b.Order
+		}
+		return a.EnumKey < b.EnumKey
+	})
+	return entries, warnings, nil
+}
+
+func validateRegistry(entries []registryEntry) error {
+	var problems []string
+	keys := make(map[string]string)
+	names := make(map[string]string)
+	for _, e := range entries {
+		problem := func(format string, args ...interface{}) {
+			problems = append(problems, e.Folder+": "+fmt.Sprintf(format, args...))
+		}
+		if !enumKeyPattern.MatchString(e.EnumKey) {
+			problem("enum_key %q must be a PascalCase identifier", e.EnumKey)
+		} else if strings.ToLower(e.EnumKey) != e.Folder {
+			problem("enum_key %q must match the folder name when lowercased", e.EnumKey)
+		}
+		if e.DisplayName == "" || strings.ContainsAny(e.DisplayName, "\"\\\n") {
+			problem("display_name %q must be non-empty and free of quotes, backslashes and newlines", e.DisplayName)
+		}
+		if !slices.Contains(registryCategories, e.Category) {
+			problem("category %q is not one of %v", e.Category, registryCategories)
+		}
+		if e.PlaylistWeight < 0 {
+			problem("playlist_weight must not be negative")
+		}
+		if other, ok := keys[e.EnumKey]; ok {
+			problem("enum_key %q is also used by %s", e.EnumKey, other)
+		}
+		keys[e.EnumKey] = e.Folder
+		if other, ok := names[e.DisplayName]; ok {
+			problem("display_name %q is also used by %s", e.DisplayName, other)
+		}
+		names[e.DisplayName] = e.Folder
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid map registry:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// enumOrder returns the GameMapType members declared in an existing registry
+// module, in order.
+func enumOrder(existing []byte) []string {
+	start := bytes.Index(existing, []byte("export enum GameMapType {"))
+	if start < 0 {
+		return nil
+	}
+	body := existing[start:]
+	if end := bytes.Index(body, []byte("\n}")); end >= 0 {
+		body = body[:end]
+	}
+	var keys []string
+	for _, m := range enumMemberPattern.FindAllSubmatch(body, -1) {
+		keys = append(keys, string(m[1]))
+	}
+	return keys
+}
+
+// renderRegistry writes the TypeScript registry module. GameMapType members
+// keep their position in previous, the members of the module being
+// replaced, since the game relies on the order of Object.values(GameMapType);
+// new maps are appended in category order. The output is formatted the way
+// prettier formats it so the checked-in file passes `prettier --check`
+// unchanged.
+func renderRegistry(entries []registryEntry, previous []string) []byte {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by map-generator from map-generator/assets/*/info.json. DO NOT EDIT.\n")
+	b.WriteString("// Run `npm run gen-map-registry` after changing a map's registry block.\n\n")
+
+	position := make(map[string]int, len(previous))
+	for i, key := range previous {
+		position[key] = i
+	}
+	enum := append([]registryEntry(nil), entries...)
+	sort.SliceStable(enum, func(i, j int) bool {
+		pi, iOld := position[enum[i].EnumKey]
+		pj, jOld := position[enum[j].EnumKey]
+		if iOld != jOld {
+			return iOld
+		}
+		return iOld && pi < pj
+	})
+	b.WriteString("export enum GameMapType {\n")
+	for _, e := range enum {
+		fmt.Fprintf(&b, "  %s = \"%s\",\n", e.EnumKey, e.DisplayName)
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("export type GameMapName = keyof typeof GameMapType;\n\n")
+
+	b.WriteString("export const mapCategories: Record<string, GameMapType[]> = {\n")
+	for _, category := range registryCategories {
+		var members []string
+		for _, e := range entries {
+			if e.Category == category {
+				members = append(members, "GameMapType."+e.EnumKey)
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+		// prettier keeps an array on one line when it fits in 80 columns
+		line := fmt.Sprintf("  %s: [%s],", category, strings.Join(members, ", "))
+		if len(line) <= 80 {
+			b.WriteString(line + "\n")
+			continue
+		}
+		fmt.Fprintf(&b, "  %s: [\n", category)
+		for _, m := range members {
+			fmt.Fprintf(&b, "    %s,\n", m)
+		}
+		b.WriteString("  ],\n")
+	}
+	b.WriteString("};\n\n")
+
+	byKey := append([]registryEntry(nil), entries...)
+	sort.Slice(byKey, func(i, j int) bool { return byKey[i].EnumKey < byKey[j].EnumKey })
+	b.WriteString("// How many times each map should appear in the public lobby playlist.\n")
+	b.WriteString("export const mapPlaylistWeights: Record<GameMapName, number> = {\n")
+	for _, e := range byKey {
+		fmt.Fprintf(&b, "  %s: %d,\n", e.EnumKey, e.PlaylistWeight)
+	}
+	b.WriteString("};\n")
+	return b.Bytes()
+}
+
+func runRegistry(args []string) error {
+	fs := flag.NewFlagSet("registry", flag.ExitOnError)
+	var paths Paths
+	paths.registerFlags(fs)
+	output := fs.String("output", "", "TypeScript file to write (default: <root>/src/core/game/MapRegistry.ts)")
+	check := fs.Bool("check", false, "don't write; fail if the file is out of date")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: map-generator registry [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Generates the TypeScript map registry from the registry block of every info.json.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := paths.resolve(); err != nil {
+		return err
+	}
+	if *output == "" {
+		if paths.Root == "" {
+			return fmt.Errorf("-output is required when -root cannot be determined")
+		}
+		*output = filepath.Join(paths.Root, "src", "core", "game", "MapRegistry.ts")
+	}
+
+	entries, warnings, err := discoverRegistry(paths)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		slog.Warn(w)
+	}
+	existing, err := os.ReadFile(*output)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", *output, err)
+	}
+	generated := renderRegistry(entries, enumOrder(existing))
+
+	if *check {
+		if !bytes.Equal(existing, generated) {
+			return fmt.Errorf("%s is out of date; run `npm run gen-map-registry` and commit the result", *output)
+		}
+		fmt.Printf("%s is up to date (%d maps)\n", *output, len(entries))
+		return nil
+	}
+
+	if err := os.WriteFile(*output, generated, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+	fmt.Printf("Wrote %d maps to %s\n", len(entries), *output)
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func testRegistryEntry(key, name, category string, order int) registryEntry {
+	return registryEntry{
+		Folder:       strings.ToLower(key),
+		RegistryInfo: RegistryInfo{EnumKey: key, DisplayName: name, Category: category, Order: order},
+	}
+}
+
+func TestValidateRegistry(t *testing.T) {
+	valid := []registryEntry{
+		testRegistryEntry("World", "World", "continental", 1),
+		testRegistryEntry("Pluto", "Pluto", "fantasy", 1),
+	}
+	if err := validateRegistry(valid); err != nil {
+		t.Fatalf("validateRegistry = %v", err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		entry registryEntry
+		want  string
+	}{
+		{"duplicate enum key", registryEntry{Folder: "world", RegistryInfo: RegistryInfo{EnumKey: "World", DisplayName: "Flat World", Category: "fantasy"}}, `world: enum_key "World" is also used by world`},
+		{"duplicate display name", testRegistryEntry("Mars", "Pluto", "fantasy", 2), `mars: display_name "Pluto" is also used by pluto`},
+		{"unknown category", testRegistryEntry("Mars", "Mars", "planets", 2), `mars: category "planets" is not one of [continental regional fantasy]`},
+		{"enum key case", testRegistryEntry("mars", "Mars", "fantasy", 2), `enum_key "mars" must be a PascalCase identifier`},
+		{"enum key folder", registryEntry{Folder: "red", RegistryInfo: RegistryInfo{EnumKey: "Mars", DisplayName: "Mars", Category: "fantasy"}}, "must match the folder name when lowercased"},
+		{"quoted display name", testRegistryEntry("Mars", `"Mars"`, "fantasy", 2), "must be non-empty and free of quotes"},
+		{"negative weight", registryEntry{Folder: "mars", RegistryInfo: RegistryInfo{EnumKey: "Mars", DisplayName: "Mars", Category: "fantasy", PlaylistWeight: -1}}, "playlist_weight must not be negative"},
+	} {
+		err := validateRegistry(append(slices.Clone(valid), tc.entry))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestRegistryOrder(t *testing.T) {
+	registry := func(key, category string, order int) string {
+		return `{"name": "` + key + `", "registry": {"enum_key": "` + key + `", "display_name": "` + key + `", "category": "` + category + `", "order": ` + strconv.Itoa(order) + `}}`
+	}
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"assets/maps/pluto/info.json":     registry("Pluto", "fantasy", 1),
+		"assets/maps/europe/info.json":    registry("Europe", "continental", 2),
+		"assets/maps/asia/info.json":      registry("Asia", "continental", 2),
+		"assets/maps/world/info.json":     registry("World", "continental", 1),
+		"assets/maps/iceland/info.json":   registry("Iceland", "regional", 1),
+		"assets/maps/unlisted/info.json":  `{"name": "Unlisted"}`,
+		"assets/test_maps/test/info.json": `{"name": "Test"}`,
+	})
+	entries, warnings, err := discoverRegistry(Paths{Assets: filepath.Join(root, "assets")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.EnumKey)
+	}
+	// By category, then order, then enum key
+	if want := []string{"World", "Asia", "Europe", "Iceland", "Pluto"}; !slices.Equal(keys, want) {
+		t.Errorf("entries in order %v, want %v", keys, want)
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "unlisted: no registry block") {
+		t.Errorf("warnings = %q, want one for unlisted", warnings)
+	}
+
+	// A new module lists the enum in category order
+	generated := renderRegistry(entries, nil)
+	if got := enumOrder(generated); !slices.Equal(got, keys) {
+		t.Errorf("new enum order %v, want %v", got, keys)
+	}
+	wantCategories := "  continental: [GameMapType.World, GameMapType.Asia, GameMapType.Europe],\n" +
+		"  regional: [GameMapType.Iceland],\n  fantasy: [GameMapType.Pluto],\n"
+	if !strings.Contains(string(generated), wantCategories) {
+		t.Errorf("mapCategories not in category order:\n%s", generated)
+	}
+
+	// Existing members keep their place, a removed one is dropped and new
+	// ones are appended in category order
+	previous := []string{"Pluto", "Mars", "Europe", "World"}
+	regenerated := renderRegistry(entries, previous)
+	if got, want := enumOrder(regenerated), []string{"Pluto", "Europe", "World", "Asia", "Iceland"}; !slices.Equal(got, want) {
+		t.Errorf("regenerated enum order %v, want %v", got, want)
+	}
+	if again := renderRegistry(entries, enumOrder(regenerated)); string(again) != string(regenerated) {
+		t.Error("regenerating the registry from its own output changed it")
+	}
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// replaceDir swaps the directories staged and target with a single
+// renameat2(2) RENAME_EXCHANGE, so target is never missing, and returns
+// staged, which then holds the previous output. File systems without
+// RENAME_EXCHANGE fall back to renameAside.
+func replaceDir(staged, target string) (string, error) {
+	err := unix.Renameat2(unix.AT_FDCWD, staged, unix.AT_FDCWD, target, unix.RENAME_EXCHANGE)
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) {
+		return renameAside(staged, target)
+	}
+	if err != nil {
+		return "", err
+	}
+	return staged, nil
+}
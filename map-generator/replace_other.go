@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+// replaceDir replaces the directory target with staged and returns where
+// the previous output was moved. Only Linux can swap two directories
+// atomically, so elsewhere target is briefly missing; see renameAside.
+func replaceDir(staged, target string) (string, error) {
+	return renameAside(staged, target)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"map-generator/mapgen"
+)
+
+type BuildStatus string
+
+const (
+	StatusBuilt    BuildStatus = "built"
+	StatusUpToDate BuildStatus = "up_to_date"
+	StatusFailed   BuildStatus = "failed"
+)
+
+// LODReport describes one level of detail written for a map. It is also the
+// LOD entry of manifest.json, whose keys have always been sorted.
+type LODReport struct {
+	Height       int `json:"height"`
+	NumLandTiles int `json:"num_land_tiles"`
+	Width        int `json:"width"`
+}
+
+func newLODReport(info mapgen.MapInfo) LODReport {
+	return LODReport{Width: info.Width, Height: info.Height, NumLandTiles: info.NumLandTiles}
+}
+
+// StageReport is how long one stage of building a map took: the stages of
+// mapgen.GenerateMap followed by writing the output files.
+type StageReport struct {
+	Stage      string  `json:"stage"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+func newStageReport(stage string, d time.Duration) StageReport {
+	return StageReport{Stage: stage, DurationMS: float64(d.Microseconds()) / 1000}
+}
+
+// MapReport is the outcome of building a single map.
+type MapReport struct {
+	Name        string               `json:"name"`
+	Test        bool                 `json:"test"`
+	Status      BuildStatus          `json:"status"`
+	Error       string               `json:"error,omitempty"`
+	Warnings    []string             `json:"warnings,omitempty"`
+	Streamed    bool                 `json:"streamed,omitempty"`
+	DurationMS  int64                `json:"duration_ms"`
+	Stages      []StageReport        `json:"stages,omitempty"`
+	LODs        map[string]LODReport `json:"lods,omitempty"`
+	OutputBytes map[string]int       `json:"output_bytes,omitempty"`
+}
+
+// BuildReport aggregates the outcome of every map in a generate run.
+type BuildReport struct {
+	StartedAt  time.Time   `json:"started_at"`
+	DurationMS int64       `json:"duration_ms"`
+	Built      int         `json:"built"`
+	UpToDate   int         `json:"up_to_date"`
+	Failed     int         `json:"failed"`
+	Maps       []MapReport `json:"maps"`
+}
+
+func (r *BuildReport) tally() {
+	r.Built, r.UpToDate, r.Failed = 0, 0, 0
+	for _, m := range r.Maps {
+		switch m.Status {
+		case StatusBuilt:
+			r.Built++
+		case StatusUpToDate:
+			r.UpToDate++
+		case StatusFailed:
+			r.Failed++
+		}
+	}
+}
+
+func (r *BuildReport) Err() error {
+	if r.Failed > 0 {
+		return fmt.Errorf("%d of %d maps failed to build", r.Failed, len(r.Maps))
+	}
+	return nil
+}
+
+// PrintSummary writes a table with one row per map followed by the error of
+// every failed map.
+func (r *BuildReport) PrintSummary(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MAP\tSTATUS\tTIME\tSIZE\tLAND TILES\tOUTPUT")
+	for _, m := range r.Maps {
+		size, landTiles, output := "-", "-", "-"
+		if lod, ok := m.LODs["map"]; ok {
+			size = fmt.Sprintf("%dx%d", lod.Width, lod.Height)
+			landTiles = fmt.Sprintf("%d", lod.NumLandTiles)
+		}
+		if len(m.OutputBytes) > 0 {
+			total := 0
+			for _, n := range m.OutputBytes {
+				total += n
+			}
+			output = formatBytes(uint64(total))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.1fs\t%s\t%s\t%s\n",
+			m.Name, m.Status, float64(m.DurationMS)/1000, size, landTiles, output)
+	}
+	tw.Flush()
+
+	for _, m := range r.Maps {
+		if len(m.Warnings) > 0 {
+			fmt.Fprintf(w, "\n%s: %d warnings\n", m.Name, len(m.Warnings))
+			for _, warning := range m.Warnings {
+				fmt.Fprintf(w, "  %s\n", warning)
+			}
+		}
+	}
+	for _, m := range r.Maps {
+		if m.Status == StatusFailed {
+			fmt.Fprintf(w, "\n%s: %s\n", m.Name, m.Error)
+		}
+	}
+	fmt.Fprintf(w, "\n%d built, %d up to date, %d failed in %.1fs\n",
+		r.Built, r.UpToDate, r.Failed, float64(r.DurationMS)/1000)
+}
+
+func (r *BuildReport) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize build report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write build report %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"map-generator/mapgen"
+)
+
+// Rough per-tile costs used to estimate the peak memory of building a map.
+// They only need to be accurate enough to keep concurrent builds within the
+// memory budget.
+const (
+	// Terrain grids at full, 4x and 16x resolution.
+	terrainGridFactor = 1 + 1.0/4 + 1.0/16
+	// Component labels for islands and water bodies, plus the bitset and
+	// queue of the distance to land search.
+	floodFillBytesPerTile = 8
+	// In streaming mode only the bitset and the search frontier are left.
+	streamFloodFillBytesPerTile = 1
+	// Decoded strips of the image, and copies of them made while decoding.
+	streamImageRows = 4 * 256
+	// Elevations and water mask of a heightmap, besides the decoded images.
+	heightmapBytesPerPixel = 5
+)
+
+type mapJob struct {
+	Entry  MapEntry
+	Pixels int
+	Cost   uint64 // estimated peak memory in bytes
+}
+
+// estimateJob reads only the image header of a map to estimate how much
+// memory building it with opts takes. Unreadable images get a zero cost; the
+// build itself will report the error.
+func estimateJob(m MapEntry, opts BuildOptions) mapJob {
+	job := mapJob{Entry: m}
+	cfg, format, err := m.sourceConfig()
+	if err != nil {
+		return job
+	}
+	job.Pixels = cfg.Width * cfg.Height
+	// Only PNG images are decoded in strips
+	job.Cost = estimateMemory(cfg, opts.stream(job.Pixels) && format == "png")
+	switch {
+	case m.Heightmap != "":
+		job.Cost += uint64(job.Pixels) * heightmapBytesPerPixel
+	case m.DEM != "":
+		// The whole DEM is decoded before it is resampled
+		job.Cost += uint64(job.Pixels) * heightmapBytesPerPixel
+		if width, height, err := m.demSize(); err == nil {
+			job.Cost += uint64(width) * uint64(height) * heightmapBytesPerPixel
+		}
+	}
+	return job
+}
+
+func estimateMemory(cfg image.Config, stream bool) uint64 {
+	pixels := float64(cfg.Width) * float64(cfg.Height)
+	terrainBytes := pixels * terrainGridFactor * mapgen.BytesPerTile
+	if stream {
+		// Only the image strips and the smaller levels of detail are held
+		// besides the terrain; map.bin goes straight to disk
+		imageBytes := float64(cfg.Width) * streamImageRows * float64(bytesPerPixel(cfg.ColorModel))
+		floodFillBytes := pixels * streamFloodFillBytesPerTile
+		packedBytes := pixels * (terrainGridFactor - 1)
+		return uint64(imageBytes + terrainBytes + floodFillBytes + packedBytes)
+	}
+	imageBytes := pixels * float64(bytesPerPixel(cfg.ColorModel))
+	floodFillBytes := pixels * floodFillBytesPerTile
+	packedBytes := pixels * terrainGridFactor
+	return uint64(imageBytes + terrainBytes + floodFillBytes + packedBytes)
+}
+
+func bytesPerPixel(model color.Model) int {
+	switch model {
+	case color.GrayModel, color.AlphaModel:
+		return 1
+	case color.Gray16Model, color.Alpha16Model:
+		return 2
+	case color.RGBA64Model, color.NRGBA64Model:
+		return 8
+	}
+	if _, ok := model.(color.Palette); ok {
+		return 1
+	}
+	return 4
+}
+
+// runJobs calls fn for every job on at most workers goroutines, starting the
+// largest maps first. With a non-zero budget a job only starts once the
+// estimated cost of the running jobs leaves room for it, and the jobs behind
+// it wait too, so that a stream of small maps can't hold a large one back.
+// A job larger than the whole budget runs on its own.
+func runJobs(jobs []mapJob, workers int, budget uint64, fn func(MapEntry)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	pending := append([]mapJob(nil), jobs...)
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].Pixels > pending[j].Pixels
+	})
+
+	var mu sync.Mutex
+	cond := sync.NewCond(&mu)
+	var inUse uint64
+	running := 0
+
+	// next removes and returns the first pending job, blocking until it fits
+	// in the budget. It returns false once no jobs are left.
+	next := func() (mapJob, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			if len(pending) == 0 {
+				return mapJob{}, false
+			}
+			if job := pending[0]; budget == 0 || running == 0 || inUse+job.Cost <= budget {
+				pending = pending[1:]
+				inUse += job.Cost
+				running++
+				return job, true
+			}
+			cond.Wait()
+		}
+	}
+	done := func(job mapJob) {
+		mu.Lock()
+		inUse -= job.Cost
+		running--
+		mu.Unlock()
+		cond.Broadcast()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(jobs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, ok := next()
+				if !ok {
+					return
+				}
+				fn(job.Entry)
+				done(job)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// byteSize is a flag value accepting sizes such as "512MB", "2GiB" or a plain
+// number of bytes. Decimal and binary suffixes are both treated as powers of
+// 1024.
+type byteSize uint64
+
+func (b *byteSize) String() string {
+	if *b == 0 {
+		return "0"
+	}
+	return formatBytes(uint64(*b))
+}
+
+func (b *byteSize) Set(s string) error {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "B"), "I")
+	multiplier := uint64(1)
+	if n := len(v); n > 0 {
+		switch v[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier != 1 {
+			v = v[:n-1]
+		}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || f < 0 {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*b = byteSize(f * float64(multiplier))
+	return nil
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// schedule runs jobs through runJobs and records the order they started in
+// and the largest number and cost of jobs running at once.
+type schedule struct {
+	mu       sync.Mutex
+	started  []string
+	running  int
+	inUse    uint64
+	maxCount int
+	maxCost  uint64
+	// alone holds the jobs that had no other job running beside them.
+	alone map[string]bool
+}
+
+func (s *schedule) run(t *testing.T, jobs []mapJob, workers int, budget uint64) {
+	t.Helper()
+	costs := make(map[string]uint64)
+	for _, j := range jobs {
+		costs[j.Entry.Name] = j.Cost
+	}
+	s.alone = make(map[string]bool)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		runJobs(jobs, workers, budget, func(m MapEntry) {
+			s.mu.Lock()
+			s.started = append(s.started, m.Name)
+			s.running++
+			s.inUse += costs[m.Name]
+			s.maxCount = max(s.maxCount, s.running)
+			s.maxCost = max(s.maxCost, s.inUse)
+			s.mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			s.mu.Lock()
+			if s.running == 1 {
+				s.alone[m.Name] = true
+			}
+			s.running--
+			s.inUse -= costs[m.Name]
+			s.mu.Unlock()
+		})
+	}()
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("runJobs did not finish")
+	}
+	if len(s.started) != len(jobs) {
+		t.Fatalf("ran %d jobs, want %d", len(s.started), len(jobs))
+	}
+}
+
+func testJob(name string, pixels int, cost uint64) mapJob {
+	return mapJob{Entry: MapEntry{Name: name}, Pixels: pixels, Cost: cost}
+}
+
+func TestRunJobs(t *testing.T) {
+	t.Run("budget", func(t *testing.T) {
+		var jobs []mapJob
+		for i := 0; i < 12; i++ {
+			jobs = append(jobs, testJob(string(rune('a'+i)), 100+i, uint64(10+i%4*10)))
+		}
+		var s schedule
+		s.run(t, jobs, 8, 60)
+		if s.maxCost > 60 {
+			t.Errorf("running jobs cost %d, over the budget of 60", s.maxCost)
+		}
+		if s.maxCount < 2 {
+			t.Errorf("at most %d jobs ran at once, want jobs that fit to share the budget", s.maxCount)
+		}
+	})
+
+	t.Run("largest first", func(t *testing.T) {
+		jobs := []mapJob{testJob("small", 10, 0), testJob("large", 1000, 0), testJob("medium", 100, 0), testJob("tie", 100, 0)}
+		var s schedule
+		s.run(t, jobs, 1, 0)
+		want := []string{"large", "medium", "tie", "small"}
+		for i := range want {
+			if s.started[i] != want[i] {
+				t.Fatalf("started %v, want %v", s.started, want)
+			}
+		}
+	})
+
+	t.Run("job over budget", func(t *testing.T) {
+		jobs := []mapJob{testJob("huge", 1000, 500), testJob("a", 10, 10), testJob("b", 10, 10), testJob("c", 10, 10)}
+		var s schedule
+		s.run(t, jobs, 4, 100)
+		if s.started[0] != "huge" || !s.alone["huge"] {
+			t.Errorf("started %v, want huge first and on its own", s.started)
+		}
+	})
+
+	t.Run("blocked job", func(t *testing.T) {
+		// b doesn't fit beside a; the small jobs behind b must not start
+		// ahead of it even though they would fit
+		jobs := []mapJob{testJob("a", 1000, 60), testJob("b", 900, 60)}
+		for i := 0; i < 8; i++ {
+			jobs = append(jobs, testJob(string(rune('c'+i)), 10, 5))
+		}
+		var s schedule
+		s.run(t, jobs, 4, 100)
+		if s.started[0] != "a" || s.started[1] != "b" {
+			t.Errorf("started %v, want a then b before the small jobs", s.started)
+		}
+	})
+
+	t.Run("one worker", func(t *testing.T) {
+		jobs := []mapJob{testJob("a", 30, 0), testJob("b", 20, 0), testJob("c", 10, 0)}
+		for _, workers := range []int{1, 0} {
+			var s schedule
+			s.run(t, jobs, workers, 0)
+			if s.maxCount != 1 {
+				t.Errorf("%d workers: %d jobs ran at once, want 1", workers, s.maxCount)
+			}
+		}
+	})
+}
+
+func TestEstimateJob(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 4096))
+	if err := os.WriteFile(filepath.Join(dir, "image.png"), []byte(encodeTestPNG(t, img)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := MapEntry{Name: "pluto", Dir: dir, Image: "image.png"}
+
+	job := estimateJob(m, BuildOptions{})
+	if job.Pixels != 16*4096 || job.Cost == 0 {
+		t.Errorf("estimateJob = %d pixels, cost %d, want %d pixels", job.Pixels, job.Cost, 16*4096)
+	}
+	// Tall enough that streaming holds a fraction of the image
+	if streamed := estimateJob(m, BuildOptions{Stream: true}); streamed.Cost >= job.Cost {
+		t.Errorf("streaming costs %d, want less than %d", streamed.Cost, job.Cost)
+	}
+	m.Image = "missing.png"
+	if missing := estimateJob(m, BuildOptions{}); missing.Pixels != 0 || missing.Cost != 0 {
+		t.Errorf("estimateJob for a missing image = %+v, want no cost", missing)
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want uint64
+	}{
+		{"2GiB", 2 << 30},
+		{"512MB", 512 << 20},
+		{"1.5k", 1536},
+		{" 64 mib ", 64 << 20},
+		{"4096", 4096},
+		{"0", 0},
+	} {
+		var b byteSize
+		if err := b.Set(tc.in); err != nil || uint64(b) != tc.want {
+			t.Errorf("Set(%q) = %d, %v, want %d", tc.in, b, err, tc.want)
+		}
+	}
+	for _, in := range []string{"", "GiB", "lots", "-1GB", "2XB", "1GiBs"} {
+		var b byteSize
+		if err := b.Set(in); err == nil {
+			t.Errorf("Set(%q) = %d, want an error", in, b)
+		}
+	}
+
+	b := byteSize(2 << 30)
+	if got := b.String(); got != "2.0GiB" {
+		t.Errorf("String() = %q, want 2.0GiB", got)
+	}
+}
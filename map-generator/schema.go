@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"map-generator/mapgen"
+)
+
+// infoSchemaFile is the JSON Schema of info.json, written to the assets
+// directory by the schema command so editors can validate and complete
+// info.json as it is typed.
+const infoSchemaFile = "info.schema.json"
+
+// infoSchema returns the JSON Schema of InfoFile. Fields tagged
+// schema:"required" are required, and objects reject unknown fields like
+// parseInfoFile does.
+func infoSchema() map[string]any {
+	s := typeSchema(reflect.TypeOf(InfoFile{}))
+	s["$schema"] = "http://json-schema.org/draft-07/schema#"
+	s["title"] = "OpenFront map info.json"
+
+	// Constraints the Go types can't express, matching what validateMap and
+	// validateRegistry check
+	coords := subschema(s, "nations", "coordinates")
+	coords["minItems"], coords["maxItems"] = 2, 2
+	coords["items"].(map[string]any)["minimum"] = 0
+	subschema(s, "nations", "strength")["exclusiveMinimum"] = 0
+	subschema(s, "registry", "enum_key")["pattern"] = enumKeyPattern.String()
+	subschema(s, "registry", "category")["enum"] = registryCategories
+	subschema(s, "registry", "order")["minimum"] = 0
+	subschema(s, "registry", "playlist_weight")["minimum"] = 0
+	for _, entry := range []string{"entries", "unmatched"} {
+		subschema(s, "legend", entry, "terrain")["enum"] = legendTerrains
+		subschema(s, "legend", entry, "magnitude_from")["enum"] = legendChannels
+		subschema(s, "legend", entry, "color")["pattern"] = "^#([0-9A-Fa-f]{2}){3,4}$"
+		tolerance := subschema(s, "legend", entry, "tolerance")
+		tolerance["minimum"], tolerance["maximum"] = 0, 255
+		magnitude := subschema(s, "legend", entry, "magnitude")
+		magnitude["minimum"], magnitude["maximum"] = 0, mapgen.MaxLandMagnitude
+		for _, r := range append(legendChannels, "magnitude_range") {
+			items := subschema(s, "legend", entry, r)["items"].(map[string]any)
+			items["minimum"], items["maximum"] = 0, 255
+		}
+	}
+	for _, dim := range []string{"width", "height"} {
+		subschema(s, "source", "raw", dim)["minimum"] = 1
+	}
+	subschema(s, "source", "raw", "bit_depth")["enum"] = []int{8, 16}
+	subschema(s, "source", "raw", "byte_order")["enum"] = rawByteOrders
+	subschema(s, "source", "tiles")["minimum"] = minTiles
+	// Each point is [elevation, magnitude]
+	point := subschema(s, "source", "height_curve")["items"].(map[string]any)
+	point["items"] = []any{
+		map[string]any{"type": "number"},
+		map[string]any{"type": "number", "minimum": 0, "maximum": mapgen.MaxLandMagnitude},
+	}
+	return s
+}
+
+// subschema returns the schema of the property at path, looking through
+// arrays to their items.
+func subschema(s map[string]any, path ...string) map[string]any {
+	for _, name := range path {
+		if items, ok := s["items"].(map[string]any); ok {
+			s = items
+		}
+		s = s["properties"].(map[string]any)[name].(map[string]any)
+	}
+	return s
+}
+
+// typeSchema describes the JSON encoding of t.
+func typeSchema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	s := map[string]any{"type": jsonType(t)}
+	switch t.Kind() {
+	case reflect.Slice:
+		s["items"] = typeSchema(t.Elem())
+	case reflect.Array:
+		s["items"] = typeSchema(t.Elem())
+		s["minItems"], s["maxItems"] = t.Len(), t.Len()
+	case reflect.Struct:
+		props := make(map[string]any)
+		var required []string
+		for name, f := range jsonFields(t) {
+			props[name] = typeSchema(f.Type)
+			if f.Tag.Get("schema") == "required" {
+				required = append(required, name)
+			}
+		}
+		s["properties"] = props
+		s["additionalProperties"] = false
+		if len(required) > 0 {
+			sort.Strings(required)
+			s["required"] = required
+		}
+	}
+	return s
+}
+
+// jsonType is the JSON Schema type of values of t.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
+
+// schemaType describes the JSON values t accepts, for error messages.
+func schemaType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch typ := jsonType(t); typ {
+	case "array", "integer", "object":
+		return "an " + typ
+	default:
+		return "a " + typ
+	}
+}
+
+// renderInfoSchema returns the schema as written to info.schema.json.
+func renderInfoSchema() []byte {
+	data, err := json.MarshalIndent(infoSchema(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return append(data, '\n')
+}
+
+// sameJSON reports whether a and b hold the same JSON value, ignoring
+// formatting, since prettier reformats the checked-in files.
+func sameJSON(a, b []byte) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func runSchema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	var paths Paths
+	paths.registerFlags(fs)
+	output := fs.String("output", "", "schema file to write (default: <assets>/"+infoSchemaFile+")")
+	check := fs.Bool("check", false, "don't write; fail if the file is out of date")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: map-generator schema [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Writes the JSON Schema of info.json for editors.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := paths.resolve(); err != nil {
+		return err
+	}
+	if *output == "" {
+		*output = filepath.Join(paths.Assets, infoSchemaFile)
+	}
+	generated := renderInfoSchema()
+
+	if *check {
+		existing, err := os.ReadFile(*output)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %s: %w", *output, err)
+		}
+		if !sameJSON(existing, generated) {
+			return fmt.Errorf("%s is out of date; run `go run . schema` and commit the result", *output)
+		}
+		fmt.Printf("%s is up to date\n", *output)
+		return nil
+	}
+
+	if err := os.WriteFile(*output, generated, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+	fmt.Printf("Wrote %s\n", *output)
+	return nil
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"map-generator/mapgen"
+)
+
+// Source files discoverMaps looks for in a map folder, in this order, when
+// info.json doesn't name them.
+var (
+	imageFiles     = []string{"image.png", "image.webp", "image.tif", "image.tiff"}
+	heightmapFiles = []string{"heightmap.png", "heightmap.tif", "heightmap.tiff", "heightmap.raw", "heightmap.r16"}
+	waterMaskFiles = []string{"water.png", "water.webp", "water.tif", "water.tiff"}
+	demFiles       = []string{"dem.tif", "dem.tiff", "dem.asc"}
+)
+
+// minTiles is the smallest source.tiles, the pixels of a 4x4 map.
+const minTiles = 16
+
+// rawByteOrders are the names RawInfo.ByteOrder accepts.
+var rawByteOrders = []string{"little", "big"}
+
+// SourceInfo is the source block of info.json. It names the files a map is
+// drawn from when they don't have the names discoverMaps looks for, and
+// says how to read a heightmap or elevation model:
+//
+//	"source": {
+//	  "heightmap": "elevation.r16",
+//	  "water_mask": "coast.png",
+//	  "raw": { "width": 4096, "height": 2048 },
+//	  "height_curve": [[0, 0], [8000, 4], [30000, 20], [65535, 31]]
+//	}
+//
+//	"source": {
+//	  "dem": "srtm_38_03.tif",
+//	  "sea_level": 2,
+//	  "tiles": 2000000
+//	}
+type SourceInfo struct {
+	// Image is a color image classified with the legend: PNG, WebP or TIFF.
+	Image string `json:"image,omitempty"`
+	// Heightmap is a grayscale PNG or TIFF, or a .raw or .r16 file of
+	// samples in the Raw format, holding the elevation of every pixel.
+	Heightmap string `json:"heightmap,omitempty"`
+	// WaterMask is an image the size of the heightmap that is white where
+	// there is water and black elsewhere.
+	WaterMask string   `json:"water_mask,omitempty"`
+	Raw       *RawInfo `json:"raw,omitempty"`
+	// DEM is a digital elevation model, a single-band GeoTIFF or an ESRI
+	// ASCII grid, usually in meters.
+	DEM string `json:"dem,omitempty"`
+	// SeaLevel is the elevation of a DEM at or below which there is water,
+	// 0 by default. Cells without data are water too.
+	SeaLevel *float64 `json:"sea_level,omitempty"`
+	// Tiles resamples a DEM to about this many pixels, keeping its aspect
+	// ratio. By default a DEM keeps its size.
+	Tiles int `json:"tiles,omitempty"`
+	// HeightCurve maps elevations to land magnitudes 0-31 through
+	// [elevation, magnitude] points, linearly between them. Heightmap
+	// elevations are in 16-bit units and the curve defaults to
+	// [[0, 0], [65535, 31]]; DEM elevations are in the DEM's units and it
+	// defaults to plains up to 500, highlands up to 1500 and mountains
+	// above: [[0, 0], [500, 10], [1500, 20], [4000, 30]].
+	HeightCurve [][2]float64 `json:"height_curve,omitempty"`
+}
+
+// RawInfo is the format of a raw heightmap, which has no header.
+type RawInfo struct {
+	Width  int `json:"width" schema:"required"`
+	Height int `json:"height" schema:"required"`
+	// BitDepth is 8 or 16, the default.
+	BitDepth int `json:"bit_depth,omitempty"`
+	// ByteOrder of 16-bit samples is little, the default, or big.
+	ByteOrder string `json:"byte_order,omitempty"`
+}
+
+// isRaw reports whether a heightmap is a raw file rather than an image.
+func isRaw(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".raw" || ext == ".r16"
+}
+
+// check rejects source blocks that name files outside the map folder or
+// have settings the named source doesn't use. A nil block is valid.
+func (s *SourceInfo) check() error {
+	if s == nil {
+		return nil
+	}
+	for _, f := range []struct{ key, name string }{
+		{"image", s.Image}, {"heightmap", s.Heightmap}, {"water_mask", s.WaterMask}, {"dem", s.DEM},
+	} {
+		if f.name != "" && !filepath.IsLocal(f.name) {
+			return fmt.Errorf("source.%s %q is not a file in the map folder", f.key, f.name)
+		}
+	}
+	if s.Image != "" && (s.Heightmap != "" || s.WaterMask != "" || s.Raw != nil || s.HeightCurve != nil ||
+		s.DEM != "" || s.SeaLevel != nil || s.Tiles != 0) {
+		return fmt.Errorf("source: heightmap, water_mask, raw, dem, sea_level, tiles and height_curve can't be used with an image")
+	}
+	if s.DEM != "" && (s.Heightmap != "" || s.WaterMask != "" || s.Raw != nil) {
+		return fmt.Errorf("source: heightmap, water_mask and raw can't be used with a dem")
+	}
+	if s.Heightmap != "" && (s.SeaLevel != nil || s.Tiles != 0) {
+		return fmt.Errorf("source: sea_level and tiles are only used with a dem, not a heightmap")
+	}
+	if s.Tiles != 0 && s.Tiles < minTiles {
+		return fmt.Errorf("source.tiles %d is less than %d, the pixels of a 4x4 map", s.Tiles, minTiles)
+	}
+	if s.Raw != nil {
+		if s.Heightmap != "" && !isRaw(s.Heightmap) {
+			return fmt.Errorf("source: raw is only used for .raw and .r16 heightmaps, not %s", s.Heightmap)
+		}
+		if _, err := s.rawFormat(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.heightCurve(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// rawFormat returns the format of a raw heightmap.
+func (s *SourceInfo) rawFormat() (mapgen.RawFormat, error) {
+	if s == nil || s.Raw == nil {
+		return mapgen.RawFormat{}, fmt.Errorf("a raw heightmap needs a raw block with its width and height in the source block of info.json")
+	}
+	r := s.Raw
+	f := mapgen.RawFormat{Width: r.Width, Height: r.Height, BitDepth: r.BitDepth}
+	if f.BitDepth == 0 {
+		f.BitDepth = 16
+	}
+	if f.Width <= 0 || f.Height <= 0 {
+		return f, fmt.Errorf("source.raw: size %dx%d is not positive", f.Width, f.Height)
+	}
+	if f.BitDepth != 8 && f.BitDepth != 16 {
+		return f, fmt.Errorf("source.raw: bit_depth %d is not 8 or 16", f.BitDepth)
+	}
+	switch r.ByteOrder {
+	case "", "little":
+	case "big":
+		f.BigEndian = true
+	default:
+		return f, fmt.Errorf("source.raw: unknown byte_order %q (want %s)", r.ByteOrder, strings.Join(rawByteOrders, ", "))
+	}
+	return f, nil
+}
+
+// seaLevel returns the sea level of a DEM.
+func (s *SourceInfo) seaLevel() float64 {
+	if s == nil || s.SeaLevel == nil {
+		return 0
+	}
+	return *s.SeaLevel
+}
+
+// tiles returns the pixel count a DEM is resampled to, 0 to keep its size.
+func (s *SourceInfo) tiles() int {
+	if s == nil {
+		return 0
+	}
+	return s.Tiles
+}
+
+// heightCurve returns the height curve, nil for the default one.
+func (s *SourceInfo) heightCurve() (mapgen.HeightCurve, error) {
+	if s == nil || s.HeightCurve == nil {
+		return nil, nil
+	}
+	curve := make(mapgen.HeightCurve, len(s.HeightCurve))
+	for i, p := range s.HeightCurve {
+		curve[i] = mapgen.CurvePoint{Elevation: p[0], Magnitude: p[1]}
+	}
+	if err := curve.Validate(); err != nil {
+		return nil, fmt.Errorf("source.height_curve: %w", err)
+	}
+	return curve, nil
+}
+
+// checkUsed rejects settings the source of m doesn't use. It runs once
+// findSources has picked the source, so that settings aren't silently
+// ignored when the file was found by its name rather than named in
+// info.json.
+func (s *SourceInfo) checkUsed(m *MapEntry) error {
+	var unused []string
+	for _, setting := range []struct {
+		key  string
+		set  bool
+		used bool
+	}{
+		{"water_mask", s.WaterMask != "", m.Heightmap != ""},
+		{"raw", s.Raw != nil, isRaw(m.Heightmap)},
+		{"height_curve", s.HeightCurve != nil, m.Image == ""},
+		{"sea_level", s.SeaLevel != nil, m.DEM != ""},
+		{"tiles", s.Tiles != 0, m.DEM != ""},
+	} {
+		if setting.set && !setting.used {
+			unused = append(unused, setting.key)
+		}
+	}
+	switch len(unused) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("source: %s is not used by %s", unused[0], m.sourceFile())
+	}
+	last := len(unused) - 1
+	return fmt.Errorf("source: %s and %s are not used by %s", strings.Join(unused[:last], ", "), unused[last], m.sourceFile())
+}
+
+// findSources fills in the source files of m, a map folder whose info.json
+// has the given source block. When files are missing it returns why the map
+// is skipped instead, and it fails if the block has settings the source
+// doesn't use.
+func findSources(m *MapEntry, source *SourceInfo) (skip string, err error) {
+	var s SourceInfo
+	if source != nil {
+		s = *source
+	}
+	existing := func(names []string) []string {
+		var found []string
+		for _, name := range names {
+			if _, err := os.Stat(filepath.Join(m.Dir, name)); err == nil {
+				found = append(found, name)
+			}
+		}
+		return found
+	}
+
+	switch {
+	case s.Image != "":
+		m.Image = s.Image
+	case s.Heightmap != "":
+		m.Heightmap = s.Heightmap
+	case s.DEM != "":
+		m.DEM = s.DEM
+	default:
+		found := append(existing(imageFiles), existing(heightmapFiles)...)
+		found = append(found, existing(demFiles)...)
+		if len(found) == 0 {
+			return "has info.json but no image.png or other source file", nil
+		}
+		if len(found) > 1 {
+			return fmt.Sprintf("has both %s; name the one to use in the source block of info.json", strings.Join(found, " and ")), nil
+		}
+		switch {
+		case slices.Contains(imageFiles, found[0]):
+			m.Image = found[0]
+		case slices.Contains(demFiles, found[0]):
+			m.DEM = found[0]
+		default:
+			m.Heightmap = found[0]
+		}
+	}
+	if m.Heightmap != "" {
+		m.WaterMask = s.WaterMask
+		if m.WaterMask == "" {
+			masks := existing(waterMaskFiles)
+			if len(masks) != 1 {
+				return fmt.Sprintf("heightmap %s needs exactly one water mask (%s), or one named in info.json",
+					m.Heightmap, strings.Join(waterMaskFiles, ", ")), nil
+			}
+			m.WaterMask = masks[0]
+		}
+	}
+	for _, name := range []string{m.Image, m.Heightmap, m.WaterMask, m.DEM} {
+		if name == "" {
+			continue
+		}
+		if len(existing([]string{name})) == 0 {
+			return fmt.Sprintf("%s named in info.json does not exist", name), nil
+		}
+	}
+	return "", s.checkUsed(m)
+}
+
+// sourceFile is the file in the map folder holding the map's image,
+// heightmap or DEM.
+func (m MapEntry) sourceFile() string {
+	switch {
+	case m.Heightmap != "":
+		return m.Heightmap
+	case m.DEM != "":
+		return m.DEM
+	}
+	return m.Image
+}
+
+// rawConfig returns the size of a raw heightmap from info.json.
+func rawConfig(infoBuffer []byte) (image.Config, error) {
+	info, err := parseInfoFile(infoBuffer)
+	if err != nil {
+		return image.Config{}, fmt.Errorf("invalid info.json: %w", err)
+	}
+	f, err := info.Source.rawFormat()
+	if err != nil {
+		return image.Config{}, err
+	}
+	model := color.Gray16Model
+	if f.BitDepth == 8 {
+		model = color.GrayModel
+	}
+	return image.Config{ColorModel: model, Width: f.Width, Height: f.Height}, nil
+}
+
+// demConfig returns the size of a map drawn from a width x height DEM: its
+// own, or the size source.tiles resamples it to. There is no color model.
+func demConfig(width, height int, infoBuffer []byte) (image.Config, error) {
+	info, err := parseInfoFile(infoBuffer)
+	if err != nil {
+		return image.Config{}, fmt.Errorf("invalid info.json: %w", err)
+	}
+	if tiles := info.Source.tiles(); tiles > 0 {
+		width, height = mapgen.ResampleSize(width, height, tiles)
+	}
+	return image.Config{Width: width, Height: height}, nil
+}
+
+// demSize returns the size of a map's DEM, reading only its header.
+func (m MapEntry) demSize() (width, height int, err error) {
+	f, err := os.Open(filepath.Join(m.Dir, m.DEM))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	return mapgen.DecodeDEMConfig(f)
+}
+
+// sourceConfig returns the size, color model and format of a map's image or
+// heightmap, reading only its header. The format of raw heightmaps is
+// "raw", and that of DEMs "dem", whose size is the size of the map after
+// resampling.
+func (m MapEntry) sourceConfig() (image.Config, string, error) {
+	if m.DEM != "" {
+		width, height, err := m.demSize()
+		if err != nil {
+			return image.Config{}, "", err
+		}
+		infoBuffer, err := os.ReadFile(filepath.Join(m.Dir, "info.json"))
+		if err != nil {
+			return image.Config{}, "", err
+		}
+		cfg, err := demConfig(width, height, infoBuffer)
+		return cfg, "dem", err
+	}
+	if isRaw(m.sourceFile()) {
+		infoBuffer, err := os.ReadFile(filepath.Join(m.Dir, "info.json"))
+		if err != nil {
+			return image.Config{}, "", err
+		}
+		cfg, err := rawConfig(infoBuffer)
+		return cfg, "raw", err
+	}
+	f, err := os.Open(filepath.Join(m.Dir, m.sourceFile()))
+	if err != nil {
+		return image.Config{}, "", err
+	}
+	defer f.Close()
+	return image.DecodeConfig(f)
+}
+
+// config is sourceConfig for sources already read.
+func (s mapSources) config() (image.Config, error) {
+	if s.DEM {
+		width, height, err := mapgen.DecodeDEMConfig(bytes.NewReader(s.Image))
+		if err != nil {
+			return image.Config{}, err
+		}
+		return demConfig(width, height, s.Info)
+	}
+	if isRaw(s.ImageFile) {
+		return rawConfig(s.Info)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(s.Image))
+	return cfg, err
+}
+
+// pixels returns the pixel count of the map, or zero if its source can't be
+// read.
+func (s mapSources) pixels() int {
+	cfg, err := s.config()
+	if err != nil {
+		return 0
+	}
+	return cfg.Width * cfg.Height
+}
+
+// heightmap decodes the heightmap and water mask of a map drawn from a
+// heightmap.
+func (s mapSources) heightmap(info InfoFile) (*mapgen.Heightmap, error) {
+	var h *mapgen.Heightmap
+	if isRaw(s.ImageFile) {
+		f, err := info.Source.rawFormat()
+		if err != nil {
+			return nil, err
+		}
+		if h, err = mapgen.DecodeRaw(s.Image, f); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.ImageFile, err)
+		}
+	} else {
+		img, err := mapgen.Decode(s.Image)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.ImageFile, err)
+		}
+		h = mapgen.HeightmapFromImage(img)
+	}
+	mask, err := mapgen.Decode(s.WaterMask)
+	if err != nil {
+		return nil, fmt.Errorf("water mask: %w", err)
+	}
+	if err := h.SetWaterMask(mask); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// dem decodes the elevation model of a map, marks what is at or below sea
+// level as water and resamples it to source.tiles.
+func (s mapSources) dem(info InfoFile) (*mapgen.Heightmap, error) {
+	h, err := mapgen.DecodeDEM(s.Image)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.ImageFile, err)
+	}
+	h.SetSeaLevel(info.Source.seaLevel())
+	if tiles := info.Source.tiles(); tiles > 0 {
+		h = h.Resample(mapgen.ResampleSize(h.Width, h.Height, tiles))
+	}
+	return h, nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"map-generator/mapgen"
+)
+
+func TestFindSources(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"assets/maps/color/image.webp":             "",
+		"assets/maps/color/info.json":              `{"name": "Color"}`,
+		"assets/maps/height/heightmap.r16":         "",
+		"assets/maps/height/water.png":             "",
+		"assets/maps/height/info.json":             `{"name": "Height", "source": {"raw": {"width": 4, "height": 4}}}`,
+		"assets/maps/named/art/terrain.tif":        "",
+		"assets/maps/named/image.png":              "",
+		"assets/maps/named/info.json":              `{"name": "Named", "source": {"image": "art/terrain.tif"}}`,
+		"assets/maps/both/image.png":               "",
+		"assets/maps/both/heightmap.tif":           "",
+		"assets/maps/both/info.json":               `{"name": "Both"}`,
+		"assets/maps/nomask/heightmap.png":         "",
+		"assets/maps/nomask/info.json":             `{"name": "No mask"}`,
+		"assets/maps/missing/info.json":            `{"name": "Missing", "source": {"heightmap": "dem.raw", "water_mask": "water.png"}}`,
+		"assets/maps/missing/water.png":            "",
+		"assets/maps/elevation/dem.asc":            "",
+		"assets/maps/elevation/info.json":          `{"name": "Elevation", "source": {"sea_level": 2, "tiles": 1000}}`,
+		"assets/test_maps/registry_only/info.json": `{"name": "Registry only"}`,
+	})
+	maps, warnings, err := discoverMaps(Paths{Assets: filepath.Join(root, "assets")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]MapEntry)
+	for _, m := range maps {
+		got[m.Name] = m
+	}
+	for name, want := range map[string][4]string{
+		"color":     {"image.webp", "", "", ""},
+		"height":    {"", "heightmap.r16", "water.png", ""},
+		"named":     {"art/terrain.tif", "", "", ""},
+		"elevation": {"", "", "", "dem.asc"},
+	} {
+		m := got[name]
+		if [4]string{m.Image, m.Heightmap, m.WaterMask, m.DEM} != want {
+			t.Errorf("%s: image %q, heightmap %q, water mask %q, DEM %q, want %q", name, m.Image, m.Heightmap, m.WaterMask, m.DEM, want)
+		}
+	}
+	if len(maps) != 4 {
+		t.Errorf("found %d maps, want 4", len(maps))
+	}
+	for _, want := range []string{
+		"both: skipped, has both image.png and heightmap.tif",
+		"nomask: skipped, heightmap heightmap.png needs exactly one water mask",
+		"missing: skipped, dem.raw named in info.json does not exist",
+		"registry_only: skipped, has info.json but no image.png",
+	} {
+		if !strings.Contains(strings.Join(warnings, "\n"), want) {
+			t.Errorf("warnings %q lack %q", warnings, want)
+		}
+	}
+
+	for _, tc := range []struct{ source, want string }{
+		{`{"image": "../other/image.png"}`, `source.image "../other/image.png" is not a file in the map folder`},
+		{`{"image": "image.webp", "height_curve": [[0, 0]]}`, "can't be used with an image"},
+		{`{"heightmap": "heightmap.png", "raw": {"width": 4, "height": 4}}`, "raw is only used for .raw and .r16"},
+		{`{"raw": {"width": 4, "height": 4, "bit_depth": 12}}`, "bit_depth 12 is not 8 or 16"},
+		{`{"raw": {"width": 4, "height": 4, "byte_order": "middle"}}`, `unknown byte_order "middle"`},
+		{`{"height_curve": [[10, 0], [5, 10]]}`, "source.height_curve: height curve point 1"},
+		{`{"height_curve": [[0, 0], [10, 40]]}`, "magnitude 40, want 0-31"},
+		{`{"dem": "/data/srtm.tif"}`, `source.dem "/data/srtm.tif" is not a file in the map folder`},
+		{`{"dem": "srtm.tif", "water_mask": "water.png"}`, "can't be used with a dem"},
+		{`{"heightmap": "heightmap.png", "sea_level": 3}`, "sea_level and tiles are only used with a dem"},
+		{`{"image": "image.png", "tiles": 1000}`, "can't be used with an image"},
+		{`{"tiles": 4}`, "source.tiles 4 is less than 16"},
+	} {
+		var s SourceInfo
+		if err := decodeStrict([]byte(tc.source), &s); err != nil {
+			t.Fatalf("%s: %v", tc.source, err)
+		}
+		if err := s.check(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want %q", tc.source, err, tc.want)
+		}
+	}
+
+	// Settings the source found by its file name doesn't use
+	for _, tc := range []struct{ file, source, want string }{
+		{"image.png", `{"water_mask": "water.png"}`, "source: water_mask is not used by image.png"},
+		{"image.webp", `{"height_curve": [[0, 0], [10, 20]], "tiles": 1000}`, "source: height_curve and tiles are not used by image.webp"},
+		{"heightmap.png", `{"sea_level": 3}`, "source: sea_level is not used by heightmap.png"},
+		{"heightmap.tif", `{"raw": {"width": 4, "height": 4}}`, "source: raw is not used by heightmap.tif"},
+		{"dem.asc", `{"water_mask": "water.png", "raw": {"width": 4, "height": 4}}`, "source: water_mask and raw are not used by dem.asc"},
+	} {
+		root := t.TempDir()
+		writeTree(t, root, map[string]string{
+			"assets/maps/auto/" + tc.file: "",
+			"assets/maps/auto/water.png":  "",
+			"assets/maps/auto/info.json":  `{"name": "Auto", "source": ` + tc.source + `}`,
+		})
+		_, _, err := discoverMaps(Paths{Assets: filepath.Join(root, "assets")})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s with %s: got error %v, want %q", tc.file, tc.source, err, tc.want)
+		}
+	}
+}
+
+// TestHeightmapSource builds the same map from a raw heightmap and from a
+// 16-bit PNG of it.
+func TestHeightmapSource(t *testing.T) {
+	// Water on the left, land rising to the right
+	const w, h = 8, 4
+	raw := make([]byte, 2*w*h)
+	gray := image.NewGray16(image.Rect(0, 0, w, h))
+	mask := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint16(x * 8000)
+			binary.LittleEndian.PutUint16(raw[2*(y*w+x):], v)
+			gray.SetGray16(x, y, color.Gray16{v})
+			if x < 2 {
+				mask.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+	curve := `"height_curve": [[16000, 0], [56000, 20]]`
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"assets/test_maps/raw/heightmap.raw": string(raw),
+		"assets/test_maps/raw/water.png":     encodeTestPNG(t, mask),
+		"assets/test_maps/raw/info.json":     `{"name": "Raw", "source": {"raw": {"width": 8, "height": 4}, ` + curve + `}}`,
+		"assets/test_maps/png/height.png":    encodeTestPNG(t, gray),
+		"assets/test_maps/png/sea.png":       encodeTestPNG(t, mask),
+		"assets/test_maps/png/info.json":     `{"name": "PNG", "source": {"heightmap": "height.png", "water_mask": "sea.png", ` + curve + `}}`,
+	})
+	maps, warnings, err := discoverMaps(Paths{Assets: filepath.Join(root, "assets")})
+	if err != nil || len(maps) != 2 {
+		t.Fatalf("discoverMaps = %v, %v, %v", maps, warnings, err)
+	}
+
+	var built [][]byte
+	for _, m := range maps {
+		src, err := readSources(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg, err := src.config(); err != nil || cfg.Width != w || cfg.Height != h {
+			t.Errorf("%s: config = %+v, %v", m.Name, cfg, err)
+		}
+		out, err := renderMap(m, src, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", m.Name, err)
+		}
+		data := out.Files[0].Data
+		if out.Result.Map.NumLandTiles != 24 {
+			t.Errorf("%s: %d land tiles, want 24", m.Name, out.Result.Map.NumLandTiles)
+		}
+		// 40000 is 60% up the curve
+		if got := data[w+5] & 0x1f; got != 12 {
+			t.Errorf("%s: magnitude at 40000 is %d, want 12", m.Name, got)
+		}
+		built = append(built, data)
+
+		// The water mask is part of the source hash
+		changed := src
+		changed.WaterMask = []byte(encodeTestPNG(t, image.NewGray(image.Rect(0, 0, w, h))))
+		if changed.Hash() == src.Hash() {
+			t.Errorf("%s: source hash doesn't cover the water mask", m.Name)
+		}
+	}
+	if !bytes.Equal(built[0], built[1]) {
+		t.Errorf("raw and PNG heightmaps built different maps")
+	}
+}
+
+// TestDEMSource builds a production map from an ASCII grid: the sea and a
+// small island on the west, land rising to the east.
+func TestDEMSource(t *testing.T) {
+	const w, h = 80, 40
+	var grid strings.Builder
+	fmt.Fprintf(&grid, "ncols %d\nnrows %d\nxllcorner 0\nyllcorner 0\ncellsize 30\nNODATA_value -9999\n", w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			e := -10
+			switch {
+			case x >= 40:
+				e = (x - 39) * 100
+			case x >= 10 && x < 14 && y >= 10 && y < 14:
+				e = 500
+			case x == 0 && y == 0:
+				e = -9999
+			}
+			fmt.Fprintf(&grid, "%d ", e)
+		}
+		grid.WriteString("\n")
+	}
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"assets/maps/coast/dem.asc":   grid.String(),
+		"assets/maps/coast/info.json": `{"name": "Coast", "source": {"sea_level": 150, "tiles": 800}}`,
+	})
+	maps, warnings, err := discoverMaps(Paths{Assets: filepath.Join(root, "assets")})
+	if err != nil || len(maps) != 1 {
+		t.Fatalf("discoverMaps = %v, %v, %v", maps, warnings, err)
+	}
+	m := maps[0]
+	if cfg, format, err := m.sourceConfig(); err != nil || cfg.Width != 40 || cfg.Height != 20 || format != "dem" {
+		t.Errorf("sourceConfig = %+v, %q, %v, want 40x20 dem", cfg, format, err)
+	}
+	src, err := readSources(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := renderMap(m, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The island, 2x2 tiles after resampling, is removed. The first land
+	// column covers a cell at sea level and one above it.
+	result := out.Result.Map
+	if result.Width != 40 || result.Height != 20 || result.NumLandTiles != 400 {
+		t.Errorf("map is %dx%d with %d land tiles, want 40x20 with 400", result.Width, result.Height, result.NumLandTiles)
+	}
+	// Cells at 1100 and 1200 m make highlands, 16.5 on the default curve
+	if got := result.Data[5*40+25] & 0x1f; got != 17 {
+		t.Errorf("magnitude at 1150 m is %d, want 17", got)
+	}
+	if result.Data[6*40+6]&mapgen.LandBit != 0 {
+		t.Error("the island was not removed")
+	}
+}
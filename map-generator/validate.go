@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+
+	"map-generator/mapgen"
+)
+
+// maxRecommendedPixels is the size above which maps get slow to generate and
+// to play, see README.
+const maxRecommendedPixels = 4_000_000
+
+// validateMap checks a generated map against its sources and parsed
+// info.json and returns warnings about problems that don't stop the build but
+// are likely mistakes, such as nations placed in the sea or outside the map.
+// Nations are not checked for water if isLand is nil.
+func validateMap(m MapEntry, info InfoFile, src mapSources, result mapgen.MapResult, isLand func(x, y int) bool) []string {
+	var warnings []string
+	warnf := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	if cfg, err := src.config(); err == nil {
+		if cfg.Width%4 != 0 || cfg.Height%4 != 0 {
+			warnf("image is %dx%d; it is cropped to %dx%d because dimensions must be multiples of 4",
+				cfg.Width, cfg.Height, result.Map.Width, result.Map.Height)
+		}
+		if cfg.Width*cfg.Height > maxRecommendedPixels {
+			warnf("image has %d pixels, more than the recommended maximum of %d",
+				cfg.Width*cfg.Height, maxRecommendedPixels)
+		}
+	}
+	if u := result.Unclassified; u.Count > 0 {
+		worst := unclassifiedHotspots(u, 1)[0]
+		warnf("%d pixels (%.3f%%) match no legend color, %d of them in the %dx%d block at (%d, %d); run `go run . lint -png <dir>` to see them",
+			u.Count, unclassifiedPercent(u), worst.Count, hotspotSize, hotspotSize, worst.X, worst.Y)
+	}
+	if result.Map.NumLandTiles == 0 {
+		warnf("map has no land tiles")
+	}
+
+	if info.Name == "" {
+		warnf("info.json has no name")
+	}
+	if info.Nations == nil {
+		if !m.IsTest {
+			warnf("info.json has no nations")
+		}
+		return warnings
+	}
+
+	names := make(map[string]int)
+	coords := make(map[[2]int]int)
+	for i, n := range *info.Nations {
+		label := fmt.Sprintf("nation %d", i)
+		if n.Name != "" {
+			label = fmt.Sprintf("nation %d (%s)", i, n.Name)
+		} else {
+			warnf("%s has no name", label)
+		}
+		if n.Flag == "" {
+			warnf("%s has no flag", label)
+		}
+		if n.Strength == nil {
+			warnf("%s has no strength", label)
+		} else if *n.Strength <= 0 {
+			warnf("%s has non-positive strength %v", label, *n.Strength)
+		}
+		if n.Name != "" {
+			if j, ok := names[n.Name]; ok {
+				warnf("%s has the same name as nation %d", label, j)
+			}
+			names[n.Name] = i
+		}
+
+		if len(n.Coordinates) != 2 {
+			warnf("%s has %d coordinates, want 2", label, len(n.Coordinates))
+			continue
+		}
+		x, y := n.Coordinates[0], n.Coordinates[1]
+		if j, ok := coords[[2]int{x, y}]; ok {
+			warnf("%s is at the same coordinates as nation %d", label, j)
+		}
+		coords[[2]int{x, y}] = i
+
+		if x < 0 || y < 0 || x >= result.Map.Width || y >= result.Map.Height {
+			warnf("%s at (%d, %d) is outside the %dx%d map",
+				label, x, y, result.Map.Width, result.Map.Height)
+			continue
+		}
+		if isLand != nil && !isLand(x, y) {
+			warnf("%s at (%d, %d) is on water", label, x, y)
+		}
+	}
+	return warnings
+}
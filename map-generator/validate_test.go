@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"map-generator/mapgen"
+)
+
+func TestValidateMapNations(t *testing.T) {
+	strength := 1.0
+	nation := func(name, flag string, coords ...int) Nation {
+		return Nation{Coordinates: coords, Flag: flag, Name: name, Strength: &strength}
+	}
+	// A 4x4 map with land on the left half
+	result := mapgen.MapResult{Map: mapgen.MapInfo{Width: 4, Height: 4, NumLandTiles: 8}}
+	isLand := func(x, y int) bool { return x < 2 }
+
+	for _, tc := range []struct {
+		name   string
+		nation Nation
+		want   string
+	}{
+		{"on water", nation("Atlantis", "at", 3, 1), "nation 1 (Atlantis) at (3, 1) is on water"},
+		{"out of bounds", nation("Far", "fa", 1, 4), "nation 1 (Far) at (1, 4) is outside the 4x4 map"},
+		{"negative", nation("Far", "fa", -1, 0), "nation 1 (Far) at (-1, 0) is outside the 4x4 map"},
+		{"duplicate name", nation("Home", "ho", 1, 1), "nation 1 (Home) has the same name as nation 0"},
+		{"duplicate coordinates", nation("Twin", "tw", 0, 0), "nation 1 (Twin) is at the same coordinates as nation 0"},
+		{"one coordinate", nation("Line", "li", 1), "nation 1 (Line) has 1 coordinates, want 2"},
+		{"three coordinates", nation("Cube", "cu", 1, 1, 1), "nation 1 (Cube) has 3 coordinates, want 2"},
+		{"no name", nation("", "no", 1, 1), "nation 1 has no name"},
+		{"no flag", nation("Blank", "", 1, 1), "nation 1 (Blank) has no flag"},
+	} {
+		nations := []Nation{nation("Home", "ho", 0, 0), tc.nation}
+		info := InfoFile{Name: "Test", Nations: &nations}
+		warnings := validateMap(MapEntry{Name: "test"}, info, mapSources{}, result, isLand)
+		if len(warnings) != 1 || warnings[0] != tc.want {
+			t.Errorf("%s: warnings %q, want %q", tc.name, warnings, tc.want)
+		}
+	}
+
+	// Valid nations, and nations that aren't checked for water without a
+	// land lookup
+	nations := []Nation{nation("Home", "ho", 0, 0), nation("Coast", "co", 1, 3), nation("Sea", "se", 3, 3)}
+	info := InfoFile{Name: "Test", Nations: &nations}
+	if warnings := validateMap(MapEntry{Name: "test"}, info, mapSources{}, result, nil); len(warnings) != 0 {
+		t.Errorf("valid nations: warnings %q", warnings)
+	}
+	if warnings := validateMap(MapEntry{Name: "test"}, info, mapSources{}, result, isLand); len(warnings) != 1 ||
+		!strings.Contains(warnings[0], "(Sea) at (3, 3) is on water") {
+		t.Errorf("warnings %q, want one for the nation at sea", warnings)
+	}
+}
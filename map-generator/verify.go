@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// fileDrift describes how one committed output file differs from what the
+// generator produces from the current assets.
+type fileDrift struct {
+	File   string
+	Detail string
+}
+
+// verifyMap regenerates a map in memory and compares it with the committed
+// output. Binaries are compared byte for byte; manifest.json is compared as
+// JSON since it is reformatted by prettier after generation.
+func verifyMap(paths Paths, m MapEntry) ([]fileDrift, error) {
+	src, err := readSources(m)
+	if err != nil {
+		return nil, err
+	}
+	// Large maps are streamed like generate does, into memory so map.bin
+	// can be compared
+	var mapBin *bytes.Buffer
+	var mapWriter io.Writer
+	if (BuildOptions{}).stream(src.pixels()) {
+		mapBin = new(bytes.Buffer)
+		mapWriter = mapBin
+	}
+	out, err := renderMap(m, src, mapWriter)
+	if err != nil {
+		return nil, err
+	}
+	if mapBin != nil {
+		out.Files = append([]outputFile{{"map.bin", mapBin.Bytes()}}, out.Files...)
+	}
+
+	widths := make(map[string]int)
+	for _, lod := range out.Result.LODs() {
+		widths[lod.Key+".bin"] = lod.Info.Width
+	}
+
+	mapDir := filepath.Join(paths.outputMapDir(m.IsTest), m.Name)
+	var drift []fileDrift
+	for _, file := range out.Files {
+		if file.Name == "thumbnail.webp" {
+			// Lossy and only used for display
+			continue
+		}
+		committed, err := os.ReadFile(filepath.Join(mapDir, file.Name))
+		if os.IsNotExist(err) {
+			drift = append(drift, fileDrift{file.Name, "missing"})
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read committed %s for %s: %w", file.Name, m.Name, err)
+		}
+
+		var detail string
+		if file.Name == "manifest.json" {
+			detail, err = compareManifests(committed, file.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compare manifest for %s: %w", m.Name, err)
+			}
+		} else {
+			detail = compareTiles(committed, file.Data, widths[file.Name])
+		}
+		if detail != "" {
+			drift = append(drift, fileDrift{file.Name, detail})
+		}
+	}
+	return drift, nil
+}
+
+// compareTiles compares two packed terrain buffers, one byte per tile.
+func compareTiles(committed, generated []byte, width int) string {
+	if len(committed) != len(generated) {
+		return fmt.Sprintf("size differs: committed %d bytes, generated %d bytes", len(committed), len(generated))
+	}
+	changed, first := 0, -1
+	for i := range committed {
+		if committed[i] != generated[i] {
+			if first < 0 {
+				first = i
+			}
+			changed++
+		}
+	}
+	if changed == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d of %d tiles differ, first at (%d, %d)",
+		changed, len(committed), first%width, first/width)
+}
+
+// compareManifests compares two manifests as JSON and names the top-level
+// keys that differ. A source hash that is missing or differs from the
+// generated one is reported on its own: the map is otherwise up to date, but
+// the build cache would rebuild it.
+func compareManifests(committed, generated []byte) (string, error) {
+	var a, b map[string]interface{}
+	if err := json.Unmarshal(committed, &a); err != nil {
+		return fmt.Sprintf("committed manifest is not valid JSON: %v", err), nil
+	}
+	if err := json.Unmarshal(generated, &b); err != nil {
+		return "", err
+	}
+	committedHash, _ := a[sourceHashKey].(string)
+	generatedHash, _ := b[sourceHashKey].(string)
+	delete(a, sourceHashKey)
+	delete(b, sourceHashKey)
+
+	var keys []string
+	for k := range a {
+		if !reflect.DeepEqual(a[k], b[k]) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	var problems []string
+	if len(keys) > 0 {
+		sort.Strings(keys)
+		problems = append(problems, fmt.Sprintf("keys differ: %v", keys))
+	}
+	switch {
+	case committedHash == "":
+		problems = append(problems, "source_hash is missing")
+	case committedHash != generatedHash:
+		problems = append(problems, "source_hash is stale")
+	}
+	return strings.Join(problems, "; "), nil
+}
+
+func runVerify(args []string) (err error) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var paths Paths
+	paths.registerFlags(fs)
+	var logOpts logOptions
+	logOpts.registerFlags(fs)
+	var profiles profileOptions
+	profiles.registerFlags(fs)
+	set := fs.String("set", "all", "which maps to verify: all, prod or test")
+	jobs := fs.Int("jobs", runtime.NumCPU(), "number of maps to verify concurrently")
+	var budget byteSize
+	fs.Var(&budget, "mem-budget", "approximate memory limit for concurrent builds, e.g. 2GiB (default: no limit)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: map-generator verify [flags] [map|glob ...]\n\n")
+		fmt.Fprintf(fs.Output(), "Regenerates the selected maps in memory and fails if the committed output differs.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := logOpts.setup(); err != nil {
+		return err
+	}
+	stopProfiles, err := profiles.start()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if stopErr := stopProfiles(); err == nil {
+			err = stopErr
+		}
+	}()
+	if err := paths.resolve(); err != nil {
+		return err
+	}
+	selected, err := resolveMaps(paths, *set, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		drift []fileDrift
+		err   error
+	}
+	results := make([]result, len(selected))
+	index := make(map[MapEntry]int, len(selected))
+	mapJobs := make([]mapJob, len(selected))
+	for i, m := range selected {
+		index[m] = i
+		mapJobs[i] = estimateJob(m, BuildOptions{})
+	}
+	runJobs(mapJobs, *jobs, uint64(budget), func(m MapEntry) {
+		drift, err := verifyMap(paths, m)
+		results[index[m]] = result{drift, err}
+	})
+
+	failed := 0
+	for i, m := range selected {
+		r := results[i]
+		switch {
+		case r.err != nil:
+			failed++
+			fmt.Printf("ERROR  %s: %v\n", m.Name, r.err)
+		case len(r.drift) > 0:
+			failed++
+			fmt.Printf("DRIFT  %s\n", m.Name)
+			for _, d := range r.drift {
+				fmt.Printf("         %s: %s\n", d.File, d.Detail)
+			}
+		default:
+			fmt.Printf("OK     %s\n", m.Name)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d maps do not match their committed output; run the generator and commit the result", failed, len(selected))
+	}
+	fmt.Printf("All %d maps match their committed output\n", len(selected))
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestCompareTiles(t *testing.T) {
+	for _, tc := range []struct {
+		name                 string
+		committed, generated []byte
+		width                int
+		want                 string
+	}{
+		{"same", []byte{1, 2, 3, 4}, []byte{1, 2, 3, 4}, 2, ""},
+		{"empty", nil, []byte{}, 2, ""},
+		{"size", []byte{1, 2, 3, 4}, []byte{1, 2, 3, 4, 5, 6}, 2, "size differs: committed 4 bytes, generated 6 bytes"},
+		{"first tile", []byte{9, 2, 3, 4, 5, 6}, []byte{1, 2, 3, 4, 5, 6}, 3, "1 of 6 tiles differ, first at (0, 0)"},
+		{"first of several", []byte{1, 2, 3, 4, 5, 6}, []byte{1, 2, 3, 0, 0, 6}, 3, "2 of 6 tiles differ, first at (0, 1)"},
+		{"last tile", []byte{1, 2, 3, 4, 5, 6}, []byte{1, 2, 3, 4, 5, 7}, 2, "1 of 6 tiles differ, first at (1, 2)"},
+	} {
+		if got := compareTiles(tc.committed, tc.generated, tc.width); got != tc.want {
+			t.Errorf("%s: compareTiles = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCompareManifests(t *testing.T) {
+	const manifest = `{"map": {"width": 4, "height": 4, "num_land_tiles": 3}, "name": "Pluto", "source_hash": "abc"}`
+	for _, tc := range []struct {
+		name      string
+		committed string
+		want      string
+	}{
+		{"same", manifest, ""},
+		{"reformatted", "{\n  \"name\": \"Pluto\",\n  \"source_hash\": \"abc\",\n  \"map\": { \"num_land_tiles\": 3, \"height\": 4, \"width\": 4 }\n}\n", ""},
+		{"stale source hash", `{"map": {"width": 4, "height": 4, "num_land_tiles": 3}, "name": "Pluto", "source_hash": "def"}`, "source_hash is stale"},
+		{"no source hash", `{"map": {"width": 4, "height": 4, "num_land_tiles": 3}, "name": "Pluto"}`, "source_hash is missing"},
+		{"changed value and source hash", `{"map": {"width": 4, "height": 4, "num_land_tiles": 2}, "name": "Pluto", "source_hash": "def"}`, "keys differ: [map]; source_hash is stale"},
+		{"changed value", `{"map": {"width": 4, "height": 4, "num_land_tiles": 2}, "name": "Pluto", "source_hash": "abc"}`, "keys differ: [map]"},
+		{"extra and missing keys", `{"map": {"width": 4, "height": 4, "num_land_tiles": 3}, "width": 4, "source_hash": "abc"}`, "keys differ: [name width]"},
+		{"invalid", `{"map": `, "committed manifest is not valid JSON: unexpected end of JSON input"},
+	} {
+		got, err := compareManifests([]byte(tc.committed), []byte(manifest))
+		if err != nil || got != tc.want {
+			t.Errorf("%s: compareManifests = %q, %v, want %q", tc.name, got, err, tc.want)
+		}
+	}
+	if _, err := compareManifests([]byte(manifest), []byte("{")); err == nil {
+		t.Error("compareManifests accepted an invalid generated manifest")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sourceStamp identifies the state of a map's source files without reading
+// them. A missing file has a zero stamp.
+type sourceStamp struct {
+	Image                                                 string // name of the image or heightmap
+	ImageSize, MaskSize, InfoSize, LegendSize             int64
+	ImageModTime, MaskModTime, InfoModTime, LegendModTime time.Time
+}
+
+func stampSources(m MapEntry) sourceStamp {
+	s := sourceStamp{Image: m.sourceFile()}
+	if fi, err := os.Stat(filepath.Join(m.Dir, m.sourceFile())); err == nil {
+		s.ImageSize, s.ImageModTime = fi.Size(), fi.ModTime()
+	}
+	if m.WaterMask != "" {
+		if fi, err := os.Stat(filepath.Join(m.Dir, m.WaterMask)); err == nil {
+			s.MaskSize, s.MaskModTime = fi.Size(), fi.ModTime()
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(m.Dir, "info.json")); err == nil {
+		s.InfoSize, s.InfoModTime = fi.Size(), fi.ModTime()
+	}
+	if m.LegendFile != "" {
+		if fi, err := os.Stat(m.LegendFile); err == nil {
+			s.LegendSize, s.LegendModTime = fi.Size(), fi.ModTime()
+		}
+	}
+	return s
+}
+
+// watcher polls the assets tree and rebuilds maps whose sources changed. A
+// map is rebuilt once its stamp has been stable for one poll, so a save that
+// writes the file in several steps triggers a single build.
+type watcher struct {
+	paths    Paths
+	set      string
+	patterns []string
+
+	seen     map[string]sourceStamp // stamp at the previous poll
+	built    map[string]sourceStamp // stamp the current output was built from
+	warnings string                 // discovery warnings last printed
+}
+
+// poll checks every selected map once. The initial poll only records the
+// current stamps.
+func (w *watcher) poll(initial bool) error {
+	all, warnings, err := discoverMaps(w.paths)
+	if err != nil {
+		return err
+	}
+	if joined := strings.Join(warnings, "\n"); joined != w.warnings {
+		for _, warning := range warnings {
+			slog.Warn(warning)
+		}
+		w.warnings = joined
+	}
+	maps, err := selectMaps(all, w.set, w.patterns)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range maps {
+		stamp := stampSources(m)
+		if initial {
+			w.seen[m.Dir], w.built[m.Dir] = stamp, stamp
+			continue
+		}
+		if stamp != w.seen[m.Dir] {
+			// Still being written; wait for it to settle
+			w.seen[m.Dir] = stamp
+			continue
+		}
+		if built, ok := w.built[m.Dir]; ok && built == stamp {
+			continue
+		}
+		w.built[m.Dir] = stamp
+		w.rebuild(m)
+	}
+	return nil
+}
+
+func (w *watcher) rebuild(m MapEntry) {
+	fmt.Printf("\n%s changed, rebuilding\n", m.Name)
+	report := MapReport{Name: m.Name, Test: m.IsTest}
+	start := time.Now()
+	lock, err := lockOutputs(w.paths, []MapEntry{m})
+	if err == nil {
+		err = processMap(w.paths, m, BuildOptions{}, &report)
+		lock.unlock()
+	}
+	elapsed := time.Since(start).Seconds()
+
+	switch {
+	case err != nil:
+		fmt.Printf("%s failed after %.1fs: %v\n", m.Name, elapsed, err)
+		return
+	case report.Status == StatusUpToDate:
+		fmt.Printf("%s: sources unchanged, output is up to date\n", m.Name)
+		return
+	}
+	lod := report.LODs["map"]
+	fmt.Printf("%s rebuilt in %.1fs: %dx%d, %d land tiles\n",
+		m.Name, elapsed, lod.Width, lod.Height, lod.NumLandTiles)
+	if len(report.Warnings) == 0 {
+		fmt.Printf("%s: no warnings\n", m.Name)
+	}
+	for _, warning := range report.Warnings {
+		fmt.Printf("%s: warning: %s\n", m.Name, warning)
+	}
+}
+
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	var paths Paths
+	paths.registerFlags(fs)
+	var logOpts logOptions
+	logOpts.registerFlags(fs)
+	set := fs.String("set", "all", "which maps to watch: all, prod or test")
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often to check the assets for changes")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: map-generator watch [flags] [map|glob ...]\n\n")
+		fmt.Fprintf(fs.Output(), "Watches the assets tree and rebuilds a map when its source image or info.json changes.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := logOpts.setup(); err != nil {
+		return err
+	}
+	if err := paths.resolve(); err != nil {
+		return err
+	}
+	w := &watcher{
+		paths:    paths,
+		set:      *set,
+		patterns: fs.Args(),
+		seen:     make(map[string]sourceStamp),
+		built:    make(map[string]sourceStamp),
+	}
+	if err := w.poll(true); err != nil {
+		return err
+	}
+	fmt.Printf("Watching %s for changes, press Ctrl+C to stop\n", paths.Assets)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := w.poll(false); err != nil {
+				slog.Error(err.Error())
+			}
+		}
+	}
+}
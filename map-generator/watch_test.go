@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree creates the files in tree under root. Names ending in / are
+// created as empty directories.
+func writeTree(t *testing.T, root string, tree map[string]string) {
+	t.Helper()
+	for name, data := range tree {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func encodeTestPNG(t *testing.T, img image.Image) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestWatchRebuildsOnceStable(t *testing.T) {
+	// Land on the left, water on the right
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			if x < 16 {
+				img.SetNRGBA(x, y, color.NRGBA{190, 220, 150, 255})
+			} else {
+				img.SetNRGBA(x, y, color.NRGBA{0, 0, 106, 255})
+			}
+		}
+	}
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"assets/maps/":                     "",
+		"assets/test_maps/pluto/image.png": encodeTestPNG(t, img),
+		"assets/test_maps/pluto/info.json": `{"name": "Pluto"}`,
+	})
+	w := &watcher{
+		paths: Paths{
+			Assets:  filepath.Join(root, "assets"),
+			Out:     filepath.Join(root, "out"),
+			TestOut: filepath.Join(root, "test-out"),
+		},
+		set:   "all",
+		seen:  make(map[string]sourceStamp),
+		built: make(map[string]sourceStamp),
+	}
+	output := filepath.Join(w.paths.TestOut, "pluto", "map.bin")
+	built := func() bool {
+		_, err := os.Stat(output)
+		return err == nil
+	}
+
+	if err := w.poll(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.poll(false); err != nil || built() {
+		t.Fatalf("unchanged sources: poll = %v, built %v, want no build", err, built())
+	}
+
+	// A different size changes the stamp whatever the file system's mod time
+	// resolution
+	info := filepath.Join(root, "assets/test_maps/pluto/info.json")
+	if err := os.WriteFile(info, []byte(`{"name": "Pluto II"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.poll(false); err != nil || built() {
+		t.Fatalf("poll that saw the change: %v, built %v, want no build yet", err, built())
+	}
+	if err := w.poll(false); err != nil || !built() {
+		t.Fatalf("poll after a stable one: %v, built %v, want a build", err, built())
+	}
+
+	// Built once; later polls leave the output alone
+	if err := os.Remove(output); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.poll(false); err != nil || built() {
+		t.Errorf("poll after the build: %v, built %v, want no rebuild", err, built())
+	}
+}
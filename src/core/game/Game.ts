@@ -64,79 +64,8 @@ export const ColoredTeams: Record<string, Team> = {
   Bot: "Bot",
 } as const;
 
-export enum GameMapType {
-  World = "World",
-  GiantWorldMap = "Giant World Map",
-  Europe = "Europe",
-  EuropeClassic = "Europe Classic",
-  Mena = "Mena",
-  NorthAmerica = "North America",
-  SouthAmerica = "South America",
-  Oceania = "Oceania",
-  BlackSea = "Black Sea",
-  Africa = "Africa",
-  Pangaea = "Pangaea",
-  Asia = "Asia",
-  Mars = "Mars",
-  Britannia = "Britannia",
-  GatewayToTheAtlantic = "Gateway to the Atlantic",
-  Australia = "Australia",
-  Iceland = "Iceland",
-  EastAsia = "East Asia",
-  BetweenTwoSeas = "Between Two Seas",
-  FaroeIslands = "Faroe Islands",
-  DeglaciatedAntarctica = "Deglaciated Antarctica",
-  FalklandIslands = "Falkland Islands",
-  Baikal = "Baikal",
-  Halkidiki = "Halkidiki",
-  StraitOfGibraltar = "Strait of Gibraltar",
-  Italia = "Italia",
-  Japan = "Japan",
-  Yenisei = "Yenisei",
-  Pluto = "Pluto",
-  Montreal = "Montreal",
-}
-
-export type GameMapName = keyof typeof GameMapType;
-
-export const mapCategories: Record<string, GameMapType[]> = {
-  continental: [
-    GameMapType.World,
-    GameMapType.GiantWorldMap,
-    GameMapType.NorthAmerica,
-    GameMapType.SouthAmerica,
-    GameMapType.Europe,
-    GameMapType.EuropeClassic,
-    GameMapType.Asia,
-    GameMapType.Africa,
-    GameMapType.Oceania,
-  ],
-  regional: [
-    GameMapType.BlackSea,
-    GameMapType.Britannia,
-    GameMapType.GatewayToTheAtlantic,
-    GameMapType.BetweenTwoSeas,
-    GameMapType.Iceland,
-    GameMapType.EastAsia,
-    GameMapType.Mena,
-    GameMapType.Australia,
-    GameMapType.FaroeIslands,
-    GameMapType.FalklandIslands,
-    GameMapType.Baikal,
-    GameMapType.Halkidiki,
-    GameMapType.StraitOfGibraltar,
-    GameMapType.Italia,
-    GameMapType.Japan,
-    GameMapType.Yenisei,
-    GameMapType.Montreal,
-  ],
-  fantasy: [
-    GameMapType.Pangaea,
-    GameMapType.Pluto,
-    GameMapType.Mars,
-    GameMapType.DeglaciatedAntarctica,
-  ],
-};
+export { GameMapType, mapCategories } from "./MapRegistry";
+export type { GameMapName } from "./MapRegistry";
 
 export enum GameType {
   Singleplayer = "Singleplayer",
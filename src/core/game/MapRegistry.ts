@@ -0,0 +1,110 @@
+// Code generated by map-generator from map-generator/assets/*/info.json. DO NOT EDIT.
+// Run `npm run gen-map-registry` after changing a map's registry block.
+
+export enum GameMapType {
+  World = "World",
+  GiantWorldMap = "Giant World Map",
+  Europe = "Europe",
+  EuropeClassic = "Europe Classic",
+  Mena = "Mena",
+  NorthAmerica = "North America",
+  SouthAmerica = "South America",
+  Oceania = "Oceania",
+  BlackSea = "Black Sea",
+  Africa = "Africa",
+  Pangaea = "Pangaea",
+  Asia = "Asia",
+  Mars = "Mars",
+  Britannia = "Britannia",
+  GatewayToTheAtlantic = "Gateway to the Atlantic",
+  Australia = "Australia",
+  Iceland = "Iceland",
+  EastAsia = "East Asia",
+  BetweenTwoSeas = "Between Two Seas",
+  FaroeIslands = "Faroe Islands",
+  DeglaciatedAntarctica = "Deglaciated Antarctica",
+  FalklandIslands = "Falkland Islands",
+  Baikal = "Baikal",
+  Halkidiki = "Halkidiki",
+  StraitOfGibraltar = "Strait of Gibraltar",
+  Italia = "Italia",
+  Japan = "Japan",
+  Yenisei = "Yenisei",
+  Pluto = "Pluto",
+  Montreal = "Montreal",
+}
+
+export type GameMapName = keyof typeof GameMapType;
+
+export const mapCategories: Record<string, GameMapType[]> = {
+  continental: [
+    GameMapType.World,
+    GameMapType.GiantWorldMap,
+    GameMapType.NorthAmerica,
+    GameMapType.SouthAmerica,
+    GameMapType.Europe,
+    GameMapType.EuropeClassic,
+    GameMapType.Asia,
+    GameMapType.Africa,
+    GameMapType.Oceania,
+  ],
+  regional: [
+    GameMapType.BlackSea,
+    GameMapType.Britannia,
+    GameMapType.GatewayToTheAtlantic,
+    GameMapType.BetweenTwoSeas,
+    GameMapType.Iceland,
+    GameMapType.EastAsia,
+    GameMapType.Mena,
+    GameMapType.Australia,
+    GameMapType.FaroeIslands,
+    GameMapType.FalklandIslands,
+    GameMapType.Baikal,
+    GameMapType.Halkidiki,
+    GameMapType.StraitOfGibraltar,
+    GameMapType.Italia,
+    GameMapType.Japan,
+    GameMapType.Yenisei,
+    GameMapType.Montreal,
+  ],
+  fantasy: [
+    GameMapType.Pangaea,
+    GameMapType.Pluto,
+    GameMapType.Mars,
+    GameMapType.DeglaciatedAntarctica,
+  ],
+};
+
+// How many times each map should appear in the public lobby playlist.
+export const mapPlaylistWeights: Record<GameMapName, number> = {
+  Africa: 7,
+  Asia: 6,
+  Australia: 4,
+  Baikal: 5,
+  BetweenTwoSeas: 5,
+  BlackSea: 6,
+  Britannia: 5,
+  DeglaciatedAntarctica: 4,
+  EastAsia: 5,
+  Europe: 3,
+  EuropeClassic: 3,
+  FalklandIslands: 4,
+  FaroeIslands: 4,
+  GatewayToTheAtlantic: 5,
+  GiantWorldMap: 0,
+  Halkidiki: 4,
+  Iceland: 4,
+  Italia: 6,
+  Japan: 6,
+  Mars: 3,
+  Mena: 6,
+  Montreal: 6,
+  NorthAmerica: 5,
+  Oceania: 0,
+  Pangaea: 5,
+  Pluto: 6,
+  SouthAmerica: 5,
+  StraitOfGibraltar: 5,
+  World: 8,
+  Yenisei: 0,
+};
@@ -10,6 +10,7 @@ import {
   Quads,
   Trios,
 } from "../core/game/Game";
+import { mapPlaylistWeights } from "../core/game/MapRegistry";
 import { PseudoRandom } from "../core/PseudoRandom";
 import { GameConfig, TeamCountConfig } from "../core/Schemas";
 import { logger } from "./Logger";
@@ -18,39 +19,6 @@ const log = logger.child({});
 
 const config = getServerConfigFromServer();
 
-// How many times each map should appear in the playlist.
-// Note: The Partial should eventually be removed for better type safety.
-const frequency: Partial<Record<GameMapName, number>> = {
-  Africa: 7,
-  Asia: 6,
-  Australia: 4,
-  Baikal: 5,
-  BetweenTwoSeas: 5,
-  BlackSea: 6,
-  Britannia: 5,
-  DeglaciatedAntarctica: 4,
-  EastAsia: 5,
-  Europe: 3,
-  EuropeClassic: 3,
-  FalklandIslands: 4,
-  FaroeIslands: 4,
-  GatewayToTheAtlantic: 5,
-  Halkidiki: 4,
-  Iceland: 4,
-  Italia: 6,
-  Japan: 6,
-  Mars: 3,
-  Mena: 6,
-  Montreal: 6,
-  NorthAmerica: 5,
-  Pangaea: 5,
-  Pluto: 6,
-  SouthAmerica: 5,
-  StraitOfGibraltar: 5,
-  World: 8,
-  Yenisei: 0,
-};
-
 interface MapWithMode {
   map: GameMapType;
   mode: GameMode;
@@ -122,7 +90,7 @@ export class MapPlaylist {
   private shuffleMapsPlaylist(): boolean {
     const maps: GameMapType[] = [];
     (Object.keys(GameMapType) as GameMapName[]).forEach((key) => {
-      for (let i = 0; i < (frequency[key] ?? 0); i++) {
+      for (let i = 0; i < mapPlaylistWeights[key]; i++) {
         maps.push(GameMapType[key]);
       }
     });